@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/CosmWasm/go-cosmwasm/bech32"
+)
+
+// Bech32Config configures the GoAPI returned by NewBech32API
+type Bech32Config struct {
+	// Prefix is the human readable part of the addresses, e.g. "terra"
+	Prefix string
+	// AddressLengths are the allowed lengths of canonical addresses in bytes. Defaults to 20 if empty.
+	AddressLengths []int
+	// CostHumanize and CostCanonicalize are the gas costs of the address conversions
+	CostHumanize     uint64
+	CostCanonicalize uint64
+}
+
+// DefaultBech32Config returns a config for Terra addresses (terra1...), charging the same gas as wasmd
+func DefaultBech32Config() Bech32Config {
+	return Bech32Config{
+		Prefix:           "terra",
+		AddressLengths:   []int{20},
+		CostHumanize:     5 * 100,
+		CostCanonicalize: 4 * 100,
+	}
+}
+
+// NewBech32API returns a GoAPI that converts between bech32 addresses with the configured prefix and
+// their canonical bytes. Invalid addresses (wrong prefix, checksum or length) are returned to the contract as
+// errors and are charged like valid ones.
+func NewBech32API(config Bech32Config) GoAPI {
+	lengths := config.AddressLengths
+	if len(lengths) == 0 {
+		lengths = []int{20}
+	}
+	validLength := func(n int) bool {
+		for _, l := range lengths {
+			if n == l {
+				return true
+			}
+		}
+		return false
+	}
+
+	return GoAPI{
+		HumanAddress: func(canon []byte) (string, uint64, error) {
+			if !validLength(len(canon)) {
+				return "", config.CostHumanize, fmt.Errorf("invalid canonical address length %d", len(canon))
+			}
+			human, err := bech32.EncodeBytes(config.Prefix, canon)
+			if err != nil {
+				return "", config.CostHumanize, err
+			}
+			return human, config.CostHumanize, nil
+		},
+		CanonicalAddress: func(human string) ([]byte, uint64, error) {
+			prefix, canon, err := bech32.DecodeBytes(human)
+			if err != nil {
+				return nil, config.CostCanonicalize, fmt.Errorf("invalid address %q: %v", human, err)
+			}
+			if prefix != config.Prefix {
+				return nil, config.CostCanonicalize, fmt.Errorf("invalid address %q: expected prefix %q, got %q", human, config.Prefix, prefix)
+			}
+			if !validLength(len(canon)) {
+				return nil, config.CostCanonicalize, fmt.Errorf("invalid address %q: canonical length %d", human, len(canon))
+			}
+			return canon, config.CostCanonicalize, nil
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/bech32"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+const terraAddr = "terra1x46rqay4d3cssq8gxxvqz8xt6nwlz4td20k38v"
+
+func TestBech32API(t *testing.T) {
+	config := DefaultBech32Config()
+	api := NewBech32API(config)
+
+	canon, cost, err := api.CanonicalAddress(terraAddr)
+	require.NoError(t, err)
+	assert.Equal(t, 20, len(canon))
+	assert.Equal(t, config.CostCanonicalize, cost)
+
+	human, cost, err := api.HumanAddress(canon)
+	require.NoError(t, err)
+	assert.Equal(t, terraAddr, human)
+	assert.Equal(t, config.CostHumanize, cost)
+
+	// upper case is the same address
+	upper, _, err := api.CanonicalAddress("TERRA1X46RQAY4D3CSSQ8GXXVQZ8XT6NWLZ4TD20K38V")
+	require.NoError(t, err)
+	assert.Equal(t, canon, upper)
+
+	// errors are charged too
+	_, cost, err = api.CanonicalAddress("terra1x46rqay4d3cssq8gxxvqz8xt6nwlz4td20k38w")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), bech32.ErrInvalidChecksum.Error())
+	assert.Equal(t, config.CostCanonicalize, cost)
+
+	cosmos, err := bech32.EncodeBytes("cosmos", canon)
+	require.NoError(t, err)
+	_, _, err = api.CanonicalAddress(cosmos)
+	assert.EqualError(t, err, `invalid address "`+cosmos+`": expected prefix "terra", got "cosmos"`)
+
+	long, err := bech32.EncodeBytes("terra", make([]byte, 32))
+	require.NoError(t, err)
+	_, _, err = api.CanonicalAddress(long)
+	assert.Error(t, err)
+	_, _, err = api.HumanAddress(make([]byte, 32))
+	assert.EqualError(t, err, "invalid canonical address length 32")
+
+	// contract addresses may be longer
+	config.AddressLengths = []int{20, 32}
+	api = NewBech32API(config)
+	canon, _, err = api.CanonicalAddress(long)
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, 32), canon)
+}
+
+func TestHackatomWithBech32API(t *testing.T) {
+	cache, cleanup := withCache(t)
+	defer cleanup()
+	id := createTestContract(t, cache)
+
+	gasMeter := NewMockGasMeter(100000000)
+	igasMeter := GasMeter(gasMeter)
+	store := NewLookup(gasMeter)
+	api := NewBech32API(DefaultBech32Config())
+	querier := DefaultQuerier(mockContractAddr, types.Coins{types.NewCoin(100, "ATOM")})
+	params, err := json.Marshal(mockEnv(terraAddr))
+	require.NoError(t, err)
+	verifier, err := bech32.EncodeBytes("terra", []byte("verifier-verifier-12"))
+	require.NoError(t, err)
+	msg := []byte(`{"verifier": "` + verifier + `", "beneficiary": "` + terraAddr + `"}`)
+	_, _, err = Instantiate(cache, id, params, msg, &igasMeter, store, &api, &querier, 100000000)
+	require.NoError(t, err)
+
+	query := []byte(`{"verifier":{}}`)
+	data, _, err := Query(cache, id, query, &igasMeter, store, &api, &querier, 100000000)
+	require.NoError(t, err)
+	var qres types.QueryResponse
+	require.NoError(t, json.Unmarshal(data, &qres))
+	require.Nil(t, qres.Err, "%v", qres.Err)
+	assert.Equal(t, `{"verifier":"`+verifier+`"}`, string(qres.Ok))
+
+	// the contract gets the error of an invalid address
+	msg = []byte(`{"verifier": "terra1invalid", "beneficiary": "` + terraAddr + `"}`)
+	res, _, err := Instantiate(cache, id, params, msg, &igasMeter, store, &api, &querier, 100000000)
+	require.NoError(t, err)
+	var resp types.InitResult
+	require.NoError(t, json.Unmarshal(res, &resp))
+	require.NotNil(t, resp.Err)
+	require.NotNil(t, resp.Err.GenericErr)
+	assert.Contains(t, resp.Err.GenericErr.Msg, `invalid address "terra1invalid"`)
+}
@@ -44,6 +44,10 @@ enum GoResult {
    * An error happened during normal operation of a Go callback, which should be fed back to the contract
    */
   GoResult_User = 5,
+  /**
+   * The contract tried to write to a read-only store (e.g. during a query), which aborts the contract
+   */
+  GoResult_ReadOnly = 6,
 };
 typedef int32_t GoResult;
 
@@ -69,18 +73,20 @@ typedef struct db_t {
 } db_t;
 
 typedef struct iterator_t {
-  uint64_t db_counter;
   uint64_t iterator_index;
 } iterator_t;
 
 typedef struct Iterator_vtable {
-  int32_t (*next_db)(iterator_t, gas_meter_t*, uint64_t*, Buffer*, Buffer*, Buffer*);
+  int32_t (*next_db)(db_t*, iterator_t, gas_meter_t*, uint64_t*, Buffer*, Buffer*, Buffer*);
+  int32_t (*next_batch_db)(db_t*, iterator_t, gas_meter_t*, uint64_t*, uint64_t, Buffer*, Buffer*);
 } Iterator_vtable;
 
 typedef struct GoIter {
   gas_meter_t *gas_meter;
+  db_t *db;
   iterator_t state;
   Iterator_vtable vtable;
+  uint64_t batch_size;
 } GoIter;
 
 typedef struct DB_vtable {
@@ -9,7 +9,8 @@ typedef GoResult (*write_db_fn)(db_t *ptr, gas_meter_t *gas_meter, uint64_t *use
 typedef GoResult (*remove_db_fn)(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer key, Buffer *errOut);
 typedef GoResult (*scan_db_fn)(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer start, Buffer end, int32_t order, GoIter *out, Buffer *errOut);
 // iterator
-typedef GoResult (*next_db_fn)(iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer *key, Buffer *val, Buffer *errOut);
+typedef GoResult (*next_db_fn)(db_t *ptr, iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer *key, Buffer *val, Buffer *errOut);
+typedef GoResult (*next_batch_db_fn)(db_t *ptr, iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, uint64_t max_items, Buffer *batch, Buffer *errOut);
 // and api
 typedef GoResult (*humanize_address_fn)(api_t *ptr, Buffer canon, Buffer *human, Buffer *errOut, uint64_t *used_gas);
 typedef GoResult (*canonicalize_address_fn)(api_t *ptr, Buffer human, Buffer *canon, Buffer *errOut, uint64_t *used_gas);
@@ -21,7 +22,8 @@ GoResult cSet_cgo(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer
 GoResult cDelete_cgo(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer key, Buffer *errOut);
 GoResult cScan_cgo(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer start, Buffer end, int32_t order, GoIter *out, Buffer *errOut);
 // iterator
-GoResult cNext_cgo(iterator_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer *key, Buffer *val, Buffer *errOut);
+GoResult cNext_cgo(db_t *ptr, iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer *key, Buffer *val, Buffer *errOut);
+GoResult cNextBatch_cgo(db_t *ptr, iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, uint64_t max_items, Buffer *batch, Buffer *errOut);
 // api
 GoResult cHumanAddress_cgo(api_t *ptr, Buffer canon, Buffer *human, Buffer *errOut, uint64_t *used_gas);
 GoResult cCanonicalAddress_cgo(api_t *ptr, Buffer human, Buffer *canon, Buffer *errOut, uint64_t *used_gas);
@@ -33,10 +35,11 @@ GoResult cQueryExternal_cgo(querier_t *ptr, uint64_t gas_limit, uint64_t *used_g
 import "C"
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"log"
 	"reflect"
+	"runtime/debug"
 	"unsafe"
 
 	dbm "github.com/tendermint/tm-db"
@@ -47,7 +50,34 @@ import (
 // Note: we have to include all exports in the same file (at least since they both import bindings.h),
 // or get odd cgo build errors about duplicate definitions
 
-func recoverPanic(ret *C.GoResult) {
+// outOfGasInfo is written to the error buffer of a callback that ran out of gas. Rust keeps it
+// while the VM aborts and returns it in the error buffer of the contract call, see outOfGasError.
+type outOfGasInfo struct {
+	CallSite   string `json:"call_site"`
+	Descriptor string `json:"descriptor"`
+	Overflow   bool   `json:"overflow,omitempty"`
+}
+
+// panicRecorder is shared by all callbacks of one contract call. It keeps the first unexpected panic,
+// which aborts the contract and is returned from the call as types.CallbackPanicError.
+type panicRecorder struct {
+	err *types.CallbackPanicError
+}
+
+func (r *panicRecorder) record(callSite string, value interface{}, stack []byte) {
+	if r == nil || r.err != nil {
+		return
+	}
+	r.err = &types.CallbackPanicError{
+		CallSite: callSite,
+		Value:    value,
+		Stack:    stack,
+	}
+}
+
+// recoverPanic must be deferred by all callbacks. callSite is the name of the callback in the vtable,
+// panics is the recorder of the current call (nil if the state pointer we received is invalid).
+func recoverPanic(ret *C.GoResult, callSite string, errOut *C.Buffer, panics *panicRecorder) {
 	rec := recover()
 	// we don't want to import cosmos-sdk
 	// we also cannot use interfaces to detect these error types (as they have no methods)
@@ -58,23 +88,54 @@ func recoverPanic(ret *C.GoResult) {
 		switch name {
 		// These two cases are for types thrown in panics from this module:
 		// https://github.com/cosmos/cosmos-sdk/blob/4ffabb65a5c07dbb7010da397535d10927d298c1/store/types/gas.go
-		// ErrorOutOfGas needs to be propagated through the rust code and back into go code, where it should
-		// probably be thrown in a panic again.
-		// TODO figure out how to pass the text in its `Descriptor` field through all the FFI
-		// TODO handle these cases on the Rust side in the first place
+		// ErrorOutOfGas needs to be propagated through the rust code and back into go code, where it
+		// is returned as types.OutOfGasError.
 		case "ErrorOutOfGas":
 			*ret = C.GoResult_OutOfGas
-		// Looks like this error is not treated specially upstream:
+			writeOutOfGasInfo(errOut, outOfGasInfo{CallSite: callSite, Descriptor: panicDescriptor(rec)})
+		// The sdk does not treat this error specially upstream:
 		// https://github.com/cosmos/cosmos-sdk/blob/4ffabb65a5c07dbb7010da397535d10927d298c1/baseapp/baseapp.go#L818-L853
-		// but this needs to be periodically verified, in case they do start checking for this type
-		// 	case "ErrorGasOverflow":
+		// But the gas meter can not count any further, so the contract cannot continue either.
+		// We abort it like out of gas and flag the overflow.
+		case "ErrorGasOverflow":
+			*ret = C.GoResult_OutOfGas
+			writeOutOfGasInfo(errOut, outOfGasInfo{CallSite: callSite, Descriptor: panicDescriptor(rec), Overflow: true})
 		default:
-			log.Printf("Panic in Go callback: %#v\n", rec)
+			// the Wasmer reports this to its CallbackPanicHandler
+			panics.record(callSite, rec, debug.Stack())
 			*ret = C.GoResult_Panic
 		}
 	}
 }
 
+// panicDescriptor reads the Descriptor field of the sdk gas errors
+func panicDescriptor(rec interface{}) string {
+	v := reflect.ValueOf(rec)
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	field := v.FieldByName("Descriptor")
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return ""
+	}
+	return field.String()
+}
+
+func writeOutOfGasInfo(errOut *C.Buffer, info outOfGasInfo) {
+	if errOut == nil {
+		return
+	}
+	bz, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	// a callback may have allocated a message before panicking
+	if errOut.ptr != nil {
+		receiveVector(*errOut)
+	}
+	*errOut = allocateRust(bz)
+}
+
 type Gas = uint64
 
 // GasMeter is a copy of an interface declaration from cosmos-sdk
@@ -113,22 +174,58 @@ var db_vtable = C.DB_vtable{
 }
 
 type DBState struct {
+	// Store is the storage of the contract
 	Store KVStore
-	// IteratorStackID is used to lookup the proper stack frame for iterators associated with this DB (iterator.go)
-	IteratorStackID uint64
+	// panics is shared with the other callbacks of this contract call
+	panics *panicRecorder
+	// iterators holds all iterators opened during this contract call (iterator.go)
+	iterators []dbm.Iterator
+	// storeErr is the first storage error that aborted this call
+	storeErr error
+	// iteratorBatchSize is the number of items Rust reads from an iterator at once, 0 for one by one
+	// (see WithIteratorBatchSize)
+	iteratorBatchSize uint64
+}
+
+// storageError records a failure of the storage backend, so it can be returned from the contract call
+// as a types.StorageBackendError, and reports it to the contract (which will abort)
+func (s *DBState) storageError(op string, err error, errOut *C.Buffer) C.GoResult {
+	if s.storeErr == nil {
+		s.storeErr = types.StorageBackendError{Op: op, Err: err}
+	}
+	*errOut = allocateRust([]byte(s.storeErr.Error()))
+	return C.GoResult_Other
+}
+
+// rejectWrite records a write to a read-only store (see IsReadOnly), so it can be returned from the contract call
+// as a types.WriteInQueryError, and reports it to the contract (which will abort)
+func (s *DBState) rejectWrite(op string, key []byte, errOut *C.Buffer) C.GoResult {
+	if s.storeErr == nil {
+		s.storeErr = types.WriteInQueryError{Op: op, Key: key}
+	}
+	*errOut = allocateRust([]byte(s.storeErr.Error()))
+	return C.GoResult_ReadOnly
 }
 
 // use this to create C.DB in two steps, so the pointer lives as long as the calling stack
-//   state := buildDBState(kv, counter)
+//   state := buildDBState(kv, &panics)
+//   defer endContract(&state)
 //   db := buildDB(&state, &gasMeter)
 //   // then pass db into some FFI function
-func buildDBState(kv KVStore, counter uint64) DBState {
+func buildDBState(kv KVStore, panics *panicRecorder) DBState {
 	return DBState{
-		Store:           kv,
-		IteratorStackID: counter,
+		Store:  kv,
+		panics: panics,
 	}
 }
 
+func (s *DBState) recorder() *panicRecorder {
+	if s == nil {
+		return nil
+	}
+	return s.panics
+}
+
 // contract: original pointer/struct referenced must live longer than C.DB struct
 // since this is only used internally, we can verify the code that this is the case
 func buildDB(state *DBState, gm *GasMeter) C.DB {
@@ -140,29 +237,36 @@ func buildDB(state *DBState, gm *GasMeter) C.DB {
 }
 
 var iterator_vtable = C.Iterator_vtable{
+	next_db:       (C.next_db_fn)(C.cNext_cgo),
+	next_batch_db: (C.next_batch_db_fn)(C.cNextBatch_cgo),
+}
+
+// without next_batch_db, Rust falls back to next_db for every item
+var unbatched_iterator_vtable = C.Iterator_vtable{
 	next_db: (C.next_db_fn)(C.cNext_cgo),
 }
 
-// contract: original pointer/struct referenced must live longer than C.DB struct
-// since this is only used internally, we can verify the code that this is the case
-func buildIterator(dbCounter uint64, it dbm.Iterator) C.iterator_t {
-	idx := storeIterator(dbCounter, it)
+// buildIterator registers the iterator with the state and returns a reference for the Rust side.
+// This only contains an index, as we must not write Go pointers into Rust memory. Rust sets the db pointer
+// of the GoIter itself.
+func buildIterator(state *DBState, it dbm.Iterator) C.iterator_t {
+	idx := state.storeIterator(it)
 	return C.iterator_t{
-		db_counter:     u64(dbCounter),
 		iterator_index: u64(idx),
 	}
 }
 
 //export cGet
 func cGet(ptr *C.db_t, gasMeter *C.gas_meter_t, usedGas *u64, key C.Buffer, val *C.Buffer, errOut *C.Buffer) (ret C.GoResult) {
-	defer recoverPanic(&ret)
+	state := (*DBState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "db_read", errOut, state.recorder())
 	if ptr == nil || gasMeter == nil || usedGas == nil || val == nil {
 		// we received an invalid pointer
 		return C.GoResult_BadArgument
 	}
 
 	gm := *(*GasMeter)(unsafe.Pointer(gasMeter))
-	kv := *(*KVStore)(unsafe.Pointer(ptr))
+	kv := state.Store
 	k := receiveSlice(key)
 
 	gasBefore := gm.GasConsumed()
@@ -184,15 +288,19 @@ func cGet(ptr *C.db_t, gasMeter *C.gas_meter_t, usedGas *u64, key C.Buffer, val
 
 //export cSet
 func cSet(ptr *C.db_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, key C.Buffer, val C.Buffer, errOut *C.Buffer) (ret C.GoResult) {
-	defer recoverPanic(&ret)
-	if ptr == nil || gasMeter == nil || usedGas == nil {
+	state := (*DBState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "db_write", errOut, state.recorder())
+	if ptr == nil || gasMeter == nil || usedGas == nil || errOut == nil {
 		// we received an invalid pointer
 		return C.GoResult_BadArgument
 	}
 
 	gm := *(*GasMeter)(unsafe.Pointer(gasMeter))
-	kv := *(*KVStore)(unsafe.Pointer(ptr))
+	kv := state.Store
 	k := receiveSlice(key)
+	if IsReadOnly(kv) {
+		return state.rejectWrite("set", k, errOut)
+	}
 	v := receiveSlice(val)
 
 	gasBefore := gm.GasConsumed()
@@ -205,15 +313,19 @@ func cSet(ptr *C.db_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, key C.Buffe
 
 //export cDelete
 func cDelete(ptr *C.db_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, key C.Buffer, errOut *C.Buffer) (ret C.GoResult) {
-	defer recoverPanic(&ret)
-	if ptr == nil || gasMeter == nil || usedGas == nil {
+	state := (*DBState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "db_remove", errOut, state.recorder())
+	if ptr == nil || gasMeter == nil || usedGas == nil || errOut == nil {
 		// we received an invalid pointer
 		return C.GoResult_BadArgument
 	}
 
 	gm := *(*GasMeter)(unsafe.Pointer(gasMeter))
-	kv := *(*KVStore)(unsafe.Pointer(ptr))
+	kv := state.Store
 	k := receiveSlice(key)
+	if IsReadOnly(kv) {
+		return state.rejectWrite("delete", k, errOut)
+	}
 
 	gasBefore := gm.GasConsumed()
 	kv.Delete(k)
@@ -225,14 +337,14 @@ func cDelete(ptr *C.db_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, key C.Bu
 
 //export cScan
 func cScan(ptr *C.db_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, start C.Buffer, end C.Buffer, order i32, out *C.GoIter, errOut *C.Buffer) (ret C.GoResult) {
-	defer recoverPanic(&ret)
-	if ptr == nil || gasMeter == nil || usedGas == nil || out == nil {
+	state := (*DBState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "db_scan", errOut, state.recorder())
+	if ptr == nil || gasMeter == nil || usedGas == nil || out == nil || errOut == nil {
 		// we received an invalid pointer
 		return C.GoResult_BadArgument
 	}
 
 	gm := *(*GasMeter)(unsafe.Pointer(gasMeter))
-	state := (*DBState)(unsafe.Pointer(ptr))
 	kv := state.Store
 	// handle null as well as data
 	var s, e []byte
@@ -256,27 +368,46 @@ func cScan(ptr *C.db_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, start C.Bu
 	gasAfter := gm.GasConsumed()
 	*usedGas = (C.uint64_t)(gasAfter - gasBefore)
 
-	out.state = buildIterator(state.IteratorStackID, iter)
-	out.vtable = iterator_vtable
+	if err := iter.Error(); err != nil {
+		iter.Close()
+		return state.storageError("scan", err, errOut)
+	}
+
+	out.state = buildIterator(state, iter)
+	if state.iteratorBatchSize > 0 {
+		out.vtable = iterator_vtable
+		out.batch_size = C.uint64_t(state.iteratorBatchSize)
+	} else {
+		out.vtable = unbatched_iterator_vtable
+	}
 	return C.GoResult_Ok
 }
 
 //export cNext
-func cNext(ref C.iterator_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, key *C.Buffer, val *C.Buffer, errOut *C.Buffer) (ret C.GoResult) {
+func cNext(ptr *C.db_t, ref C.iterator_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, key *C.Buffer, val *C.Buffer, errOut *C.Buffer) (ret C.GoResult) {
 	// typical usage of iterator
 	// 	for ; itr.Valid(); itr.Next() {
 	// 		k, v := itr.Key(); itr.Value()
 	// 		...
 	// 	}
 
-	defer recoverPanic(&ret)
-	if ref.db_counter == 0 || gasMeter == nil || usedGas == nil || key == nil || val == nil {
+	state := (*DBState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "db_next", errOut, state.recorder())
+	if ptr == nil || gasMeter == nil || usedGas == nil || key == nil || val == nil || errOut == nil {
 		// we received an invalid pointer
 		return C.GoResult_BadArgument
 	}
 
 	gm := *(*GasMeter)(unsafe.Pointer(gasMeter))
-	iter := retrieveIterator(uint64(ref.db_counter), uint64(ref.iterator_index))
+	iter := state.retrieveIterator(uint64(ref.iterator_index))
+	if iter == nil {
+		// we received an invalid iterator reference
+		return C.GoResult_BadArgument
+	}
+	// a failing backend usually makes the iterator invalid, which must not look like the end of the range
+	if err := iter.Error(); err != nil {
+		return state.storageError("next", err, errOut)
+	}
 	if !iter.Valid() {
 		// end of iterator, return as no-op, nil key is considered end
 		return C.GoResult_Ok
@@ -286,11 +417,15 @@ func cNext(ref C.iterator_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, key *
 	// call Next at the end, upon creation we have first data loaded
 	k := iter.Key()
 	v := iter.Value()
-	// check iter.Error() ????
 	iter.Next()
 	gasAfter := gm.GasConsumed()
 	*usedGas = (C.uint64_t)(gasAfter - gasBefore)
 
+	// an error in Next may mean the key/value we read are not reliable either
+	if err := iter.Error(); err != nil {
+		return state.storageError("next", err, errOut)
+	}
+
 	if k != nil {
 		*key = allocateRust(k)
 		*val = allocateRust(v)
@@ -298,6 +433,82 @@ func cNext(ref C.iterator_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, key *
 	return C.GoResult_Ok
 }
 
+// cNextBatch reads up to maxItems key/value pairs in one call and returns them in a single buffer,
+// encoded by encodeKVBatch with the gas of each read, which Rust charges when it hands the item to the contract.
+// usedGas is the gas not included in any item, or all gas used if the call fails.
+// Fewer than maxItems pairs (possibly none) means the iterator is exhausted.
+//
+//export cNextBatch
+func cNextBatch(ptr *C.db_t, ref C.iterator_t, gasMeter *C.gas_meter_t, usedGas *C.uint64_t, maxItems C.uint64_t, batch *C.Buffer, errOut *C.Buffer) (ret C.GoResult) {
+	state := (*DBState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "db_next_batch", errOut, state.recorder())
+	if ptr == nil || gasMeter == nil || usedGas == nil || batch == nil || errOut == nil {
+		// we received an invalid pointer
+		return C.GoResult_BadArgument
+	}
+
+	gm := *(*GasMeter)(unsafe.Pointer(gasMeter))
+	iter := state.retrieveIterator(uint64(ref.iterator_index))
+	if iter == nil {
+		// we received an invalid iterator reference
+		return C.GoResult_BadArgument
+	}
+
+	scratch := getScratch()
+	defer putScratch(scratch)
+	data := *scratch
+	gasBefore := gm.GasConsumed()
+	var itemGas uint64
+	for n := uint64(0); n < uint64(maxItems); n++ {
+		// this also checks the Next of the previous item
+		if err := iter.Error(); err != nil {
+			*usedGas = (C.uint64_t)(gm.GasConsumed() - gasBefore)
+			return state.storageError("next", err, errOut)
+		}
+		if !iter.Valid() {
+			break
+		}
+		// the same reads as cNext, so an item costs the same gas
+		before := gm.GasConsumed()
+		k := iter.Key()
+		v := iter.Value()
+		iter.Next()
+		gas := gm.GasConsumed() - before
+		itemGas += gas
+		data = encodeKVBatch(data, gas, k, v)
+	}
+	gasAfter := gm.GasConsumed()
+
+	if err := iter.Error(); err != nil {
+		*usedGas = (C.uint64_t)(gasAfter - gasBefore)
+		return state.storageError("next", err, errOut)
+	}
+	*usedGas = (C.uint64_t)(gasAfter - gasBefore - itemGas)
+
+	// an empty batch stays a null buffer
+	if len(data) > 0 {
+		*batch = allocateRust(data)
+	}
+	// keep the grown buffer for the next batch
+	*scratch = data
+	return C.GoResult_Ok
+}
+
+// encodeKVBatch appends a key/value pair and the gas used to read it to a batch for the Rust iterator.
+// The gas is a 8 byte big endian integer, key and value are prefixed with their length as 4 byte big endian integer.
+func encodeKVBatch(data []byte, gas uint64, key []byte, value []byte) []byte {
+	var gasBytes [8]byte
+	binary.BigEndian.PutUint64(gasBytes[:], gas)
+	data = append(data, gasBytes[:]...)
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(key)))
+	data = append(data, length[:]...)
+	data = append(data, key...)
+	binary.BigEndian.PutUint32(length[:], uint32(len(value)))
+	data = append(data, length[:]...)
+	return append(data, value...)
+}
+
 /***** GoAPI *******/
 
 type HumanizeAddress func([]byte) (string, uint64, error)
@@ -313,23 +524,37 @@ var api_vtable = C.GoApi_vtable{
 	canonicalize_address: (C.canonicalize_address_fn)(C.cCanonicalAddress_cgo),
 }
 
+// apiState is what the api_t pointer of the callbacks points to
+type apiState struct {
+	API    *GoAPI
+	panics *panicRecorder
+}
+
+func (s *apiState) recorder() *panicRecorder {
+	if s == nil {
+		return nil
+	}
+	return s.panics
+}
+
 // contract: original pointer/struct referenced must live longer than C.GoApi struct
 // since this is only used internally, we can verify the code that this is the case
-func buildAPI(api *GoAPI) C.GoApi {
+func buildAPI(state *apiState) C.GoApi {
 	return C.GoApi{
-		state:  (*C.api_t)(unsafe.Pointer(api)),
+		state:  (*C.api_t)(unsafe.Pointer(state)),
 		vtable: api_vtable,
 	}
 }
 
 //export cHumanAddress
 func cHumanAddress(ptr *C.api_t, canon C.Buffer, human *C.Buffer, errOut *C.Buffer, used_gas *u64) (ret C.GoResult) {
-	defer recoverPanic(&ret)
-	if human == nil {
+	state := (*apiState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "humanize_address", errOut, state.recorder())
+	if ptr == nil || human == nil {
 		// we received an invalid pointer
 		return C.GoResult_BadArgument
 	}
-	api := (*GoAPI)(unsafe.Pointer(ptr))
+	api := state.API
 	c := receiveSlice(canon)
 	h, cost, err := api.HumanAddress(c)
 	*used_gas = u64(cost)
@@ -347,14 +572,15 @@ func cHumanAddress(ptr *C.api_t, canon C.Buffer, human *C.Buffer, errOut *C.Buff
 
 //export cCanonicalAddress
 func cCanonicalAddress(ptr *C.api_t, human C.Buffer, canon *C.Buffer, errOut *C.Buffer, used_gas *u64) (ret C.GoResult) {
-	defer recoverPanic(&ret)
+	state := (*apiState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "canonicalize_address", errOut, state.recorder())
 
-	if canon == nil {
+	if ptr == nil || canon == nil {
 		// we received an invalid pointer
 		return C.GoResult_BadArgument
 	}
 
-	api := (*GoAPI)(unsafe.Pointer(ptr))
+	api := state.API
 	h := string(receiveSlice(human))
 	c, cost, err := api.CanonicalAddress(h)
 	*used_gas = u64(cost)
@@ -378,38 +604,57 @@ var querier_vtable = C.Querier_vtable{
 	query_external: (C.query_external_fn)(C.cQueryExternal_cgo),
 }
 
+// querierState is what the querier_t pointer of the callbacks points to
+type querierState struct {
+	Querier Querier
+	panics  *panicRecorder
+}
+
+func (s *querierState) recorder() *panicRecorder {
+	if s == nil {
+		return nil
+	}
+	return s.panics
+}
+
 // contract: original pointer/struct referenced must live longer than C.GoQuerier struct
 // since this is only used internally, we can verify the code that this is the case
-func buildQuerier(q *Querier) C.GoQuerier {
+func buildQuerier(state *querierState) C.GoQuerier {
 	return C.GoQuerier{
-		state:  (*C.querier_t)(unsafe.Pointer(q)),
+		state:  (*C.querier_t)(unsafe.Pointer(state)),
 		vtable: querier_vtable,
 	}
 }
 
 //export cQueryExternal
 func cQueryExternal(ptr *C.querier_t, gasLimit C.uint64_t, usedGas *C.uint64_t, request C.Buffer, result *C.Buffer, errOut *C.Buffer) (ret C.GoResult) {
-	defer recoverPanic(&ret)
+	state := (*querierState)(unsafe.Pointer(ptr))
+	defer recoverPanic(&ret, "query_external", errOut, state.recorder())
 	if ptr == nil || usedGas == nil || result == nil {
 		// we received an invalid pointer
 		return C.GoResult_BadArgument
 	}
 
 	// query the data
-	querier := *(*Querier)(unsafe.Pointer(ptr))
-	req := receiveSlice(request)
+	querier := state.Querier
+	// the request is only decoded, so we do not need a copy
+	req := viewRustSlice(request)
 
 	gasBefore := querier.GasConsumed()
 	res := types.RustQuery(querier, req, uint64(gasLimit))
 	gasAfter := querier.GasConsumed()
 	*usedGas = (C.uint64_t)(gasAfter - gasBefore)
 
-	// serialize the response
-	bz, err := json.Marshal(res)
+	// serialize the response into a pooled buffer
+	scratch := getScratch()
+	defer putScratch(scratch)
+	bz, err := types.AppendCanonicalJSON(*scratch, res)
 	if err != nil {
 		*errOut = allocateRust([]byte(err.Error()))
 		return C.GoResult_Other
 	}
 	*result = allocateRust(bz)
+	// keep the grown buffer for the next result
+	*scratch = bz
 	return C.GoResult_Ok
 }
@@ -10,7 +10,8 @@ GoResult cGet(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer key,
 GoResult cDelete(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer key, Buffer *errOut);
 GoResult cScan(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer start, Buffer end, int32_t order, GoIter *out, Buffer *errOut);
 // imports (iterator)
-GoResult cNext(iterator_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer *key, Buffer *val, Buffer *errOut);
+GoResult cNext(db_t *ptr, iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer *key, Buffer *val, Buffer *errOut);
+GoResult cNextBatch(db_t *ptr, iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, uint64_t max_items, Buffer *batch, Buffer *errOut);
 // imports (api)
 GoResult cHumanAddress(api_t *ptr, Buffer canon, Buffer *human, Buffer *errOut, uint64_t *used_gas);
 GoResult cCanonicalAddress(api_t *ptr, Buffer human, Buffer *canon, Buffer *errOut, uint64_t *used_gas);
@@ -32,8 +33,11 @@ GoResult cScan_cgo(db_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer
 }
 
 // Gateway functions (iterator)
-GoResult cNext_cgo(iterator_t *ptr, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer *key, Buffer *val, Buffer *errOut) {
-	return cNext(ptr, gas_meter, used_gas, key, val, errOut);
+GoResult cNext_cgo(db_t *ptr, iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, Buffer *key, Buffer *val, Buffer *errOut) {
+	return cNext(ptr, idx, gas_meter, used_gas, key, val, errOut);
+}
+GoResult cNextBatch_cgo(db_t *ptr, iterator_t idx, gas_meter_t *gas_meter, uint64_t *used_gas, uint64_t max_items, Buffer *batch, Buffer *errOut) {
+	return cNextBatch(ptr, idx, gas_meter, used_gas, max_items, batch, errOut);
 }
 
 // Gateway functions (api)
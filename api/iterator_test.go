@@ -2,12 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	dbm "github.com/tendermint/tm-db"
 
 	"github.com/CosmWasm/go-cosmwasm/types"
 )
@@ -23,7 +25,7 @@ func (q queueData) Store(meter MockGasMeter) KVStore {
 	return q.store.WithGasMeter(meter)
 }
 
-func setupQueueContractWithData(t *testing.T, cache Cache, values ...int) queueData {
+func setupQueueContractWithData(t testing.TB, cache Cache, values ...int) queueData {
 	id := createQueueContract(t, cache)
 
 	gasMeter1 := NewMockGasMeter(100000000)
@@ -57,7 +59,7 @@ func setupQueueContractWithData(t *testing.T, cache Cache, values ...int) queueD
 	}
 }
 
-func setupQueueContract(t *testing.T, cache Cache) queueData {
+func setupQueueContract(t testing.TB, cache Cache) queueData {
 	return setupQueueContractWithData(t, cache, 17, 22)
 }
 
@@ -96,8 +98,6 @@ func TestQueueIteratorRaces(t *testing.T) {
 	cache, cleanup := withCache(t)
 	defer cleanup()
 
-	assert.Equal(t, len(iteratorStack), 0)
-
 	contract1 := setupQueueContractWithData(t, cache, 17, 22)
 	contract2 := setupQueueContractWithData(t, cache, 1, 19, 6, 35, 8)
 	contract3 := setupQueueContractWithData(t, cache, 11, 6, 2)
@@ -140,7 +140,260 @@ func TestQueueIteratorRaces(t *testing.T) {
 		}()
 	}
 	wg.Wait()
+}
+
+// closeCounter wraps an iterator to count calls to Close
+type closeCounter struct {
+	dbm.Iterator
+	closed *int
+}
+
+func (c closeCounter) Close() {
+	*c.closed++
+	c.Iterator.Close()
+}
+
+func TestQueueIteratorBatches(t *testing.T) {
+	cache, cleanup := withCache(t)
+	defer cleanup()
+
+	// more items than fit in one batch of the Rust iterator
+	values := make([]int, 70)
+	expected := 0
+	for i := range values {
+		values[i] = i
+		expected += i
+	}
+	setup := setupQueueContractWithData(t, cache, values...)
+	id, querier, api := setup.id, setup.querier, setup.api
+
+	// 0 is unbatched, 7 does not divide the items, 100 reads all at once
+	sizes := []uint64{0, 1, 7, DefaultIteratorBatchSize, 100}
+	gasUsed := make(map[uint64]uint64)
+	for _, size := range sizes {
+		t.Run(fmt.Sprintf("batch size %d", size), func(t *testing.T) {
+			cache := WithIteratorBatchSize(cache, size)
+
+			gasMeter := NewMockGasMeter(100000000)
+			igasMeter := GasMeter(gasMeter)
+			store := setup.Store(gasMeter)
+			data, used, err := Query(cache, id, []byte(`{"sum":{}}`), &igasMeter, store, api, &querier, 100000000)
+			require.NoError(t, err)
+			gasUsed[size] = used
+			var qres types.QueryResponse
+			err = json.Unmarshal(data, &qres)
+			require.NoError(t, err)
+			require.Nil(t, qres.Err, "%v", qres.Err)
+			require.Equal(t, fmt.Sprintf(`{"sum":%d}`, expected), string(qres.Ok))
+		})
+	}
+	// every item is charged when the contract gets it, as without batching
+	for _, size := range sizes {
+		assert.Equal(t, gasUsed[0], gasUsed[size], "batch size %d", size)
+	}
+}
+
+// gasIterator charges gas for every Next, like the iterators of the SDK
+type gasIterator struct {
+	dbm.Iterator
+	meter MockGasMeter
+}
+
+func (it gasIterator) Next() {
+	it.meter.ConsumeGas(uint64(10+len(it.Key())), "next")
+	it.Iterator.Next()
+}
+
+func TestNextBatchReportsGasPerItem(t *testing.T) {
+	gasMeter := NewMockGasMeter(100000000)
+	igasMeter := GasMeter(gasMeter)
+	db := dbm.NewMemDB()
+	for _, key := range []string{"a", "bb", "ccc"} {
+		require.NoError(t, db.Set([]byte(key), []byte("v"+key)))
+	}
+	iter, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	state := buildDBState(NewLookup(gasMeter), nil)
+	defer endContract(&state)
+	ref := buildIterator(&state, gasIterator{iter, gasMeter})
+	dbRef := buildDB(&state, &igasMeter)
+
+	var usedGas u64
+	batch := makeView(nil)
+	errOut := makeView(nil)
+	ret := cNextBatch(dbRef.state, ref, dbRef.gas_meter, &usedGas, 2, &batch, &errOut)
+	require.Equal(t, 0, int(ret))
+	assert.Equal(t, 0, int(usedGas))
+	expected := encodeKVBatch(nil, 11, []byte("a"), []byte("va"))
+	expected = encodeKVBatch(expected, 12, []byte("bb"), []byte("vbb"))
+	assert.Equal(t, expected, receiveVector(batch))
+	assert.Equal(t, uint64(11+12), gasMeter.GasConsumed())
+
+	// fewer items than asked for mean the iterator is exhausted
+	batch = makeView(nil)
+	ret = cNextBatch(dbRef.state, ref, dbRef.gas_meter, &usedGas, 2, &batch, &errOut)
+	require.Equal(t, 0, int(ret))
+	assert.Equal(t, encodeKVBatch(nil, 13, []byte("ccc"), []byte("vccc")), receiveVector(batch))
+
+	batch = makeView(nil)
+	ret = cNextBatch(dbRef.state, ref, dbRef.gas_meter, &usedGas, 2, &batch, &errOut)
+	require.Equal(t, 0, int(ret))
+	assert.Nil(t, receiveVector(batch))
+}
+
+func TestDBStateOwnsIterators(t *testing.T) {
+	db := dbm.NewMemDB()
+	require.NoError(t, db.Set([]byte("foo"), []byte("bar")))
+	state := buildDBState(NewLookup(NewMockGasMeter(100000000)), nil)
+
+	closed := 0
+	for i := 0; i < 3; i++ {
+		iter, err := db.Iterator(nil, nil)
+		require.NoError(t, err)
+		idx := state.storeIterator(closeCounter{iter, &closed})
+		assert.Equal(t, uint64(i+1), idx)
+	}
+
+	// 0 and out of range indexes are invalid
+	assert.Nil(t, state.retrieveIterator(0))
+	assert.Nil(t, state.retrieveIterator(4))
+	iter := state.retrieveIterator(2)
+	require.NotNil(t, iter)
+	assert.Equal(t, []byte("foo"), iter.Key())
+
+	// a second state does not see the iterators of the first one
+	other := buildDBState(NewLookup(NewMockGasMeter(100000000)), nil)
+	assert.Nil(t, other.retrieveIterator(1))
+
+	endContract(&state)
+	assert.Equal(t, 3, closed)
+	assert.Nil(t, state.retrieveIterator(1))
+}
+
+func BenchmarkQueueIteratorParallel(b *testing.B) {
+	cache, cleanup := withCache(b)
+	defer cleanup()
+	setup := setupQueueContractWithData(b, cache, 1, 19, 6, 35, 8)
+	id, querier, api := setup.id, setup.querier, setup.api
+	query := []byte(`{"reducer":{}}`)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			gasMeter := NewMockGasMeter(100000000)
+			igasMeter := GasMeter(gasMeter)
+			store := setup.Store(gasMeter)
+			_, _, err := Query(cache, id, query, &igasMeter, store, api, &querier, 100000000)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
 
-	// when they finish, we should have popped everything off the stack
-	assert.Equal(t, len(iteratorStack), 0)
+// benchmarkQueueSum sums a queue of 200 items, which reads them all through one iterator
+func benchmarkQueueSum(b *testing.B, batchSize uint64) {
+	cache, cleanup := withCache(b)
+	defer cleanup()
+	cache = WithIteratorBatchSize(cache, batchSize)
+	values := make([]int, 200)
+	for i := range values {
+		values[i] = i
+	}
+	setup := setupQueueContractWithData(b, cache, values...)
+	id, querier, api := setup.id, setup.querier, setup.api
+	query := []byte(`{"sum":{}}`)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gasMeter := NewMockGasMeter(100000000)
+		igasMeter := GasMeter(gasMeter)
+		store := setup.Store(gasMeter)
+		_, _, err := Query(cache, id, query, &igasMeter, store, api, &querier, 100000000)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueueIteratorBatched(b *testing.B) {
+	benchmarkQueueSum(b, DefaultIteratorBatchSize)
+}
+
+func BenchmarkQueueIteratorUnbatched(b *testing.B) {
+	benchmarkQueueSum(b, 0)
+}
+
+func BenchmarkIteratorRegistryParallel(b *testing.B) {
+	db := dbm.NewMemDB()
+	require.NoError(b, db.Set([]byte("foo"), []byte("bar")))
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			// one contract call opening a few iterators
+			state := buildDBState(nil, nil)
+			for i := 0; i < 4; i++ {
+				iter, _ := db.Iterator(nil, nil)
+				idx := state.storeIterator(iter)
+				state.retrieveIterator(idx).Next()
+			}
+			endContract(&state)
+		}
+	})
+}
+
+// failingIterator reports a backend error after the first item
+type failingIterator struct {
+	dbm.Iterator
+	calls int
+}
+
+func (f *failingIterator) Next() {
+	f.calls++
+	f.Iterator.Next()
+}
+
+func (f *failingIterator) Valid() bool {
+	return f.calls == 0 && f.Iterator.Valid()
+}
+
+func (f *failingIterator) Error() error {
+	if f.calls > 0 {
+		return errors.New("corrupted leveldb block")
+	}
+	return nil
+}
+
+// failingLookup is a Lookup whose iterators fail
+type failingLookup struct {
+	*Lookup
+}
+
+func (l failingLookup) Iterator(start, end []byte) dbm.Iterator {
+	return &failingIterator{Iterator: l.Lookup.Iterator(start, end)}
+}
+
+func (l failingLookup) ReverseIterator(start, end []byte) dbm.Iterator {
+	return &failingIterator{Iterator: l.Lookup.ReverseIterator(start, end)}
+}
+
+func TestQueueIteratorBackendError(t *testing.T) {
+	cache, cleanup := withCache(t)
+	defer cleanup()
+
+	setup := setupQueueContract(t, cache)
+	id, querier, api := setup.id, setup.querier, setup.api
+
+	gasMeter := NewMockGasMeter(100000000)
+	igasMeter := GasMeter(gasMeter)
+	store := failingLookup{setup.store.WithGasMeter(gasMeter)}
+
+	// with a working store, this sums up 17 and 22, but the broken iterator must not look like the end
+	query := []byte(`{"sum":{}}`)
+	_, _, err := Query(cache, id, query, &igasMeter, store, api, &querier, 100000000)
+	require.Error(t, err)
+	var backendErr types.StorageBackendError
+	require.True(t, errors.As(err, &backendErr), "%v", err)
+	assert.Equal(t, "next", backendErr.Op)
+	assert.EqualError(t, backendErr.Err, "corrupted leveldb block")
 }
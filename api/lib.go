@@ -5,7 +5,9 @@ package api
 import "C"
 
 import (
+	"encoding/json"
 	"fmt"
+	"runtime"
 	"syscall"
 
 	"github.com/CosmWasm/go-cosmwasm/types"
@@ -22,15 +24,31 @@ type cint = C.int
 
 type Cache struct {
 	ptr *C.cache_t
+	// iteratorBatchSize is passed on to the DBState of every call
+	iteratorBatchSize uint64
+}
+
+// DefaultIteratorBatchSize is a good batch size for WithIteratorBatchSize
+const DefaultIteratorBatchSize = 32
+
+// WithIteratorBatchSize returns cache with the items of iterators read in batches of size, or one by one for 0 (the default).
+// Batching saves a cgo round-trip per item, but reads up to size items ahead of the contract. The gas of an item
+// is still charged by the VM when the contract gets it, but the reads ahead happen on the store, so its gas
+// meter is charged for items the contract may never see. All nodes of a chain must use the same size.
+func WithIteratorBatchSize(cache Cache, size uint64) Cache {
+	cache.iteratorBatchSize = size
+	return cache
 }
 
 type Querier = types.Querier
 
 func InitCache(dataDir string, supportedFeatures string, cacheSize uint64) (Cache, error) {
-	dir := sendSlice([]byte(dataDir))
-	defer freeAfterSend(dir)
-	features := sendSlice([]byte(supportedFeatures))
-	defer freeAfterSend(features)
+	dirBytes := []byte(dataDir)
+	dir := makeView(dirBytes)
+	defer runtime.KeepAlive(dirBytes)
+	featuresBytes := []byte(supportedFeatures)
+	features := makeView(featuresBytes)
+	defer runtime.KeepAlive(featuresBytes)
 	errmsg := C.Buffer{}
 
 	ptr, err := C.init_cache(dir, features, usize(cacheSize), &errmsg)
@@ -45,8 +63,8 @@ func ReleaseCache(cache Cache) {
 }
 
 func Create(cache Cache, wasm []byte) ([]byte, error) {
-	code := sendSlice(wasm)
-	defer freeAfterSend(code)
+	code := makeView(wasm)
+	defer runtime.KeepAlive(wasm)
 	errmsg := C.Buffer{}
 	id, err := C.create(cache.ptr, code, &errmsg)
 	if err != nil {
@@ -56,8 +74,8 @@ func Create(cache Cache, wasm []byte) ([]byte, error) {
 }
 
 func GetCode(cache Cache, code_id []byte) ([]byte, error) {
-	id := sendSlice(code_id)
-	defer freeAfterSend(id)
+	id := makeView(code_id)
+	defer runtime.KeepAlive(code_id)
 	errmsg := C.Buffer{}
 	code, err := C.get_code(cache.ptr, id, &errmsg)
 	if err != nil {
@@ -77,28 +95,36 @@ func Instantiate(
 	querier *Querier,
 	gasLimit uint64,
 ) ([]byte, uint64, error) {
-	id := sendSlice(code_id)
-	defer freeAfterSend(id)
-	p := sendSlice(params)
-	defer freeAfterSend(p)
-	m := sendSlice(msg)
-	defer freeAfterSend(m)
-
-	// set up a new stack frame to handle iterators
-	counter := startContract()
-	defer endContract(counter)
-
-	dbState := buildDBState(store, counter)
+	id := makeView(code_id)
+	defer runtime.KeepAlive(code_id)
+	p := makeView(params)
+	defer runtime.KeepAlive(params)
+	m := makeView(msg)
+	defer runtime.KeepAlive(msg)
+
+	// the state owns all iterators opened during this call, they are closed at the end
+	var panics panicRecorder
+	dbState := buildDBState(store, &panics)
+	dbState.iteratorBatchSize = cache.iteratorBatchSize
+	defer endContract(&dbState)
 	db := buildDB(&dbState, gasMeter)
-	a := buildAPI(api)
-	q := buildQuerier(querier)
+	aState := apiState{API: api, panics: &panics}
+	a := buildAPI(&aState)
+	qState := querierState{Querier: *querier, panics: &panics}
+	q := buildQuerier(&qState)
 	var gasUsed u64
 	errmsg := C.Buffer{}
 
 	res, err := C.instantiate(cache.ptr, id, p, m, db, a, q, u64(gasLimit), &gasUsed, &errmsg)
+	if err := abortedCall(&panics, &dbState); err != nil {
+		// a callback failed, so we cannot trust the result of the contract
+		receiveVector(errmsg)
+		receiveVector(res)
+		return nil, uint64(gasUsed), err
+	}
 	if err != nil && err.(syscall.Errno) != C.ErrnoValue_Success {
 		// Depending on the nature of the error, `gasUsed` will either have a meaningful value, or just 0.
-		return nil, uint64(gasUsed), errorWithMessage(err, errmsg)
+		return nil, uint64(gasUsed), contractError(err, errmsg, gasLimit, gasUsed)
 	}
 	return receiveVector(res), uint64(gasUsed), nil
 }
@@ -114,28 +140,36 @@ func Handle(
 	querier *Querier,
 	gasLimit uint64,
 ) ([]byte, uint64, error) {
-	id := sendSlice(code_id)
-	defer freeAfterSend(id)
-	p := sendSlice(params)
-	defer freeAfterSend(p)
-	m := sendSlice(msg)
-	defer freeAfterSend(m)
-
-	// set up a new stack frame to handle iterators
-	counter := startContract()
-	defer endContract(counter)
-
-	dbState := buildDBState(store, counter)
+	id := makeView(code_id)
+	defer runtime.KeepAlive(code_id)
+	p := makeView(params)
+	defer runtime.KeepAlive(params)
+	m := makeView(msg)
+	defer runtime.KeepAlive(msg)
+
+	// the state owns all iterators opened during this call, they are closed at the end
+	var panics panicRecorder
+	dbState := buildDBState(store, &panics)
+	dbState.iteratorBatchSize = cache.iteratorBatchSize
+	defer endContract(&dbState)
 	db := buildDB(&dbState, gasMeter)
-	a := buildAPI(api)
-	q := buildQuerier(querier)
+	aState := apiState{API: api, panics: &panics}
+	a := buildAPI(&aState)
+	qState := querierState{Querier: *querier, panics: &panics}
+	q := buildQuerier(&qState)
 	var gasUsed u64
 	errmsg := C.Buffer{}
 
 	res, err := C.handle(cache.ptr, id, p, m, db, a, q, u64(gasLimit), &gasUsed, &errmsg)
+	if err := abortedCall(&panics, &dbState); err != nil {
+		// a callback failed, so we cannot trust the result of the contract
+		receiveVector(errmsg)
+		receiveVector(res)
+		return nil, uint64(gasUsed), err
+	}
 	if err != nil && err.(syscall.Errno) != C.ErrnoValue_Success {
 		// Depending on the nature of the error, `gasUsed` will either have a meaningful value, or just 0.
-		return nil, uint64(gasUsed), errorWithMessage(err, errmsg)
+		return nil, uint64(gasUsed), contractError(err, errmsg, gasLimit, gasUsed)
 	}
 	return receiveVector(res), uint64(gasUsed), nil
 }
@@ -151,28 +185,36 @@ func Migrate(
 	querier *Querier,
 	gasLimit uint64,
 ) ([]byte, uint64, error) {
-	id := sendSlice(code_id)
-	defer freeAfterSend(id)
-	p := sendSlice(params)
-	defer freeAfterSend(p)
-	m := sendSlice(msg)
-	defer freeAfterSend(m)
-
-	// set up a new stack frame to handle iterators
-	counter := startContract()
-	defer endContract(counter)
-
-	dbState := buildDBState(store, counter)
+	id := makeView(code_id)
+	defer runtime.KeepAlive(code_id)
+	p := makeView(params)
+	defer runtime.KeepAlive(params)
+	m := makeView(msg)
+	defer runtime.KeepAlive(msg)
+
+	// the state owns all iterators opened during this call, they are closed at the end
+	var panics panicRecorder
+	dbState := buildDBState(store, &panics)
+	dbState.iteratorBatchSize = cache.iteratorBatchSize
+	defer endContract(&dbState)
 	db := buildDB(&dbState, gasMeter)
-	a := buildAPI(api)
-	q := buildQuerier(querier)
+	aState := apiState{API: api, panics: &panics}
+	a := buildAPI(&aState)
+	qState := querierState{Querier: *querier, panics: &panics}
+	q := buildQuerier(&qState)
 	var gasUsed u64
 	errmsg := C.Buffer{}
 
 	res, err := C.migrate(cache.ptr, id, p, m, db, a, q, u64(gasLimit), &gasUsed, &errmsg)
+	if err := abortedCall(&panics, &dbState); err != nil {
+		// a callback failed, so we cannot trust the result of the contract
+		receiveVector(errmsg)
+		receiveVector(res)
+		return nil, uint64(gasUsed), err
+	}
 	if err != nil && err.(syscall.Errno) != C.ErrnoValue_Success {
 		// Depending on the nature of the error, `gasUsed` will either have a meaningful value, or just 0.
-		return nil, uint64(gasUsed), errorWithMessage(err, errmsg)
+		return nil, uint64(gasUsed), contractError(err, errmsg, gasLimit, gasUsed)
 	}
 	return receiveVector(res), uint64(gasUsed), nil
 }
@@ -187,40 +229,82 @@ func Query(
 	querier *Querier,
 	gasLimit uint64,
 ) ([]byte, uint64, error) {
-	id := sendSlice(code_id)
-	defer freeAfterSend(id)
-	m := sendSlice(msg)
-	defer freeAfterSend(m)
-
-	// set up a new stack frame to handle iterators
-	counter := startContract()
-	defer endContract(counter)
+	id := makeView(code_id)
+	defer runtime.KeepAlive(code_id)
+	m := makeView(msg)
+	defer runtime.KeepAlive(msg)
 
-	dbState := buildDBState(store, counter)
+	// the state owns all iterators opened during this call, they are closed at the end
+	var panics panicRecorder
+	dbState := buildDBState(store, &panics)
+	dbState.iteratorBatchSize = cache.iteratorBatchSize
+	defer endContract(&dbState)
 	db := buildDB(&dbState, gasMeter)
-	a := buildAPI(api)
-	q := buildQuerier(querier)
+	aState := apiState{API: api, panics: &panics}
+	a := buildAPI(&aState)
+	qState := querierState{Querier: *querier, panics: &panics}
+	q := buildQuerier(&qState)
 	var gasUsed u64
 	errmsg := C.Buffer{}
 
 	res, err := C.query(cache.ptr, id, m, db, a, q, u64(gasLimit), &gasUsed, &errmsg)
+	if err := abortedCall(&panics, &dbState); err != nil {
+		// a callback failed, so we cannot trust the result of the contract
+		receiveVector(errmsg)
+		receiveVector(res)
+		return nil, uint64(gasUsed), err
+	}
 	if err != nil && err.(syscall.Errno) != C.ErrnoValue_Success {
 		// Depending on the nature of the error, `gasUsed` will either have a meaningful value, or just 0.
-		return nil, uint64(gasUsed), errorWithMessage(err, errmsg)
+		return nil, uint64(gasUsed), contractError(err, errmsg, gasLimit, gasUsed)
 	}
 	return receiveVector(res), uint64(gasUsed), nil
 }
 
 /**** To error module ***/
 
+// abortedCall returns the error of a Go callback that aborted the contract call, if any.
+// A panic is the root cause of anything that happened afterwards, so it comes first.
+func abortedCall(panics *panicRecorder, dbState *DBState) error {
+	if panics.err != nil {
+		return *panics.err
+	}
+	return dbState.storeErr
+}
+
 func errorWithMessage(err error, b C.Buffer) error {
+	msg := receiveVector(b)
 	// this checks for out of gas as a special case
 	if errno, ok := err.(syscall.Errno); ok && int(errno) == 2 {
-		return types.OutOfGasError{}
+		return outOfGasError(msg)
 	}
-	msg := receiveVector(b)
 	if msg == nil {
 		return err
 	}
 	return fmt.Errorf("%s", string(msg))
 }
+
+// outOfGasError decodes the outOfGasInfo a callback sent through Rust. If the gas ran out in
+// wasm execution, Rust sends a plain message instead and we return an error without call site.
+func outOfGasError(msg []byte) types.OutOfGasError {
+	var info outOfGasInfo
+	if err := json.Unmarshal(msg, &info); err != nil {
+		return types.OutOfGasError{}
+	}
+	return types.OutOfGasError{
+		Descriptor: info.Descriptor,
+		CallSite:   info.CallSite,
+		Overflow:   info.Overflow,
+	}
+}
+
+// contractError is errorWithMessage for contract calls, which adds the gas numbers to out of gas errors
+func contractError(err error, b C.Buffer, gasLimit uint64, gasUsed u64) error {
+	res := errorWithMessage(err, b)
+	if oog, ok := res.(types.OutOfGasError); ok {
+		oog.GasLimit = gasLimit
+		oog.GasUsed = uint64(gasUsed)
+		return oog
+	}
+	return res
+}
@@ -29,7 +29,7 @@ func TestInitAndReleaseCache(t *testing.T) {
 	ReleaseCache(cache)
 }
 
-func withCache(t *testing.T) (Cache, func()) {
+func withCache(t testing.TB) (Cache, func()) {
 	tmpdir, err := ioutil.TempDir("", "go-cosmwasm")
 	require.NoError(t, err)
 	cache, err := InitCache(tmpdir, DEFAULT_FEATURES, 3)
@@ -214,6 +214,38 @@ func TestHandleCpuLoop(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, cost, maxGas)
 	t.Logf("CPULoop Time (%d gas): %s\n", cost, diff)
+
+	// the gas ran out in wasm, not in a callback
+	oog, ok := err.(types.OutOfGasError)
+	require.True(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, types.OutOfGasError{GasLimit: maxGas, GasUsed: maxGas}, oog)
+}
+
+func TestInstantiateOutOfGasInCallback(t *testing.T) {
+	cache, cleanup := withCache(t)
+	defer cleanup()
+	id := createTestContract(t, cache)
+
+	// the sdk gas meter cannot pay for a single write
+	gasMeter := NewMockGasMeter(SetPrice - 1)
+	igasMeter := GasMeter(gasMeter)
+	store := NewLookup(gasMeter)
+	api := NewMockAPI()
+	querier := DefaultQuerier(mockContractAddr, types.Coins{types.NewCoin(100, "ATOM")})
+	params, err := json.Marshal(mockEnv("creator"))
+	require.NoError(t, err)
+
+	msg := []byte(`{"verifier": "fred", "beneficiary": "bob"}`)
+	gasLimit := uint64(100000000)
+	_, cost, err := Instantiate(cache, id, params, msg, &igasMeter, store, api, &querier, gasLimit)
+	require.Error(t, err)
+	oog, ok := err.(types.OutOfGasError)
+	require.True(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, "db_write", oog.CallSite)
+	assert.Equal(t, "set", oog.Descriptor)
+	assert.False(t, oog.Overflow)
+	assert.Equal(t, gasLimit, oog.GasLimit)
+	assert.Equal(t, cost, oog.GasUsed)
 }
 
 func TestHandleStorageLoop(t *testing.T) {
@@ -393,7 +425,7 @@ func TestMultipleInstances(t *testing.T) {
 	require.Equal(t, "sue", logs[1].Value)
 }
 
-func requireOkResponse(t *testing.T, res []byte, expectedMsgs int) {
+func requireOkResponse(t testing.TB, res []byte, expectedMsgs int) {
 	var resp types.HandleResult
 	err := json.Unmarshal(res, &resp)
 	require.NoError(t, err)
@@ -401,19 +433,19 @@ func requireOkResponse(t *testing.T, res []byte, expectedMsgs int) {
 	require.Equal(t, expectedMsgs, len(resp.Ok.Messages))
 }
 
-func createTestContract(t *testing.T, cache Cache) []byte {
+func createTestContract(t testing.TB, cache Cache) []byte {
 	return createContract(t, cache, "./testdata/hackatom.wasm")
 }
 
-func createQueueContract(t *testing.T, cache Cache) []byte {
+func createQueueContract(t testing.TB, cache Cache) []byte {
 	return createContract(t, cache, "./testdata/queue.wasm")
 }
 
-func createReflectContract(t *testing.T, cache Cache) []byte {
+func createReflectContract(t testing.TB, cache Cache) []byte {
 	return createContract(t, cache, "./testdata/reflect.wasm")
 }
 
-func createContract(t *testing.T, cache Cache, wasmFile string) []byte {
+func createContract(t testing.TB, cache Cache, wasmFile string) []byte {
 	wasm, err := ioutil.ReadFile(wasmFile)
 	require.NoError(t, err)
 	id, err := Create(cache, wasm)
@@ -512,6 +544,40 @@ func TestHackatomQuerier(t *testing.T) {
 	require.Equal(t, balances.Amount, initBalance)
 }
 
+// panickingQuerier simulates a bug in the querier of the host
+type panickingQuerier struct{}
+
+var _ types.Querier = panickingQuerier{}
+
+func (panickingQuerier) Query(request types.QueryRequest, gasLimit uint64) ([]byte, error) {
+	panic("querier bug")
+}
+
+func (panickingQuerier) GasConsumed() uint64 {
+	return 0
+}
+
+func TestQuerierPanic(t *testing.T) {
+	cache, cleanup := withCache(t)
+	defer cleanup()
+	id := createTestContract(t, cache)
+
+	gasMeter := NewMockGasMeter(100000000)
+	igasMeter := GasMeter(gasMeter)
+	store := NewLookup(gasMeter)
+	api := NewMockAPI()
+	querier := Querier(panickingQuerier{})
+
+	query := []byte(`{"other_balance":{"address":"foobar"}}`)
+	_, _, err := Query(cache, id, query, &igasMeter, store, api, &querier, 100000000)
+	require.Error(t, err)
+	panicErr, ok := err.(types.CallbackPanicError)
+	require.True(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, "query_external", panicErr.CallSite)
+	assert.Equal(t, "querier bug", panicErr.Value)
+	assert.Contains(t, string(panicErr.Stack), "panickingQuerier")
+}
+
 func TestCustomReflectQuerier(t *testing.T) {
 	cache, cleanup := withCache(t)
 	defer cleanup()
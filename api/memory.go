@@ -5,7 +5,10 @@ package api
 */
 import "C"
 
-import "unsafe"
+import (
+	"sync"
+	"unsafe"
+)
 
 func allocateRust(data []byte) C.Buffer {
 	var ret C.Buffer
@@ -36,6 +39,30 @@ func allocateRust(data []byte) C.Buffer {
 	return ret
 }
 
+// emptyView is what empty (but not nil) views point to, since Rust reads a null pointer as nil
+var emptyView [1]byte
+
+// makeView borrows the Go memory of s to Rust, without copying. This is only valid for the duration
+// of a synchronous call into Rust, which must not keep the pointer nor free the buffer.
+// The caller must keep s alive until the call returned, i.e. `defer runtime.KeepAlive(s)`.
+//
+// This is allowed by the cgo pointer passing rules, as the memory we point to does not contain Go pointers.
+func makeView(s []byte) C.Buffer {
+	if s == nil {
+		return C.Buffer{ptr: u8_ptr(nil), len: usize(0), cap: usize(0)}
+	}
+	if len(s) == 0 {
+		return C.Buffer{ptr: u8_ptr(unsafe.Pointer(&emptyView[0])), len: usize(0), cap: usize(0)}
+	}
+	return C.Buffer{
+		ptr: u8_ptr(unsafe.Pointer(&s[0])),
+		len: usize(len(s)),
+		cap: usize(len(s)),
+	}
+}
+
+// sendSlice copies s into C memory, which must be freed with freeAfterSend.
+// Prefer makeView unless the data must outlive the Go slice.
 func sendSlice(s []byte) C.Buffer {
 	if s == nil {
 		return C.Buffer{ptr: u8_ptr(nil), len: usize(0), cap: usize(0)}
@@ -70,6 +97,47 @@ func receiveSlice(b C.Buffer) []byte {
 	return res
 }
 
+// viewRustSlice is receiveSlice without copying. The result points to Rust memory, which is only valid
+// until the callback returns, so it must not be stored or passed to code that may keep it (like a KVStore).
+// Use this for data that is decoded right away.
+func viewRustSlice(b C.Buffer) []byte {
+	if bufIsNil(b) {
+		return nil
+	}
+	if b.len == 0 {
+		return []byte{}
+	}
+	// this is the pre Go 1.17 way of creating a slice header for C memory (unsafe.Slice)
+	return (*[1 << 30]byte)(unsafe.Pointer(b.ptr))[:int(b.len):int(b.len)]
+}
+
+// scratchPool holds buffers for building callback results, which are copied to Rust by allocateRust
+// and can be reused afterwards. They are used for iterator batches and query results, which are built piece by piece.
+// Results that already exist, like the values of cGet and cNext or the addresses of the GoAPI,
+// are copied to Rust directly and need no buffer.
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// getScratch returns an empty buffer from the pool. Return it with putScratch once it was sent to Rust.
+func getScratch() *[]byte {
+	return scratchPool.Get().(*[]byte)
+}
+
+// maxScratchSize limits the buffers we keep in the pool, so a single huge result does not stay in memory
+const maxScratchSize = 1 << 20
+
+func putScratch(b *[]byte) {
+	if cap(*b) > maxScratchSize {
+		return
+	}
+	*b = (*b)[:0]
+	scratchPool.Put(b)
+}
+
 func freeAfterSend(b C.Buffer) {
 	if !bufIsNil(b) {
 		C.free(unsafe.Pointer(b.ptr))
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+func TestMakeView(t *testing.T) {
+	// nil stays nil
+	view := makeView(nil)
+	assert.True(t, bufIsNil(view))
+
+	// empty is not nil
+	view = makeView([]byte{})
+	assert.False(t, bufIsNil(view))
+	assert.Equal(t, 0, int(view.len))
+
+	// data is borrowed, not copied
+	data := []byte("some data")
+	view = makeView(data)
+	assert.Equal(t, unsafe.Pointer(&data[0]), unsafe.Pointer(view.ptr))
+	assert.Equal(t, len(data), int(view.len))
+	runtime.KeepAlive(data)
+}
+
+func TestViewRustSlice(t *testing.T) {
+	assert.Nil(t, viewRustSlice(allocateRust(nil)))
+
+	empty := allocateRust([]byte{})
+	assert.Equal(t, []byte{}, viewRustSlice(empty))
+	receiveVector(empty)
+
+	data := []byte("some data")
+	buf := allocateRust(data)
+	view := viewRustSlice(buf)
+	assert.Equal(t, data, view)
+	assert.Equal(t, len(data), cap(view))
+	// the view shares the Rust memory, the copy does not
+	assert.Equal(t, unsafe.Pointer(buf.ptr), unsafe.Pointer(&view[0]))
+	copied := receiveSlice(buf)
+	assert.NotEqual(t, unsafe.Pointer(buf.ptr), unsafe.Pointer(&copied[0]))
+	receiveVector(buf)
+}
+
+func TestScratchPool(t *testing.T) {
+	scratch := getScratch()
+	assert.Equal(t, 0, len(*scratch))
+	*scratch = append(*scratch, "foo"...)
+	putScratch(scratch)
+
+	// we always get an empty buffer
+	scratch = getScratch()
+	assert.Equal(t, 0, len(*scratch))
+	putScratch(scratch)
+
+	// huge buffers are dropped, which must not panic
+	huge := make([]byte, 0, 2*maxScratchSize)
+	putScratch(&huge)
+}
+
+// TestPooledCallbackResults checks that callback results built in pooled buffers are copied to Rust,
+// so a later result does not change an earlier one
+func TestPooledCallbackResults(t *testing.T) {
+	querier := DefaultQuerier("rich", types.Coins{types.NewCoin(1234, "ucosm")})
+	qState := querierState{Querier: querier}
+	q := buildQuerier(&qState)
+	query := func(address string) []byte {
+		request := []byte(`{"bank":{"all_balances":{"address":"` + address + `"}}}`)
+		var usedGas u64
+		result := makeView(nil)
+		errOut := makeView(nil)
+		ret := cQueryExternal(q.state, 100000000, &usedGas, makeView(request), &result, &errOut)
+		require.Equal(t, 0, int(ret))
+		require.True(t, bufIsNil(errOut))
+		return receiveVector(result)
+	}
+	rich := query("rich")
+	poor := query("poor")
+	assert.NotEqual(t, rich, poor)
+	assert.Equal(t, rich, query("rich"))
+}
+
+// TestViewsWithParallelCalls checks that the Go memory we borrow to Rust stays valid while the garbage
+// collector runs. Use `make test-safety` to run it with GODEBUG=cgocheck=2 and the race detector.
+func TestViewsWithParallelCalls(t *testing.T) {
+	cache, cleanup := withCache(t)
+	defer cleanup()
+
+	wasm, err := ioutil.ReadFile("./testdata/hackatom.wasm")
+	require.NoError(t, err)
+	id := createTestContract(t, cache)
+
+	gasMeter := NewMockGasMeter(100000000)
+	igasMeter := GasMeter(gasMeter)
+	store := NewLookup(gasMeter)
+	api := NewMockAPI()
+	querier := DefaultQuerier(mockContractAddr, types.Coins{types.NewCoin(100, "ATOM")})
+	params, err := json.Marshal(mockEnv("creator"))
+	require.NoError(t, err)
+	msg := []byte(`{"verifier": "fred", "beneficiary": "bob"}`)
+	_, _, err = Instantiate(cache, id, params, msg, &igasMeter, store, api, &querier, 100000000)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				runtime.GC()
+			}
+		}
+	}()
+	defer close(done)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				// a large input, which we get back from Rust
+				code := append([]byte{}, wasm...)
+				codeID, err := Create(cache, code)
+				assert.NoError(t, err)
+				stored, err := GetCode(cache, codeID)
+				assert.NoError(t, err)
+				assert.True(t, bytes.Equal(wasm, stored))
+
+				var meter GasMeter = NewMockGasMeter(100000000)
+				data, _, err := Query(cache, id, []byte(`{"verifier":{}}`), &meter, store.WithGasMeter(meter.(MockGasMeter)), api, &querier, 100000000)
+				assert.NoError(t, err)
+				var qres types.QueryResponse
+				assert.NoError(t, json.Unmarshal(data, &qres))
+				assert.Equal(t, `{"verifier":"fred"}`, string(qres.Ok))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkSendSlice(b *testing.B) {
+	data := make([]byte, 64*1024)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		buf := sendSlice(data)
+		freeAfterSend(buf)
+	}
+}
+
+func BenchmarkMakeView(b *testing.B) {
+	data := make([]byte, 64*1024)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		buf := makeView(data)
+		runtime.KeepAlive(buf)
+	}
+	runtime.KeepAlive(data)
+}
+
+func BenchmarkReceiveSlice(b *testing.B) {
+	buf := allocateRust(make([]byte, 64*1024))
+	defer receiveVector(buf)
+	b.SetBytes(int64(buf.len))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.KeepAlive(receiveSlice(buf))
+	}
+}
+
+func BenchmarkViewRustSlice(b *testing.B) {
+	buf := allocateRust(make([]byte, 64*1024))
+	defer receiveVector(buf)
+	b.SetBytes(int64(buf.len))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.KeepAlive(viewRustSlice(buf))
+	}
+}
+
+// BenchmarkCreate sends a large input through the whole stack
+func BenchmarkCreate(b *testing.B) {
+	cache, cleanup := withCache(b)
+	defer cleanup()
+	wasm, err := ioutil.ReadFile("./testdata/hackatom.wasm")
+	require.NoError(b, err)
+	b.SetBytes(int64(len(wasm)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := Create(cache, wasm)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
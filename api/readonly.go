@@ -0,0 +1,62 @@
+package api
+
+import (
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// ReadOnlyStore gives a contract read access to a KVStore, e.g. during a query.
+// The db callbacks reject writes to it before they reach the store, so the contract call fails
+// with a types.WriteInQueryError. Set and Delete panic with the same error in case they are called anyways.
+type ReadOnlyStore struct {
+	store KVStore
+}
+
+var _ KVStore = ReadOnlyStore{}
+
+// readOnly is implemented by stores that reject writes. The db callbacks look for it rather than for
+// a ReadOnlyStore, so a store wrapping one (e.g. to record the accesses) can forward it.
+type readOnly interface {
+	ReadOnly() bool
+}
+
+// IsReadOnly tells if the db callbacks reject writes to store: it is a ReadOnlyStore, or a wrapper of one
+// which forwards ReadOnly. A store wrapping another KVStore should implement ReadOnly as IsReadOnly(inner).
+func IsReadOnly(store KVStore) bool {
+	ro, ok := store.(readOnly)
+	return ok && ro.ReadOnly()
+}
+
+// NewReadOnlyStore wraps store. Wrapping a ReadOnlyStore again returns it unchanged.
+func NewReadOnlyStore(store KVStore) ReadOnlyStore {
+	if ro, ok := store.(ReadOnlyStore); ok {
+		return ro
+	}
+	return ReadOnlyStore{store: store}
+}
+
+// ReadOnly is always true, see IsReadOnly
+func (s ReadOnlyStore) ReadOnly() bool {
+	return true
+}
+
+func (s ReadOnlyStore) Get(key []byte) []byte {
+	return s.store.Get(key)
+}
+
+func (s ReadOnlyStore) Set(key, value []byte) {
+	panic(types.WriteInQueryError{Op: "set", Key: key})
+}
+
+func (s ReadOnlyStore) Delete(key []byte) {
+	panic(types.WriteInQueryError{Op: "delete", Key: key})
+}
+
+func (s ReadOnlyStore) Iterator(start, end []byte) dbm.Iterator {
+	return s.store.Iterator(start, end)
+}
+
+func (s ReadOnlyStore) ReverseIterator(start, end []byte) dbm.Iterator {
+	return s.store.ReverseIterator(start, end)
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// goResultReadOnly is GoResult_ReadOnly of bindings.h, which cgo does not let us use in tests
+const goResultReadOnly = 6
+
+// forwardingStore wraps a store like the replay recorder does, and forwards ReadOnly
+type forwardingStore struct {
+	KVStore
+}
+
+func (s forwardingStore) ReadOnly() bool {
+	return IsReadOnly(s.KVStore)
+}
+
+func TestReadOnlyStoreRejectsWrites(t *testing.T) {
+	cases := map[string]func(KVStore) KVStore{
+		"read-only store": func(store KVStore) KVStore {
+			return NewReadOnlyStore(store)
+		},
+		"wrapped read-only store": func(store KVStore) KVStore {
+			return forwardingStore{NewReadOnlyStore(store)}
+		},
+	}
+	for name, wrap := range cases {
+		t.Run(name, func(t *testing.T) {
+			gasMeter := NewMockGasMeter(100000000)
+			igasMeter := GasMeter(gasMeter)
+			store := NewLookup(gasMeter)
+			store.Set([]byte("foo"), []byte("bar"))
+
+			var panics panicRecorder
+			state := buildDBState(wrap(store), &panics)
+			defer endContract(&state)
+			db := buildDB(&state, &igasMeter)
+
+			key := []byte("foo")
+			val := []byte("changed")
+			var usedGas u64
+			errOut := makeView(nil)
+			ret := cSet(db.state, db.gas_meter, &usedGas, makeView(key), makeView(val), &errOut)
+			assert.Equal(t, goResultReadOnly, int(ret))
+			assert.Equal(t, "contract tried to set key 666F6F in a read-only query", string(receiveVector(errOut)))
+			assert.Equal(t, types.WriteInQueryError{Op: "set", Key: key}, state.storeErr)
+
+			errOut = makeView(nil)
+			ret = cDelete(db.state, db.gas_meter, &usedGas, makeView(key), &errOut)
+			assert.Equal(t, goResultReadOnly, int(ret))
+			// the message is still the one of the first rejected write
+			assert.Equal(t, "contract tried to set key 666F6F in a read-only query", string(receiveVector(errOut)))
+			assert.Equal(t, types.WriteInQueryError{Op: "set", Key: key}, abortedCall(&panics, &state))
+
+			// nothing reached the store, the rejected writes were no panics and reads still work
+			assert.Nil(t, panics.err)
+			assert.Equal(t, []byte("bar"), store.Get(key))
+			value := makeView(nil)
+			errOut = makeView(nil)
+			ret = cGet(db.state, db.gas_meter, &usedGas, makeView(key), &value, &errOut)
+			assert.Equal(t, 0, int(ret))
+			assert.Equal(t, []byte("bar"), receiveVector(value))
+		})
+	}
+}
+
+func TestReadOnlyStoreDeleteRejected(t *testing.T) {
+	gasMeter := NewMockGasMeter(100000000)
+	igasMeter := GasMeter(gasMeter)
+	store := NewLookup(gasMeter)
+	store.Set([]byte("foo"), []byte("bar"))
+
+	var panics panicRecorder
+	state := buildDBState(forwardingStore{NewReadOnlyStore(store)}, &panics)
+	defer endContract(&state)
+	db := buildDB(&state, &igasMeter)
+
+	var usedGas u64
+	errOut := makeView(nil)
+	ret := cDelete(db.state, db.gas_meter, &usedGas, makeView([]byte("foo")), &errOut)
+	assert.Equal(t, goResultReadOnly, int(ret))
+	assert.Equal(t, "contract tried to delete key 666F6F in a read-only query", string(receiveVector(errOut)))
+	assert.Equal(t, types.WriteInQueryError{Op: "delete", Key: []byte("foo")}, abortedCall(&panics, &state))
+	assert.Equal(t, []byte("bar"), store.Get([]byte("foo")))
+}
+
+func TestIsReadOnly(t *testing.T) {
+	store := NewLookup(NewMockGasMeter(100000000))
+	assert.False(t, IsReadOnly(store))
+	assert.True(t, IsReadOnly(NewReadOnlyStore(store)))
+	assert.True(t, IsReadOnly(forwardingStore{NewReadOnlyStore(store)}))
+	assert.False(t, IsReadOnly(forwardingStore{store}))
+}
+
+func TestReadOnlyStorePanicsOnDirectWrites(t *testing.T) {
+	store := NewLookup(NewMockGasMeter(100000000))
+	ro := NewReadOnlyStore(store)
+	assert.Equal(t, ro, NewReadOnlyStore(ro))
+	assert.PanicsWithError(t, "contract tried to set key 666F6F in a read-only query", func() {
+		ro.Set([]byte("foo"), []byte("bar"))
+	})
+	assert.PanicsWithError(t, "contract tried to delete key 666F6F in a read-only query", func() {
+		ro.Delete([]byte("foo"))
+	})
+	assert.Nil(t, store.Get([]byte("foo")))
+}
+
+// TestVMRefusesWriteInQuery runs a contract that writes in a query on a store that accepts writes.
+// cosmwasm-vm 0.10 refuses the write itself, before any callback runs, so this only tests the guard of the VM.
+// It does not cover ReadOnlyStore, which TestReadOnlyStoreRejectsWrites does for the callbacks.
+func TestVMRefusesWriteInQuery(t *testing.T) {
+	cache, cleanup := withCache(t)
+	defer cleanup()
+	id, err := Create(cache, writeInQueryContract())
+	require.NoError(t, err)
+
+	gasMeter := NewMockGasMeter(100000000)
+	igasMeter := GasMeter(gasMeter)
+	store := NewLookup(gasMeter)
+	api := NewMockAPI()
+	querier := DefaultQuerier(mockContractAddr, nil)
+
+	_, _, err = Query(cache, id, []byte(`{}`), &igasMeter, store, api, &querier, 100000000)
+	require.Error(t, err)
+	// not a WriteInQueryError, which only the callbacks return
+	var writeErr types.WriteInQueryError
+	assert.False(t, errors.As(err, &writeErr))
+	assert.Nil(t, store.Get([]byte("malicious")))
+}
+
+// writeInQueryContract assembles a minimal contract (interface version 3), which writes to the storage in its
+// query entry point. None of our test contracts does this, as cosmwasm-std does not allow it.
+//
+//	(module
+//	  (import "env" "db_write" (func $db_write (param i32 i32)))
+//	  (memory (export "memory") 1)
+//	  (global $heap (mut i32) (i32.const 4096))
+//	  ;; bump allocator, never frees
+//	  (func (export "allocate") (param $size i32) (result i32) (local $region i32)
+//	    (local.set $region (global.get $heap))
+//	    (global.set $heap (i32.add (i32.add (global.get $heap) (i32.const 12)) (local.get $size)))
+//	    (i32.store (local.get $region) (i32.add (local.get $region) (i32.const 12)))
+//	    (i32.store offset=4 (local.get $region) (local.get $size))
+//	    (i32.store offset=8 (local.get $region) (i32.const 0))
+//	    (local.get $region))
+//	  (func (export "deallocate") (param i32))
+//	  (func (export "query") (param i32) (result i32)
+//	    (call $db_write (i32.const 16) (i32.const 28))
+//	    (i32.const 40))
+//	  (func (export "init") (param i32 i32) (result i32) (i32.const 0))
+//	  (func (export "handle") (param i32 i32) (result i32) (i32.const 0))
+//	  (func (export "cosmwasm_vm_version_3"))
+//	  ;; regions at 16 (key), 28 (value) and 40 (query result)
+//	  (data (i32.const 0) ...))
+func writeInQueryContract() []byte {
+	const (
+		valI32   = 0x7f
+		keyPtr   = 100
+		valuePtr = 120
+		resPtr   = 140
+	)
+	key := []byte("malicious")
+	value := []byte("write")
+	result := []byte(`{"Ok":"e30="}`)
+
+	memory := make([]byte, resPtr+len(result))
+	region := func(at int, offset int, data []byte) {
+		binary.LittleEndian.PutUint32(memory[at:], uint32(offset))
+		binary.LittleEndian.PutUint32(memory[at+4:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(memory[at+8:], uint32(len(data)))
+		copy(memory[offset:], data)
+	}
+	region(16, keyPtr, key)
+	region(28, valuePtr, value)
+	region(40, resPtr, result)
+
+	funcType := func(params, results []byte) []byte {
+		return cat([]byte{0x60}, wasmVec(len(params), params), wasmVec(len(results), results))
+	}
+	export := func(name string, kind byte, idx byte) []byte {
+		return cat(wasmName(name), []byte{kind, idx})
+	}
+	body := func(locals []byte, code ...byte) []byte {
+		b := cat(locals, code)
+		return cat(uleb(uint32(len(b))), b)
+	}
+	noLocals := []byte{0x00}
+
+	return cat(
+		[]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00},
+		// types: 0 (i32)->i32, 1 (i32)->(), 2 (i32,i32)->i32, 3 (i32,i32)->(), 4 ()->()
+		wasmSection(1, 5,
+			funcType([]byte{valI32}, []byte{valI32}),
+			funcType([]byte{valI32}, nil),
+			funcType([]byte{valI32, valI32}, []byte{valI32}),
+			funcType([]byte{valI32, valI32}, nil),
+			funcType(nil, nil),
+		),
+		// imports: function 0
+		wasmSection(2, 1, cat(wasmName("env"), wasmName("db_write"), []byte{0x00, 3})),
+		// functions 1 to 6
+		wasmSection(3, 6, []byte{0, 1, 0, 2, 2, 4}),
+		// memory with 1 page and no maximum
+		wasmSection(5, 1, []byte{0x00, 0x01}),
+		// global $heap
+		wasmSection(6, 1, []byte{valI32, 0x01, 0x41, 0x80, 0x20, 0x0b}),
+		wasmSection(7, 7,
+			export("memory", 0x02, 0),
+			export("allocate", 0x00, 1),
+			export("deallocate", 0x00, 2),
+			export("query", 0x00, 3),
+			export("init", 0x00, 4),
+			export("handle", 0x00, 5),
+			export("cosmwasm_vm_version_3", 0x00, 6),
+		),
+		wasmSection(10, 6,
+			body([]byte{0x01, 0x01, valI32},
+				0x23, 0x00, 0x21, 0x01,
+				0x23, 0x00, 0x41, 0x0c, 0x6a, 0x20, 0x00, 0x6a, 0x24, 0x00,
+				0x20, 0x01, 0x20, 0x01, 0x41, 0x0c, 0x6a, 0x36, 0x02, 0x00,
+				0x20, 0x01, 0x20, 0x00, 0x36, 0x02, 0x04,
+				0x20, 0x01, 0x41, 0x00, 0x36, 0x02, 0x08,
+				0x20, 0x01, 0x0b),
+			body(noLocals, 0x0b),
+			body(noLocals, 0x41, 16, 0x41, 28, 0x10, 0x00, 0x41, 40, 0x0b),
+			body(noLocals, 0x41, 0x00, 0x0b),
+			body(noLocals, 0x41, 0x00, 0x0b),
+			body(noLocals, 0x0b),
+		),
+		wasmSection(11, 1, cat([]byte{0x00, 0x41, 0x00, 0x0b}, wasmVec(len(memory), memory))),
+	)
+}
+
+func wasmSection(id byte, count int, items ...[]byte) []byte {
+	contents := wasmVec(count, items...)
+	return cat([]byte{id}, uleb(uint32(len(contents))), contents)
+}
+
+func wasmVec(count int, items ...[]byte) []byte {
+	return cat(uleb(uint32(count)), cat(items...))
+}
+
+func wasmName(name string) []byte {
+	return wasmVec(len(name), []byte(name))
+}
+
+func uleb(n uint32) []byte {
+	var res []byte
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(res, b)
+		}
+		res = append(res, b|0x80)
+	}
+}
+
+func cat(parts ...[]byte) []byte {
+	var res []byte
+	for _, p := range parts {
+		res = append(res, p...)
+	}
+	return res
+}
@@ -0,0 +1,171 @@
+// Package bech32 implements the bech32 address format (BIP-173) used by Cosmos SDK chains,
+// e.g. terra1x46rqay4d3cssq8gxxvqz8xt6nwlz4td20k38v.
+package bech32
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// MaxLength is the maximum length of a bech32 string
+const MaxLength = 90
+
+var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+var ErrInvalidChecksum = errors.New("invalid checksum")
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	res := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		res = append(res, hrp[i]>>5)
+	}
+	res = append(res, 0)
+	for i := 0; i < len(hrp); i++ {
+		res = append(res, hrp[i]&31)
+	}
+	return res
+}
+
+func checksum(hrp string, data []byte) []byte {
+	values := append(hrpExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := polymod(values) ^ 1
+	res := make([]byte, 6)
+	for i := range res {
+		res[i] = byte(mod>>uint(5*(5-i))) & 31
+	}
+	return res
+}
+
+// Encode encodes 5 bit groups (see ConvertBits) with the human readable part hrp
+func Encode(hrp string, data []byte) (string, error) {
+	if len(hrp) == 0 {
+		return "", errors.New("empty human readable part")
+	}
+	if len(hrp)+len(data)+7 > MaxLength {
+		return "", fmt.Errorf("encoding exceeds %d characters", MaxLength)
+	}
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", fmt.Errorf("invalid character in human readable part: %q", hrp[i])
+		}
+	}
+	hrp = strings.ToLower(hrp)
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range data {
+		if v > 31 {
+			return "", fmt.Errorf("invalid data value %d", v)
+		}
+		sb.WriteByte(charset[v])
+	}
+	for _, v := range checksum(hrp, data) {
+		sb.WriteByte(charset[v])
+	}
+	return sb.String(), nil
+}
+
+// Decode returns the human readable part (in lower case) and the 5 bit groups of a bech32 string.
+// Mixed case strings are invalid.
+func Decode(s string) (string, []byte, error) {
+	if len(s) > MaxLength {
+		return "", nil, fmt.Errorf("exceeds %d characters", MaxLength)
+	}
+	lower := strings.ToLower(s)
+	if lower != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	sep := strings.LastIndexByte(lower, '1')
+	if sep < 1 {
+		return "", nil, errors.New("missing human readable part")
+	}
+	if sep+7 > len(lower) {
+		return "", nil, errors.New("too short checksum")
+	}
+	hrp := lower[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("invalid character in human readable part: %q", hrp[i])
+		}
+	}
+	data := make([]byte, 0, len(lower)-sep-1)
+	for i := sep + 1; i < len(lower); i++ {
+		v := strings.IndexByte(charset, lower[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character in data part: %q", lower[i])
+		}
+		data = append(data, byte(v))
+	}
+	if polymod(append(hrpExpand(hrp), data...)) != 1 {
+		return "", nil, ErrInvalidChecksum
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+// ConvertBits regroups data from groups of fromBits to groups of toBits. Bytes are converted to 5 bit groups
+// with padding before encoding, and back without padding after decoding.
+func ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	res := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, fmt.Errorf("invalid data value %d", v)
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			res = append(res, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			res = append(res, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return res, nil
+}
+
+// EncodeBytes encodes bytes (e.g. a canonical address) with the human readable part hrp
+func EncodeBytes(hrp string, data []byte) (string, error) {
+	converted, err := ConvertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return Encode(hrp, converted)
+}
+
+// DecodeBytes is the inverse of EncodeBytes
+func DecodeBytes(s string) (string, []byte, error) {
+	hrp, data, err := Decode(s)
+	if err != nil {
+		return "", nil, err
+	}
+	converted, err := ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, converted, nil
+}
@@ -0,0 +1,75 @@
+package bech32
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// test vectors from BIP-173
+func TestValidChecksums(t *testing.T) {
+	valid := []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	}
+	for _, s := range valid {
+		hrp, data, err := Decode(s)
+		require.NoError(t, err, s)
+		encoded, err := Encode(hrp, data)
+		require.NoError(t, err, s)
+		assert.Equal(t, strings.ToLower(s), encoded)
+	}
+}
+
+func TestInvalidStrings(t *testing.T) {
+	invalid := map[string]string{
+		"pzry9x0s0muk":  "no separator",
+		"1pzry9x0s0muk": "empty hrp",
+		"x1b4n0q5v":     "invalid data character",
+		"li1dgmt3":      "too short checksum",
+		"A1G7SGD8":      "checksum calculated with uppercase hrp",
+		"10a06t8":       "empty hrp",
+		"1qzzfhee":      "empty hrp",
+		"a12UEL5L":      "mixed case",
+		"\x201nwldj5":   "hrp character out of range",
+		"a12uel5m":      "wrong checksum",
+		"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx": "overall max length exceeded",
+	}
+	for s, reason := range invalid {
+		_, _, err := Decode(s)
+		assert.Error(t, err, reason)
+	}
+	_, _, err := Decode("a12uel5m")
+	assert.Equal(t, ErrInvalidChecksum, err)
+}
+
+func TestBytes(t *testing.T) {
+	// a segwit address encodes a version byte before the program, which we skip here
+	hrp, data, err := Decode("BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4")
+	require.NoError(t, err)
+	assert.Equal(t, "bc", hrp)
+	program, err := ConvertBits(data[1:], 5, 8, false)
+	require.NoError(t, err)
+	assert.Equal(t, "751e76e8199196d454941c45d1b3a323f1433bd6", hex.EncodeToString(program))
+
+	addr := "terra1x46rqay4d3cssq8gxxvqz8xt6nwlz4td20k38v"
+	hrp, canon, err := DecodeBytes(addr)
+	require.NoError(t, err)
+	assert.Equal(t, "terra", hrp)
+	assert.Equal(t, 20, len(canon))
+	encoded, err := EncodeBytes("terra", canon)
+	require.NoError(t, err)
+	assert.Equal(t, addr, encoded)
+
+	// non-zero padding
+	_, err = ConvertBits([]byte{31}, 5, 8, false)
+	assert.Error(t, err)
+}
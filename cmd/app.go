@@ -0,0 +1,439 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	dbm "github.com/tendermint/tm-db"
+
+	wasm "github.com/CosmWasm/go-cosmwasm"
+	"github.com/CosmWasm/go-cosmwasm/api"
+	"github.com/CosmWasm/go-cosmwasm/bech32"
+	"github.com/CosmWasm/go-cosmwasm/dispatch"
+	"github.com/CosmWasm/go-cosmwasm/querier"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// app runs contracts against the local state. A command opens one app, runs its calls and commits
+// if all of them succeeded. Nothing is written otherwise.
+type app struct {
+	home   string
+	vm     *vmOptions
+	wasmer *wasm.Wasmer
+	api    wasm.GoAPI
+	state  *chainState
+	stores *contractStores
+	meter  *gasMeter
+	stats  accessStats
+	block  types.BlockInfo
+
+	// gasUsed is the VM gas used by all calls of the command, which share the gas limit
+	gasUsed uint64
+	// tempHome is removed by close, it is set for apps that only live in memory
+	tempHome string
+}
+
+func openApp(home *homeOptions, vm *vmOptions) (*app, error) {
+	if err := ensureHome(home.home); err != nil {
+		return nil, err
+	}
+	state, err := loadChainState(home.home)
+	if err != nil {
+		return nil, err
+	}
+	wasmer, err := wasm.NewWasmer(filepath.Join(home.home, wasmDir), vm.features, vm.cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range state.Codes {
+		if id, err := hex.DecodeString(code.Checksum); err == nil && code.InterfaceVersion != types.InterfaceVersionUnknown {
+			wasmer.SetInterfaceVersion(id, code.InterfaceVersion)
+		}
+	}
+	config := api.DefaultBech32Config()
+	config.Prefix = vm.prefix
+	config.AddressLengths = []int{20, 32}
+	return &app{
+		home:   home.home,
+		vm:     vm,
+		wasmer: wasmer,
+		api:    api.NewBech32API(config),
+		state:  state,
+		stores: newContractStores(home.home),
+		meter:  &gasMeter{},
+	}, nil
+}
+
+// openMemoryApp opens an app on a fresh state that only lives in memory.
+// The Wasmer still needs a directory, which is removed by close.
+func openMemoryApp(vm *vmOptions) (*app, error) {
+	dir, err := ioutil.TempDir("", "wasmcli")
+	if err != nil {
+		return nil, err
+	}
+	a, err := openApp(&homeOptions{home: dir}, vm)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	a.stores = newMemoryStores()
+	a.tempHome = dir
+	return a, nil
+}
+
+func (a *app) close() {
+	a.wasmer.Cleanup()
+	if a.tempHome != "" {
+		os.RemoveAll(a.tempHome)
+	}
+}
+
+// commit writes the contract storage and the state
+func (a *app) commit() error {
+	if err := a.stores.commit(); err != nil {
+		return err
+	}
+	return a.state.save(a.home)
+}
+
+// snapshot copies the chain state and the contract storage, the returned function restores them
+func (a *app) snapshot() (func() error, error) {
+	bz, err := json.Marshal(a.state)
+	if err != nil {
+		return nil, err
+	}
+	stores := make(map[string]*dbm.MemDB, len(a.stores.working))
+	for addr, db := range a.stores.working {
+		cp, err := copyMemDB(db)
+		if err != nil {
+			return nil, err
+		}
+		stores[addr] = cp
+	}
+	return func() error {
+		state := &chainState{}
+		if err := json.Unmarshal(bz, state); err != nil {
+			return err
+		}
+		if state.Contracts == nil {
+			state.Contracts = make(map[string]*contractInfo)
+		}
+		if state.Balances == nil {
+			state.Balances = make(map[string]types.Coins)
+		}
+		*a.state = *state
+		a.stores.working = stores
+		return nil
+	}, nil
+}
+
+// validateAddress checks that addr is a bech32 address with our prefix
+func (a *app) validateAddress(addr string) error {
+	_, _, err := a.api.CanonicalAddress(addr)
+	return err
+}
+
+func (a *app) gasLeft() uint64 {
+	if a.gasUsed >= a.vm.gasLimit {
+		return 0
+	}
+	return a.vm.gasLimit - a.gasUsed
+}
+
+func (a *app) store(creator string, code []byte) (*codeInfo, error) {
+	id, err := a.wasmer.Create(code)
+	if err != nil {
+		return nil, err
+	}
+	// Create remembered it, so this does not read the wasm
+	version, err := a.wasmer.GetInterfaceVersion(id)
+	if err != nil {
+		return nil, err
+	}
+	checksum := hex.EncodeToString(id)
+	for i := range a.state.Codes {
+		if a.state.Codes[i].Checksum == checksum {
+			a.state.Codes[i].InterfaceVersion = version
+			return &a.state.Codes[i], nil
+		}
+	}
+	info := codeInfo{
+		ID:               uint64(len(a.state.Codes) + 1),
+		Checksum:         checksum,
+		InterfaceVersion: version,
+		Creator:          creator,
+	}
+	a.state.Codes = append(a.state.Codes, info)
+	return &info, nil
+}
+
+func (a *app) codeID(id uint64) (wasm.CodeID, error) {
+	info, err := a.state.code(id)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(info.Checksum)
+}
+
+// contractStore returns the storage of a contract for one call
+func (a *app) contractStore(addr string) (wasm.KVStore, error) {
+	db, err := a.stores.get(addr)
+	if err != nil {
+		return nil, err
+	}
+	return gasStore{db: db, meter: a.meter, stats: &a.stats}, nil
+}
+
+// querier returns the querier for a contract call with the given call stack
+func (a *app) querier(stack types.CallStack) *querier.QueryRouter {
+	router := querier.NewQueryRouter(a.meter, 0)
+	router.Bank = bankQuerier{state: a.state, stats: &a.stats}
+	router.Wasm = wasmQuerier{app: a}
+	router.Stack = stack
+	return router
+}
+
+func (a *app) env(sender string, funds types.Coins, contract string) types.Env {
+	return types.Env{
+		Block: a.block,
+		Message: types.MessageInfo{
+			Sender:    sender,
+			SentFunds: funds,
+		},
+		Contract: types.ContractInfo{Address: contract},
+	}
+}
+
+// newContractAddress derives the address of the next contract from a sequence
+func (a *app) newContractAddress() (string, error) {
+	a.state.ContractSeq++
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], a.state.ContractSeq)
+	hash := sha256.Sum256(append([]byte("wasmcli/contract"), seq[:]...))
+	return bech32.EncodeBytes(a.vm.prefix, hash[:20])
+}
+
+// callResult is what the commands print for a contract call
+type callResult struct {
+	Contract   string               `json:"contract,omitempty"`
+	Data       []byte               `json:"data,omitempty"`
+	Log        []types.LogAttribute `json:"log,omitempty"`
+	Messages   []types.CosmosMsg    `json:"messages,omitempty"`
+	Events     []dispatch.Event     `json:"events,omitempty"`
+	GasUsed    uint64               `json:"gas_used"`
+	StorageGas uint64               `json:"storage_gas"`
+}
+
+// newCallResult returns the result of a call of contract. The events of the contract come before
+// those of its dispatched messages.
+func newCallResult(contract string, res *types.Response, events []dispatch.Event) *callResult {
+	return &callResult{
+		Contract: contract,
+		Data:     res.Data,
+		Log:      res.Log,
+		Messages: res.Messages,
+		Events:   append(res.Events, events...),
+	}
+}
+
+func (a *app) instantiate(codeID uint64, sender string, funds types.Coins, msg []byte, label string, admin string) (*callResult, error) {
+	id, err := a.codeID(codeID)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := a.newContractAddress()
+	if err != nil {
+		return nil, err
+	}
+	a.state.Contracts[addr] = &contractInfo{
+		Address: addr,
+		CodeID:  codeID,
+		Creator: sender,
+		Admin:   admin,
+		Label:   label,
+	}
+	if err := a.state.transfer(sender, addr, funds); err != nil {
+		return nil, err
+	}
+	store, err := a.contractStore(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	res, gasUsed, err := a.wasmer.Instantiate(id, a.env(sender, funds, addr), msg, store, a.api, a.querier(nil), a.meter, a.gasLeft())
+	a.gasUsed += gasUsed
+	if err != nil {
+		return nil, fmt.Errorf("instantiating code %d: %w", codeID, err)
+	}
+	events, err := a.dispatch(addr, res.Messages)
+	if err != nil {
+		return nil, err
+	}
+	return newCallResult(addr, res, events), nil
+}
+
+func (a *app) execute(addr string, sender string, funds types.Coins, msg []byte) (*callResult, error) {
+	contract, err := a.state.contract(addr)
+	if err != nil {
+		return nil, err
+	}
+	id, err := a.codeID(contract.CodeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.state.transfer(sender, addr, funds); err != nil {
+		return nil, err
+	}
+	store, err := a.contractStore(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	res, gasUsed, err := a.wasmer.Execute(id, a.env(sender, funds, addr), msg, store, a.api, a.querier(nil), a.meter, a.gasLeft())
+	a.gasUsed += gasUsed
+	if err != nil {
+		return nil, fmt.Errorf("executing %s: %w", addr, err)
+	}
+	events, err := a.dispatch(addr, res.Messages)
+	if err != nil {
+		return nil, err
+	}
+	return newCallResult(addr, res, events), nil
+}
+
+func (a *app) migrate(addr string, sender string, codeID uint64, msg []byte) (*callResult, error) {
+	contract, err := a.state.contract(addr)
+	if err != nil {
+		return nil, err
+	}
+	if contract.Admin == "" || contract.Admin != sender {
+		return nil, fmt.Errorf("%s is not the admin of %s", sender, addr)
+	}
+	id, err := a.codeID(codeID)
+	if err != nil {
+		return nil, err
+	}
+	store, err := a.contractStore(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	res, gasUsed, err := a.wasmer.Migrate(id, a.env(sender, nil, addr), msg, store, a.api, a.querier(nil), a.meter, a.gasLeft())
+	a.gasUsed += gasUsed
+	if err != nil {
+		return nil, fmt.Errorf("migrating %s to code %d: %w", addr, codeID, err)
+	}
+	contract.CodeID = codeID
+	events, err := a.dispatch(addr, res.Messages)
+	if err != nil {
+		return nil, err
+	}
+	return newCallResult(addr, res, events), nil
+}
+
+// query runs a smart query. stack is the call stack of the querying contract, empty for queries from the command line.
+func (a *app) query(addr string, msg []byte, gasLimit uint64, stack types.CallStack) ([]byte, error) {
+	contract, err := a.state.contract(addr)
+	if err != nil {
+		return nil, err
+	}
+	id, err := a.codeID(contract.CodeID)
+	if err != nil {
+		return nil, err
+	}
+	store, err := a.contractStore(addr)
+	if err != nil {
+		return nil, err
+	}
+	res, gasUsed, err := a.wasmer.Query(id, msg, store, a.api, a.querier(stack), a.meter, gasLimit)
+	if stack.Depth() == 0 {
+		// nested queries are part of the gas of the querying contract
+		a.gasUsed += gasUsed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", addr, err)
+	}
+	return res, nil
+}
+
+// dispatch runs the messages returned by a contract. Bank sends move coins of the mock bank,
+// wasm messages call the local contracts. Everything else fails the command, as a chain would.
+func (a *app) dispatch(contract string, msgs []types.CosmosMsg) ([]dispatch.Event, error) {
+	d := dispatch.NewDispatcher().
+		HandleSend(func(ctx dispatch.Context, contract types.HumanAddress, msg *types.SendMsg) ([]dispatch.Event, error) {
+			if msg.FromAddress != contract {
+				return nil, fmt.Errorf("contract %s cannot send from %s", contract, msg.FromAddress)
+			}
+			if err := a.state.transfer(msg.FromAddress, msg.ToAddress, msg.Amount); err != nil {
+				return nil, err
+			}
+			return []dispatch.Event{{Type: "transfer", Attributes: []types.LogAttribute{
+				{Key: "sender", Value: msg.FromAddress},
+				{Key: "recipient", Value: msg.ToAddress},
+				{Key: "amount", Value: formatCoins(msg.Amount)},
+			}}}, nil
+		}).
+		HandleExecute(func(ctx dispatch.Context, contract types.HumanAddress, msg *types.ExecuteMsg) ([]dispatch.Event, error) {
+			res, err := a.execute(msg.ContractAddr, contract, msg.Send, msg.Msg)
+			if err != nil {
+				return nil, err
+			}
+			return append([]dispatch.Event{{Type: "execute", Attributes: []types.LogAttribute{
+				{Key: "contract_address", Value: msg.ContractAddr},
+			}}}, res.Events...), nil
+		}).
+		HandleInstantiate(func(ctx dispatch.Context, contract types.HumanAddress, msg *types.InstantiateMsg) ([]dispatch.Event, error) {
+			res, err := a.instantiate(msg.CodeID, contract, msg.Send, msg.Msg, "", "")
+			if err != nil {
+				return nil, err
+			}
+			return append([]dispatch.Event{{Type: "instantiate", Attributes: []types.LogAttribute{
+				{Key: "code_id", Value: fmt.Sprint(msg.CodeID)},
+				{Key: "contract_address", Value: res.Contract},
+			}}}, res.Events...), nil
+		})
+	return d.Dispatch(nil, contract, msgs)
+}
+
+// wasmQuerier answers queries of contracts to other local contracts
+type wasmQuerier struct {
+	app *app
+}
+
+var _ querier.WasmQuerier = wasmQuerier{}
+
+func (q wasmQuerier) Query(request *types.WasmQuery, gasLimit uint64, stack types.CallStack) ([]byte, error) {
+	q.app.stats.Queries++
+	switch {
+	case request.Smart != nil:
+		if _, err := q.app.state.contract(request.Smart.ContractAddr); err != nil {
+			return nil, types.NoSuchContract{Addr: request.Smart.ContractAddr}
+		}
+		return q.app.query(request.Smart.ContractAddr, request.Smart.Msg, gasLimit, stack)
+	case request.Raw != nil:
+		if _, err := q.app.state.contract(request.Raw.ContractAddr); err != nil {
+			return nil, types.NoSuchContract{Addr: request.Raw.ContractAddr}
+		}
+		store, err := q.app.contractStore(request.Raw.ContractAddr)
+		if err != nil {
+			return nil, err
+		}
+		return store.Get(request.Raw.Key), nil
+	default:
+		return nil, types.UnsupportedRequest{Kind: "wasm"}
+	}
+}
+
+// marshalResult is used for results that are JSON, so they are printed as JSON rather than base64
+func marshalResult(data []byte) interface{} {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	return data
+}
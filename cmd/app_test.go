@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/bech32"
+	"github.com/CosmWasm/go-cosmwasm/dispatch"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+func testVMOptions() *vmOptions {
+	return &vmOptions{features: "staking", prefix: "terra", gasLimit: 100_000_000}
+}
+
+func openTestApp(t *testing.T) *app {
+	a, err := openMemoryApp(testVMOptions())
+	require.NoError(t, err)
+	t.Cleanup(a.close)
+	return a
+}
+
+// testAddress returns a valid address of the test app for name
+func testAddress(t *testing.T, name string) string {
+	raw := make([]byte, 20)
+	copy(raw, name)
+	addr, err := bech32.EncodeBytes("terra", raw)
+	require.NoError(t, err)
+	return addr
+}
+
+func TestNewContractAddress(t *testing.T) {
+	a := openTestApp(t)
+	seen := make(map[string]bool)
+	for i := uint64(1); i <= 3; i++ {
+		addr, err := a.newContractAddress()
+		require.NoError(t, err)
+		assert.Equal(t, i, a.state.ContractSeq)
+		require.NoError(t, a.validateAddress(addr))
+		assert.False(t, seen[addr], "%s is used twice", addr)
+		seen[addr] = true
+	}
+
+	// the address only depends on the sequence, so it is the same on every machine
+	other := openTestApp(t)
+	addr, err := other.newContractAddress()
+	require.NoError(t, err)
+	assert.True(t, seen[addr])
+
+	other.vm.prefix = "cosmos"
+	other.state.ContractSeq = 0
+	cosmosAddr, err := other.newContractAddress()
+	require.NoError(t, err)
+	hrp, _, err := bech32.DecodeBytes(cosmosAddr)
+	require.NoError(t, err)
+	assert.Equal(t, "cosmos", hrp)
+}
+
+func TestOpenAppSetsInterfaceVersions(t *testing.T) {
+	home := tempHome(t)
+	// the code is only in the state, so the Wasmer cannot read its wasm
+	checksum := strings.Repeat("ab", 32)
+	state := &chainState{Codes: []codeInfo{{ID: 1, Checksum: checksum, InterfaceVersion: types.InterfaceVersion4}}}
+	require.NoError(t, state.save(home))
+
+	a, err := openApp(&homeOptions{home: home}, testVMOptions())
+	require.NoError(t, err)
+	defer a.close()
+	id, err := a.codeID(1)
+	require.NoError(t, err)
+	version, err := a.wasmer.GetInterfaceVersion(id)
+	require.NoError(t, err)
+	assert.Equal(t, types.InterfaceVersion4, version)
+}
+
+func TestDispatch(t *testing.T) {
+	contract := testAddress(t, "contract")
+	alice := testAddress(t, "alice")
+	send := func(from string, amount types.Coins) types.CosmosMsg {
+		return types.CosmosMsg{Bank: &types.BankMsg{Send: &types.SendMsg{FromAddress: from, ToAddress: alice, Amount: amount}}}
+	}
+
+	cases := map[string]struct {
+		msgs     []types.CosmosMsg
+		events   []dispatch.Event
+		balances map[string]types.Coins
+		err      string
+	}{
+		"nothing": {
+			msgs:     nil,
+			events:   nil,
+			balances: map[string]types.Coins{contract: {types.NewCoin(100, "uluna")}},
+		},
+		"bank send": {
+			msgs: []types.CosmosMsg{send(contract, types.Coins{types.NewCoin(30, "uluna")})},
+			events: []dispatch.Event{{Type: "transfer", Attributes: []types.LogAttribute{
+				{Key: "sender", Value: contract},
+				{Key: "recipient", Value: alice},
+				{Key: "amount", Value: "30uluna"},
+			}}},
+			balances: map[string]types.Coins{
+				contract: {types.NewCoin(70, "uluna")},
+				alice:    {types.NewCoin(30, "uluna")},
+			},
+		},
+		"send from another account": {
+			msgs: []types.CosmosMsg{send(alice, types.Coins{types.NewCoin(30, "uluna")})},
+			err:  "dispatching message 0: contract " + contract + " cannot send from " + alice,
+		},
+		"send too much": {
+			msgs: []types.CosmosMsg{send(contract, types.Coins{types.NewCoin(101, "uluna")})},
+			err:  "dispatching message 0: sending from " + contract + ": insufficient funds: 100uluna is smaller than 101uluna",
+		},
+		"execute unknown contract": {
+			msgs: []types.CosmosMsg{{Wasm: &types.WasmMsg{Execute: &types.ExecuteMsg{ContractAddr: alice, Msg: []byte(`{}`)}}}},
+			err:  "dispatching message 0: unknown contract " + alice,
+		},
+		"instantiate unknown code": {
+			msgs: []types.CosmosMsg{{Wasm: &types.WasmMsg{Instantiate: &types.InstantiateMsg{CodeID: 7, Msg: []byte(`{}`)}}}},
+			err:  "dispatching message 0: unknown code id 7",
+		},
+		"custom": {
+			msgs: []types.CosmosMsg{{Custom: json.RawMessage(`{"swap":{}}`)}},
+			err:  "dispatching message 0: " + types.UnsupportedRequest{Kind: "custom"}.Error(),
+		},
+		"staking": {
+			msgs: []types.CosmosMsg{{Staking: &types.StakingMsg{Delegate: &types.DelegateMsg{Validator: "val"}}}},
+			err:  "dispatching message 0: " + types.UnsupportedRequest{Kind: "staking.delegate"}.Error(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			a := openTestApp(t)
+			a.state.Balances[contract] = types.Coins{types.NewCoin(100, "uluna")}
+
+			events, err := a.dispatch(contract, tc.msgs)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.events, events)
+			assert.Equal(t, tc.balances, a.state.Balances)
+		})
+	}
+}
+
+// TestDispatchWasm instantiates and executes hackatom through messages of another contract.
+// Its release message sends the balance of the contract to the beneficiary with a bank message.
+func TestDispatchWasm(t *testing.T) {
+	a := openTestApp(t)
+	wasm, err := ioutil.ReadFile("../api/testdata/hackatom.wasm")
+	require.NoError(t, err)
+	code, err := a.store("", wasm)
+	require.NoError(t, err)
+
+	caller := testAddress(t, "caller")
+	stranger := testAddress(t, "stranger")
+	beneficiary := testAddress(t, "beneficiary")
+	a.state.Balances[caller] = types.Coins{types.NewCoin(100, "uluna")}
+	initMsg, err := json.Marshal(map[string]string{"verifier": caller, "beneficiary": beneficiary})
+	require.NoError(t, err)
+
+	events, err := a.dispatch(caller, []types.CosmosMsg{{Wasm: &types.WasmMsg{Instantiate: &types.InstantiateMsg{
+		CodeID: code.ID,
+		Msg:    initMsg,
+		Send:   types.Coins{types.NewCoin(40, "uluna")},
+	}}}})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "instantiate", events[0].Type)
+	hackatom := a.state.contractAddresses()[0]
+	assert.Equal(t, []types.LogAttribute{
+		{Key: "code_id", Value: "1"},
+		{Key: "contract_address", Value: hackatom},
+	}, events[0].Attributes)
+	assert.Equal(t, types.Coins{types.NewCoin(40, "uluna")}, a.state.Balances[hackatom])
+
+	// only the verifier may release
+	release := []types.CosmosMsg{{Wasm: &types.WasmMsg{Execute: &types.ExecuteMsg{ContractAddr: hackatom, Msg: []byte(`{"release":{}}`)}}}}
+	_, err = a.dispatch(stranger, release)
+	assert.Error(t, err)
+
+	events, err = a.dispatch(caller, release)
+	require.NoError(t, err)
+	assert.Equal(t, []dispatch.Event{
+		{Type: "execute", Attributes: []types.LogAttribute{{Key: "contract_address", Value: hackatom}}},
+		{Type: "transfer", Attributes: []types.LogAttribute{
+			{Key: "sender", Value: hackatom},
+			{Key: "recipient", Value: beneficiary},
+			{Key: "amount", Value: "40uluna"},
+		}},
+	}, events)
+	assert.Equal(t, types.Coins{}, a.state.Balances[hackatom])
+	assert.Equal(t, types.Coins{types.NewCoin(40, "uluna")}, a.state.Balances[beneficiary])
+	assert.Equal(t, types.Coins{types.NewCoin(60, "uluna")}, a.state.Balances[caller])
+}
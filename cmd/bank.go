@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/CosmWasm/go-cosmwasm/querier"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+var coinPattern = regexp.MustCompile(`^([0-9]+)([a-zA-Z][a-zA-Z0-9/]{2,127})$`)
+
+// parseCoins reads a comma separated list like "100uluna,5ukrw"
+func parseCoins(s string) (types.Coins, error) {
+	coins := types.Coins{}
+	if strings.TrimSpace(s) == "" {
+		return coins, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		m := coinPattern.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("invalid coin %q, expected e.g. 100uluna", part)
+		}
+		coins = addCoins(coins, types.Coins{{Denom: m[2], Amount: m[1]}})
+	}
+	return coins, nil
+}
+
+func formatCoins(coins types.Coins) string {
+	parts := make([]string, len(coins))
+	for i, c := range coins {
+		parts[i] = c.Amount + c.Denom
+	}
+	return strings.Join(parts, ",")
+}
+
+func amountOf(coins types.Coins, denom string) *big.Int {
+	for _, c := range coins {
+		if c.Denom == denom {
+			n, ok := new(big.Int).SetString(c.Amount, 10)
+			if ok {
+				return n
+			}
+		}
+	}
+	return new(big.Int)
+}
+
+// addCoins returns the sum of a and b, sorted by denom and without zero amounts
+func addCoins(a, b types.Coins) types.Coins {
+	sums := make(map[string]*big.Int)
+	for _, coins := range []types.Coins{a, b} {
+		for _, c := range coins {
+			if sums[c.Denom] == nil {
+				sums[c.Denom] = new(big.Int)
+			}
+			sums[c.Denom].Add(sums[c.Denom], amountOf(types.Coins{c}, c.Denom))
+		}
+	}
+	return coinsFromMap(sums)
+}
+
+// subCoins returns a - b, or an error if a does not cover b
+func subCoins(a, b types.Coins) (types.Coins, error) {
+	rest := make(map[string]*big.Int)
+	for _, c := range a {
+		rest[c.Denom] = amountOf(a, c.Denom)
+	}
+	for _, c := range b {
+		have := rest[c.Denom]
+		if have == nil {
+			have = new(big.Int)
+		}
+		have.Sub(have, amountOf(types.Coins{c}, c.Denom))
+		if have.Sign() < 0 {
+			return nil, fmt.Errorf("insufficient funds: %s is smaller than %s", formatCoins(a), formatCoins(b))
+		}
+		rest[c.Denom] = have
+	}
+	return coinsFromMap(rest), nil
+}
+
+func coinsFromMap(amounts map[string]*big.Int) types.Coins {
+	coins := types.Coins{}
+	for denom, amount := range amounts {
+		if amount.Sign() > 0 {
+			coins = append(coins, types.Coin{Denom: denom, Amount: amount.String()})
+		}
+	}
+	sort.Slice(coins, func(i, j int) bool { return coins[i].Denom < coins[j].Denom })
+	return coins
+}
+
+// transfer moves coins between two accounts of the state
+func (s *chainState) transfer(from, to string, amount types.Coins) error {
+	if len(amount) == 0 {
+		return nil
+	}
+	rest, err := subCoins(s.Balances[from], amount)
+	if err != nil {
+		return fmt.Errorf("sending from %s: %w", from, err)
+	}
+	s.Balances[from] = rest
+	s.Balances[to] = addCoins(s.Balances[to], amount)
+	return nil
+}
+
+// bankQuerier answers bank queries from the balances of the state
+type bankQuerier struct {
+	state *chainState
+	stats *accessStats
+}
+
+var _ querier.BankQuerier = bankQuerier{}
+
+func (q bankQuerier) Query(request *types.BankQuery) ([]byte, error) {
+	q.stats.Queries++
+	switch {
+	case request.Balance != nil:
+		amount := amountOf(q.state.Balances[request.Balance.Address], request.Balance.Denom)
+		return json.Marshal(types.BalanceResponse{
+			Amount: types.Coin{Denom: request.Balance.Denom, Amount: amount.String()},
+		})
+	case request.AllBalances != nil:
+		return json.Marshal(types.AllBalancesResponse{
+			Amount: q.state.Balances[request.AllBalances.Address],
+		})
+	default:
+		return nil, types.UnsupportedRequest{Kind: "bank"}
+	}
+}
+
+func runBank(args []string) error {
+	fs := flag.NewFlagSet("bank", flag.ExitOnError)
+	opts := addHomeFlags(fs)
+	fs.Usage = usageFor(fs, "bank set ADDRESS COINS | bank show [ADDRESS]",
+		"Sets or shows the balances of the mock bank, e.g. bank set terra1... 1000uluna,50ukrw")
+	fs.Parse(args)
+
+	state, err := loadChainState(opts.home)
+	if err != nil {
+		return err
+	}
+	switch fs.Arg(0) {
+	case "set":
+		if fs.NArg() != 3 {
+			fs.Usage()
+			return errUsage
+		}
+		coins, err := parseCoins(fs.Arg(2))
+		if err != nil {
+			return err
+		}
+		state.Balances[fs.Arg(1)] = coins
+		if err := ensureHome(opts.home); err != nil {
+			return err
+		}
+		return state.save(opts.home)
+	case "show":
+		if fs.NArg() == 2 {
+			return printJSON(state.Balances[fs.Arg(1)])
+		}
+		return printJSON(state.Balances)
+	default:
+		fs.Usage()
+		return errUsage
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+func TestParseCoins(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		expected types.Coins
+		err      string
+	}{
+		"empty": {
+			input:    " ",
+			expected: types.Coins{},
+		},
+		"one": {
+			input:    "100uluna",
+			expected: types.Coins{types.NewCoin(100, "uluna")},
+		},
+		"sorted and merged": {
+			input:    "5ukrw, 100uluna,7ukrw",
+			expected: types.Coins{types.NewCoin(12, "ukrw"), types.NewCoin(100, "uluna")},
+		},
+		"zero is dropped": {
+			input:    "0uluna",
+			expected: types.Coins{},
+		},
+		"ibc denom": {
+			input:    "1ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2",
+			expected: types.Coins{types.NewCoin(1, "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2")},
+		},
+		"no amount": {
+			input: "uluna",
+			err:   `invalid coin "uluna", expected e.g. 100uluna`,
+		},
+		"negative": {
+			input: "-5uluna",
+			err:   `invalid coin "-5uluna", expected e.g. 100uluna`,
+		},
+		"short denom": {
+			input: "5ul",
+			err:   `invalid coin "5ul", expected e.g. 100uluna`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			coins, err := parseCoins(tc.input)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, coins)
+		})
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	cases := map[string]struct {
+		amount types.Coins
+		// expected balances of alice and bob, unchanged on errors
+		alice types.Coins
+		bob   types.Coins
+		err   string
+	}{
+		"nothing": {
+			amount: nil,
+			alice:  types.Coins{types.NewCoin(100, "uluna"), types.NewCoin(5, "ukrw")},
+			bob:    types.Coins{types.NewCoin(1, "uluna")},
+		},
+		"part": {
+			amount: types.Coins{types.NewCoin(40, "uluna")},
+			alice:  types.Coins{types.NewCoin(5, "ukrw"), types.NewCoin(60, "uluna")},
+			bob:    types.Coins{types.NewCoin(41, "uluna")},
+		},
+		"everything": {
+			amount: types.Coins{types.NewCoin(5, "ukrw"), types.NewCoin(100, "uluna")},
+			alice:  types.Coins{},
+			bob:    types.Coins{types.NewCoin(5, "ukrw"), types.NewCoin(101, "uluna")},
+		},
+		"too much": {
+			amount: types.Coins{types.NewCoin(101, "uluna")},
+			alice:  types.Coins{types.NewCoin(100, "uluna"), types.NewCoin(5, "ukrw")},
+			bob:    types.Coins{types.NewCoin(1, "uluna")},
+			err:    "sending from alice: insufficient funds: 100uluna,5ukrw is smaller than 101uluna",
+		},
+		"unknown denom": {
+			amount: types.Coins{types.NewCoin(1, "umnt")},
+			alice:  types.Coins{types.NewCoin(100, "uluna"), types.NewCoin(5, "ukrw")},
+			bob:    types.Coins{types.NewCoin(1, "uluna")},
+			err:    "sending from alice: insufficient funds: 100uluna,5ukrw is smaller than 1umnt",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			state := &chainState{Balances: map[string]types.Coins{
+				"alice": {types.NewCoin(100, "uluna"), types.NewCoin(5, "ukrw")},
+				"bob":   {types.NewCoin(1, "uluna")},
+			}}
+			err := state.transfer("alice", "bob", tc.amount)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.alice, state.Balances["alice"])
+			assert.Equal(t, tc.bob, state.Balances["bob"])
+		})
+	}
+}
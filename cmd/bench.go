@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	wasm "github.com/CosmWasm/go-cosmwasm"
+	"github.com/CosmWasm/go-cosmwasm/datadir"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// Benchmark scenarios, from the slowest to the fastest way the VM can get to a contract instance
+const (
+	// benchCold runs every call on a fresh Wasmer without compiled module, so the call compiles the wasm
+	benchCold = "cold"
+	// benchWarm runs every call on a fresh Wasmer, so the call loads the compiled module from disk
+	benchWarm = "warm"
+	// benchHot runs all calls on one Wasmer after a first untimed call, so they are served from its memory cache
+	benchHot = "hot"
+)
+
+var benchScenarios = []string{benchCold, benchWarm, benchHot}
+
+// benchResult are the numbers of one scenario
+type benchResult struct {
+	Scenario string        `json:"scenario"`
+	Runs     int           `json:"runs"`
+	Mean     time.Duration `json:"mean_ns"`
+	P50      time.Duration `json:"p50_ns"`
+	P90      time.Duration `json:"p90_ns"`
+	P99      time.Duration `json:"p99_ns"`
+	Max      time.Duration `json:"max_ns"`
+	// GasUsed and StorageGas are per call, they should not differ between scenarios
+	GasUsed      uint64  `json:"gas_used"`
+	StorageGas   uint64  `json:"storage_gas"`
+	GasPerSecond float64 `json:"gas_per_second"`
+	// GoAllocsPerCall and GoBytesPerCall count the Go heap allocations of a call only, the memory
+	// the VM allocates natively for the contract is not included
+	GoAllocsPerCall uint64 `json:"go_allocs_per_call"`
+	GoBytesPerCall  uint64 `json:"go_bytes_per_call"`
+}
+
+// benchReport is what bench prints with -json and reads with -baseline
+type benchReport struct {
+	Contract  string        `json:"contract"`
+	Msg       string        `json:"msg"`
+	Query     bool          `json:"query"`
+	CacheSize uint64        `json:"cache_size"`
+	Results   []benchResult `json:"results"`
+}
+
+// bench runs the benchmark of one message, every call starts from the same state and nothing is committed
+type bench struct {
+	app      *app
+	contract string
+	msg      []byte
+	query    bool
+	sender   string
+	funds    types.Coins
+	env      *envOptions
+	// codes are the wasm of all local codes, so messages dispatched to other contracts work on the bench Wasmers
+	codes [][]byte
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	env := addEnvFlags(fs, true)
+	runs := fs.Int("n", 100, "number of timed calls of the warm and hot scenarios")
+	coldRuns := fs.Int("cold-n", 10, "number of timed calls of the cold scenario, every one compiles the contract")
+	scenarios := fs.String("scenarios", strings.Join(benchScenarios, ","), "comma separated scenarios to run")
+	query := fs.Bool("query", false, "MSG is a smart query rather than an execute message")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	baseline := fs.String("baseline", "", "JSON report of an earlier run to compare the median latencies with")
+	maxRegression := fs.Float64("max-regression", 10, "with -baseline, fail if a median latency got slower by more than this percentage")
+	fs.Usage = usageFor(fs, "bench [flags] CONTRACT MSG",
+		"Runs a message against a contract N times and reports latency percentiles, gas per second and Go allocations "+
+			"in three scenarios:\n\n"+
+			"  cold  every call on a fresh Wasmer without compiled module, so it compiles the wasm\n"+
+			"  warm  every call on a fresh Wasmer, so it loads the compiled module from disk\n"+
+			"  hot   all calls on one Wasmer, served from its in-memory cache\n\n"+
+			"Every call starts from the current local state and nothing is committed. -cache-size is passed to the Wasmer, "+
+			"but the VM of this build keeps a fixed size memory cache. The allocation columns only count the Go heap, "+
+			"not the memory the VM allocates natively. MSG is JSON, or @FILE to read it from a file.")
+	fs.Parse(args)
+	if fs.NArg() != 2 || *runs < 1 || *coldRuns < 1 {
+		fs.Usage()
+		return errUsage
+	}
+	selected, err := parseScenarios(*scenarios)
+	if err != nil {
+		return err
+	}
+
+	msg, err := readMsg(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	b := &bench{contract: fs.Arg(0), msg: msg, query: *query, env: env}
+	if !b.query {
+		info, err := env.message()
+		if err != nil {
+			return err
+		}
+		b.sender, b.funds = info.Sender, info.SentFunds
+	}
+	if b.app, err = openApp(home, vm); err != nil {
+		return err
+	}
+	defer b.app.close()
+	if _, err := b.app.state.contract(b.contract); err != nil {
+		return err
+	}
+	for _, info := range b.app.state.Codes {
+		id, err := b.app.codeID(info.ID)
+		if err != nil {
+			return err
+		}
+		code, err := b.app.wasmer.GetCode(id)
+		if err != nil {
+			return fmt.Errorf("code %d: %w", info.ID, err)
+		}
+		b.codes = append(b.codes, code)
+	}
+
+	report := benchReport{Contract: b.contract, Msg: string(msg), Query: b.query, CacheSize: vm.cacheSize}
+	for _, scenario := range selected {
+		n := *runs
+		if scenario == benchCold {
+			n = *coldRuns
+		}
+		res, err := b.run(scenario, n)
+		if err != nil {
+			return fmt.Errorf("%s: %w", scenario, err)
+		}
+		report.Results = append(report.Results, *res)
+	}
+
+	if *asJSON {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		printBenchReport(report)
+	}
+	if *baseline != "" {
+		return compareBaseline(report, *baseline, *maxRegression, !*asJSON)
+	}
+	return nil
+}
+
+// parseScenarios returns the scenarios of a comma separated list
+func parseScenarios(list string) ([]string, error) {
+	var selected []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name != benchCold && name != benchWarm && name != benchHot {
+			return nil, fmt.Errorf("unknown scenario %q, expected %s", name, strings.Join(benchScenarios, ", "))
+		}
+		selected = append(selected, name)
+	}
+	return selected, nil
+}
+
+// wasmerDir is a Wasmer data directory with the local codes stored in it
+type wasmerDir struct {
+	dir string
+}
+
+// newWasmerDir stores the codes in a fresh data directory. Without keepModules the compiled modules are removed,
+// so the first call has to compile the code.
+func (b *bench) newWasmerDir(keepModules bool) (*wasmerDir, error) {
+	dir, err := ioutil.TempDir("", "wasmcli-bench")
+	if err != nil {
+		return nil, err
+	}
+	w, err := wasm.NewWasmer(dir, b.app.vm.features, b.app.vm.cacheSize)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	for _, code := range b.codes {
+		if _, err = w.Create(code); err != nil {
+			break
+		}
+	}
+	w.Cleanup()
+	if err == nil && !keepModules {
+		err = removeModules(dir)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &wasmerDir{dir: dir}, nil
+}
+
+func removeModules(dir string) error {
+	entries, err := datadir.List(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		for _, m := range e.Modules {
+			if err := os.Remove(datadir.ModulePath(dir, m.Backend, e.CodeID)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *wasmerDir) open(vm *vmOptions) (*wasm.Wasmer, error) {
+	return wasm.NewWasmer(d.dir, vm.features, vm.cacheSize)
+}
+
+func (d *wasmerDir) remove() {
+	os.RemoveAll(d.dir)
+}
+
+// benchSample is one timed call
+type benchSample struct {
+	duration   time.Duration
+	gasUsed    uint64
+	storageGas uint64
+	goAllocs   uint64
+	goBytes    uint64
+}
+
+func (b *bench) run(scenario string, n int) (*benchResult, error) {
+	samples := make([]benchSample, 0, n)
+	switch scenario {
+	case benchCold:
+		for i := 0; i < n; i++ {
+			d, err := b.newWasmerDir(false)
+			if err != nil {
+				return nil, err
+			}
+			s, err := b.sampleOn(d)
+			d.remove()
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, *s)
+		}
+	case benchWarm:
+		d, err := b.newWasmerDir(true)
+		if err != nil {
+			return nil, err
+		}
+		defer d.remove()
+		for i := 0; i < n; i++ {
+			s, err := b.sampleOn(d)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, *s)
+		}
+	case benchHot:
+		d, err := b.newWasmerDir(true)
+		if err != nil {
+			return nil, err
+		}
+		defer d.remove()
+		w, err := d.open(b.app.vm)
+		if err != nil {
+			return nil, err
+		}
+		defer w.Cleanup()
+		// the first call fills the memory cache
+		if _, err := b.sample(w); err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			s, err := b.sample(w)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, *s)
+		}
+	}
+	return summarize(scenario, samples), nil
+}
+
+// sampleOn times a call on a fresh Wasmer on the data directory
+func (b *bench) sampleOn(d *wasmerDir) (*benchSample, error) {
+	w, err := d.open(b.app.vm)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Cleanup()
+	return b.sample(w)
+}
+
+// sample times one call with the given Wasmer, and restores the state afterwards
+func (b *bench) sample(w *wasm.Wasmer) (*benchSample, error) {
+	a := b.app
+	restore, err := a.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	// the app closes its own Wasmer
+	defer func(own *wasm.Wasmer) { a.wasmer = own }(a.wasmer)
+	a.wasmer = w
+	a.block = b.env.block(a.state.Height + 1)
+	a.gasUsed = 0
+	a.meter = &gasMeter{}
+	a.stats = accessStats{}
+	// load the storage before the clock starts, so every sample reads it from memory
+	if _, err := a.stores.get(b.contract); err != nil {
+		return nil, err
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	if b.query {
+		_, err = a.query(b.contract, b.msg, a.vm.gasLimit, nil)
+	} else {
+		_, err = a.execute(b.contract, b.sender, b.funds, b.msg)
+	}
+	duration := time.Since(start)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		return nil, err
+	}
+	s := &benchSample{
+		duration:   duration,
+		gasUsed:    a.gasUsed,
+		storageGas: a.meter.GasConsumed(),
+		goAllocs:   after.Mallocs - before.Mallocs,
+		goBytes:    after.TotalAlloc - before.TotalAlloc,
+	}
+	return s, restore()
+}
+
+// summarize returns the numbers of the samples, all zero without samples
+func summarize(scenario string, samples []benchSample) *benchResult {
+	res := &benchResult{Scenario: scenario, Runs: len(samples)}
+	if len(samples) == 0 {
+		return res
+	}
+	durations := make([]time.Duration, len(samples))
+	var total time.Duration
+	var gas, storageGas, goAllocs, goBytes uint64
+	for i, s := range samples {
+		durations[i] = s.duration
+		total += s.duration
+		gas += s.gasUsed
+		storageGas += s.storageGas
+		goAllocs += s.goAllocs
+		goBytes += s.goBytes
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	n := uint64(len(samples))
+	res.Mean = total / time.Duration(n)
+	res.P50 = percentile(durations, 50)
+	res.P90 = percentile(durations, 90)
+	res.P99 = percentile(durations, 99)
+	res.Max = durations[len(durations)-1]
+	res.GasUsed = gas / n
+	res.StorageGas = storageGas / n
+	if total > 0 {
+		res.GasPerSecond = float64(gas) / total.Seconds()
+	}
+	res.GoAllocsPerCall = goAllocs / n
+	res.GoBytesPerCall = goBytes / n
+	return res
+}
+
+// percentile uses the nearest rank of sorted durations, it is 0 without durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func printBenchReport(report benchReport) {
+	var hot time.Duration
+	for _, res := range report.Results {
+		if res.Scenario == benchHot {
+			hot = res.P50
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "scenario\truns\tmean\tp50\tp90\tp99\tmax\tvs hot\tgas\tgas/s\tgo allocs/call\tgo bytes/call\t")
+	for _, res := range report.Results {
+		vsHot := "-"
+		if hot > 0 {
+			vsHot = fmt.Sprintf("%.1fx", float64(res.P50)/float64(hot))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%.3g\t%d\t%d\t\n",
+			res.Scenario, res.Runs, roundDuration(res.Mean), roundDuration(res.P50), roundDuration(res.P90),
+			roundDuration(res.P99), roundDuration(res.Max), vsHot, res.GasUsed, res.GasPerSecond,
+			res.GoAllocsPerCall, res.GoBytesPerCall)
+	}
+	w.Flush()
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d > time.Second:
+		return d.Round(time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(time.Microsecond)
+	default:
+		return d
+	}
+}
+
+// compareBaseline fails if the median latency of a scenario got slower than in the baseline report
+// by more than maxRegression percent
+func compareBaseline(report benchReport, path string, maxRegression float64, print bool) error {
+	bz, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var base benchReport
+	if err := json.Unmarshal(bz, &base); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	baseline := make(map[string]benchResult)
+	for _, res := range base.Results {
+		baseline[res.Scenario] = res
+	}
+	var regressions []string
+	for _, res := range report.Results {
+		old, ok := baseline[res.Scenario]
+		if !ok || old.P50 == 0 {
+			continue
+		}
+		change := (float64(res.P50)/float64(old.P50) - 1) * 100
+		if print {
+			fmt.Printf("%s: p50 %s -> %s (%+.1f%%)\n", res.Scenario, roundDuration(old.P50), roundDuration(res.P50), change)
+		}
+		if change > maxRegression {
+			regressions = append(regressions, fmt.Sprintf("%s p50 %+.1f%%", res.Scenario, change))
+		}
+	}
+	if len(regressions) > 0 {
+		return fmt.Errorf("slower than %s by more than %g%%: %s", path, maxRegression, strings.Join(regressions, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/datadir"
+)
+
+func TestPercentile(t *testing.T) {
+	cases := map[string]struct {
+		sorted   []time.Duration
+		p        float64
+		expected time.Duration
+	}{
+		"empty":             {sorted: nil, p: 50, expected: 0},
+		"single p0":         {sorted: []time.Duration{7}, p: 0, expected: 7},
+		"single p50":        {sorted: []time.Duration{7}, p: 50, expected: 7},
+		"single p99":        {sorted: []time.Duration{7}, p: 99, expected: 7},
+		"even p50":          {sorted: []time.Duration{1, 2, 3, 4}, p: 50, expected: 2},
+		"even p90":          {sorted: []time.Duration{1, 2, 3, 4}, p: 90, expected: 4},
+		"odd p50":           {sorted: []time.Duration{1, 2, 3, 4, 5}, p: 50, expected: 3},
+		"hundred p99":       {sorted: durations(100), p: 99, expected: 99},
+		"hundred p100":      {sorted: durations(100), p: 100, expected: 100},
+		"p0 is the minimum": {sorted: []time.Duration{1, 2, 3}, p: 0, expected: 1},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, percentile(tc.sorted, tc.p))
+		})
+	}
+}
+
+// durations returns 1 to n
+func durations(n int) []time.Duration {
+	res := make([]time.Duration, n)
+	for i := range res {
+		res[i] = time.Duration(i + 1)
+	}
+	return res
+}
+
+func TestSummarize(t *testing.T) {
+	cases := map[string]struct {
+		samples  []benchSample
+		expected *benchResult
+	}{
+		"empty": {
+			samples:  nil,
+			expected: &benchResult{Scenario: benchHot},
+		},
+		"single": {
+			samples: []benchSample{{duration: time.Second, gasUsed: 1000, storageGas: 50, goAllocs: 3, goBytes: 100}},
+			expected: &benchResult{Scenario: benchHot, Runs: 1, Mean: time.Second, P50: time.Second, P90: time.Second,
+				P99: time.Second, Max: time.Second, GasUsed: 1000, StorageGas: 50, GasPerSecond: 1000, GoAllocsPerCall: 3, GoBytesPerCall: 100},
+		},
+		"even unsorted": {
+			samples: []benchSample{
+				{duration: 4 * time.Second, gasUsed: 1000, goAllocs: 4, goBytes: 10},
+				{duration: 1 * time.Second, gasUsed: 1000, goAllocs: 2, goBytes: 20},
+				{duration: 3 * time.Second, gasUsed: 1000, goAllocs: 4, goBytes: 10},
+				{duration: 2 * time.Second, gasUsed: 1000, goAllocs: 2, goBytes: 20},
+			},
+			expected: &benchResult{Scenario: benchHot, Runs: 4, Mean: 2500 * time.Millisecond, P50: 2 * time.Second,
+				P90: 4 * time.Second, P99: 4 * time.Second, Max: 4 * time.Second, GasUsed: 1000, GasPerSecond: 400,
+				GoAllocsPerCall: 3, GoBytesPerCall: 15},
+		},
+		"no time": {
+			samples:  []benchSample{{gasUsed: 10}, {gasUsed: 20}},
+			expected: &benchResult{Scenario: benchHot, Runs: 2, GasUsed: 15},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, summarize(benchHot, tc.samples))
+		})
+	}
+}
+
+func TestParseScenarios(t *testing.T) {
+	selected, err := parseScenarios("hot, cold")
+	require.NoError(t, err)
+	assert.Equal(t, []string{benchHot, benchCold}, selected)
+
+	_, err = parseScenarios("hot,lukewarm")
+	assert.EqualError(t, err, `unknown scenario "lukewarm", expected cold, warm, hot`)
+	_, err = parseScenarios("")
+	assert.EqualError(t, err, `unknown scenario "", expected cold, warm, hot`)
+}
+
+// TestRemoveModules checks that the cold scenario keeps the wasm but drops all compiled modules
+func TestRemoveModules(t *testing.T) {
+	dir := tempHome(t)
+	for _, code := range []string{"one", "two"} {
+		sum := sha256.Sum256([]byte(code))
+		writeTestFile(t, datadir.WasmPath(dir, sum[:]), code)
+		for _, backend := range []string{"singlepass", "cranelift"} {
+			writeTestFile(t, datadir.ModulePath(dir, backend, sum[:]), "compiled "+code)
+		}
+	}
+	require.NoError(t, removeModules(dir))
+	entries, err := datadir.List(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, e := range entries {
+		assert.True(t, e.HasWasm)
+		assert.Empty(t, e.Modules)
+	}
+
+	assert.Error(t, removeModules(filepath.Join(dir, "missing")))
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestCompareBaseline(t *testing.T) {
+	dir := tempHome(t)
+	path := filepath.Join(dir, "baseline.json")
+	bz, err := json.Marshal(benchReport{Results: []benchResult{
+		{Scenario: benchWarm, P50: 100 * time.Microsecond},
+		{Scenario: benchHot, P50: 10 * time.Microsecond},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, bz, 0644))
+
+	report := func(warm, hot time.Duration) benchReport {
+		return benchReport{Results: []benchResult{
+			{Scenario: benchCold, P50: time.Second},
+			{Scenario: benchWarm, P50: warm},
+			{Scenario: benchHot, P50: hot},
+		}}
+	}
+	// cold is not in the baseline and is skipped
+	assert.NoError(t, compareBaseline(report(105*time.Microsecond, 5*time.Microsecond), path, 10, false))
+	err = compareBaseline(report(120*time.Microsecond, 12*time.Microsecond), path, 10, false)
+	assert.EqualError(t, err, "slower than "+path+" by more than 10%: warm p50 +20.0%, hot p50 +20.0%")
+	assert.NoError(t, compareBaseline(report(120*time.Microsecond, 12*time.Microsecond), path, 25, false))
+
+	assert.Error(t, compareBaseline(report(0, 0), filepath.Join(dir, "missing.json"), 10, false))
+}
+
+// TestBenchRun runs all scenarios of a hackatom query, which needs the VM
+func TestBenchRun(t *testing.T) {
+	a := openTestApp(t)
+	wasm, err := ioutil.ReadFile("../api/testdata/hackatom.wasm")
+	require.NoError(t, err)
+	code, err := a.store("", wasm)
+	require.NoError(t, err)
+	verifier := testAddress(t, "verifier")
+	initMsg, err := json.Marshal(map[string]string{"verifier": verifier, "beneficiary": testAddress(t, "beneficiary")})
+	require.NoError(t, err)
+	res, err := a.instantiate(code.ID, verifier, nil, initMsg, "", "")
+	require.NoError(t, err)
+
+	b := &bench{app: a, contract: res.Contract, msg: []byte(`{"verifier":{}}`), query: true, env: &envOptions{}, codes: [][]byte{wasm}}
+	for _, scenario := range benchScenarios {
+		t.Run(scenario, func(t *testing.T) {
+			result, err := b.run(scenario, 2)
+			require.NoError(t, err)
+			assert.Equal(t, scenario, result.Scenario)
+			assert.Equal(t, 2, result.Runs)
+			assert.NotZero(t, result.P50)
+			assert.NotZero(t, result.GasUsed)
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	wasm "github.com/CosmWasm/go-cosmwasm"
+	"github.com/CosmWasm/go-cosmwasm/datadir"
+)
+
+// cacheEntry is a datadir.Entry for output
+type cacheEntry struct {
+	CodeID string `json:"code_id"`
+	// LocalID is the code id in the local state, if the code is stored there
+	LocalID  uint64        `json:"local_id,omitempty"`
+	WasmSize int64         `json:"wasm_size"`
+	HasWasm  bool          `json:"has_wasm"`
+	Modules  []cacheModule `json:"modules"`
+	Size     int64         `json:"size"`
+	LastUsed time.Time     `json:"last_used"`
+}
+
+type cacheModule struct {
+	Backend  string    `json:"backend"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+type cacheProblem struct {
+	CodeID   string `json:"code_id"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+func runCache(args []string) error {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	dataDir := fs.String("data-dir", "", "Wasmer data directory, e.g. of a node (default: the one of the local state)")
+	asJSON := fs.Bool("json", false, "list: print the entries as JSON")
+	repair := fs.Bool("repair", false, "verify: recompile missing or corrupt modules")
+	dryRun := fs.Bool("dry-run", false, "prune: only print what would be removed")
+	fs.Usage = usageFor(fs, "cache [flags] list | cache [flags] verify | cache [flags] prune ALLOW_LIST",
+		"Manages the Wasmer data directory, which keeps the wasm and compiled modules of every code forever.\n\n"+
+			"  list    the stored code ids with their sizes and last use\n"+
+			"  verify  checks every wasm against its code id and that it has a compiled module, -repair recompiles\n"+
+			"  prune   removes every code not in ALLOW_LIST, a file with one hex code id per line (# starts a comment).\n"+
+			"          Without -data-dir the codes of the local state are kept as well.\n\n"+
+			"Prune and repair must not run while a node uses the directory.")
+	fs.Parse(args)
+
+	switch {
+	case fs.Arg(0) == "list" && fs.NArg() == 1:
+	case fs.Arg(0) == "verify" && fs.NArg() == 1:
+	case fs.Arg(0) == "prune" && fs.NArg() == 2:
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	dir := *dataDir
+	var state *chainState
+	if dir == "" {
+		dir = filepath.Join(home.home, wasmDir)
+		var err error
+		if state, err = loadChainState(home.home); err != nil {
+			return err
+		}
+	}
+
+	switch fs.Arg(0) {
+	case "list":
+		entries, err := datadir.List(dir)
+		if err != nil {
+			return err
+		}
+		list := cacheEntries(entries, state)
+		if *asJSON {
+			return printJSON(list)
+		}
+		printCacheEntries(list)
+		return nil
+	case "verify":
+		return verifyCache(dir, vm, *repair)
+	default:
+		keep, err := readAllowList(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if state != nil {
+			for _, code := range state.Codes {
+				id, err := hex.DecodeString(code.Checksum)
+				if err != nil {
+					return fmt.Errorf("code %d: %w", code.ID, err)
+				}
+				keep = append(keep, id)
+			}
+		}
+		removed, err := datadir.Prune(dir, keep, *dryRun)
+		list := cacheEntries(removed, state)
+		if perr := printJSON(struct {
+			DryRun  bool         `json:"dry_run"`
+			Removed []cacheEntry `json:"removed"`
+			Freed   int64        `json:"freed"`
+		}{*dryRun, list, totalSize(list)}); perr != nil {
+			return perr
+		}
+		return err
+	}
+}
+
+func verifyCache(dir string, vm *vmOptions, repair bool) error {
+	problems, err := datadir.Verify(dir)
+	if err != nil {
+		return err
+	}
+	var wasmer *wasm.Wasmer
+	if repair {
+		for _, p := range problems {
+			if p.Recompilable() {
+				if wasmer, err = wasm.NewWasmer(dir, vm.features, vm.cacheSize); err != nil {
+					return err
+				}
+				defer wasmer.Cleanup()
+				break
+			}
+		}
+	}
+
+	report := []cacheProblem{}
+	unresolved := 0
+	// a code with several problems is recompiled once
+	repaired := make(map[string]error)
+	for _, p := range problems {
+		res := cacheProblem{CodeID: hex.EncodeToString(p.CodeID), Kind: p.Kind, Detail: p.Detail}
+		if wasmer != nil && p.Recompilable() {
+			err, done := repaired[string(p.CodeID)]
+			if !done {
+				err = wasmer.Recompile(p.CodeID)
+				repaired[string(p.CodeID)] = err
+			}
+			if err != nil {
+				res.Detail += "; recompiling failed: " + err.Error()
+			}
+			res.Repaired = err == nil
+		}
+		if !res.Repaired {
+			unresolved++
+		}
+		report = append(report, res)
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if unresolved > 0 {
+		return fmt.Errorf("%d problems in %s", unresolved, dir)
+	}
+	return nil
+}
+
+// readAllowList reads hex code ids, one per line
+func readAllowList(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ids [][]byte
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		id, err := hex.DecodeString(text)
+		if err != nil || len(id) != 32 {
+			return nil, fmt.Errorf("%s:%d: invalid code id %q", path, line, text)
+		}
+		ids = append(ids, id)
+	}
+	return ids, scanner.Err()
+}
+
+func cacheEntries(entries []datadir.Entry, state *chainState) []cacheEntry {
+	localIDs := make(map[string]uint64)
+	if state != nil {
+		for _, code := range state.Codes {
+			localIDs[strings.ToLower(code.Checksum)] = code.ID
+		}
+	}
+	list := []cacheEntry{}
+	for _, e := range entries {
+		id := hex.EncodeToString(e.CodeID)
+		res := cacheEntry{
+			CodeID:   id,
+			LocalID:  localIDs[id],
+			WasmSize: e.WasmSize,
+			HasWasm:  e.HasWasm,
+			Modules:  []cacheModule{},
+			Size:     e.Size(),
+			LastUsed: e.LastUsed,
+		}
+		for _, m := range e.Modules {
+			res.Modules = append(res.Modules, cacheModule(m))
+		}
+		list = append(list, res)
+	}
+	return list
+}
+
+func totalSize(list []cacheEntry) int64 {
+	var total int64
+	for _, e := range list {
+		total += e.Size
+	}
+	return total
+}
+
+func printCacheEntries(list []cacheEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE ID\tLOCAL\tWASM\tMODULES\tTOTAL\tLAST USED")
+	for _, e := range list {
+		local := "-"
+		if e.LocalID != 0 {
+			local = fmt.Sprint(e.LocalID)
+		}
+		wasmSize := "missing"
+		if e.HasWasm {
+			wasmSize = formatSize(e.WasmSize)
+		}
+		modules := make([]string, len(e.Modules))
+		for i, m := range e.Modules {
+			modules[i] = m.Backend + " " + formatSize(m.Size)
+		}
+		if len(modules) == 0 {
+			modules = []string{"none"}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.CodeID, local, wasmSize, strings.Join(modules, ", "),
+			formatSize(e.Size), e.LastUsed.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(w, "%d codes\t\t\t\t%s\t\n", len(list), formatSize(totalSize(list)))
+	w.Flush()
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
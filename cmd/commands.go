@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/CosmWasm/go-cosmwasm/schema"
+)
+
+// txCommand opens the app for a command that changes the state and commits it if run succeeds.
+// The block height is the next one of the local chain, unless -height is set.
+func txCommand(home *homeOptions, vm *vmOptions, env *envOptions, run func(a *app) (interface{}, error)) error {
+	a, err := openApp(home, vm)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+	a.block = env.block(a.state.Height + 1)
+	if a.block.Height > a.state.Height {
+		a.state.Height = a.block.Height
+	}
+
+	res, err := run(a)
+	if err != nil {
+		return err
+	}
+	if err := a.commit(); err != nil {
+		return err
+	}
+	if call, ok := res.(*callResult); ok {
+		call.GasUsed = a.gasUsed
+		call.StorageGas = a.meter.GasConsumed()
+	}
+	return printJSON(res)
+}
+
+func runStore(args []string) error {
+	fs := flag.NewFlagSet("store", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	env := addEnvFlags(fs, false)
+	sender := fs.String("sender", "", "address of the uploader")
+	fs.Usage = usageFor(fs, "store [flags] FILE.wasm", "Stores wasm code and prints its code id and checksum.")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	code, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return txCommand(home, vm, env, func(a *app) (interface{}, error) {
+		if *sender != "" {
+			if err := a.validateAddress(*sender); err != nil {
+				return nil, err
+			}
+		}
+		return a.store(*sender, code)
+	})
+}
+
+func runInstantiate(args []string) error {
+	fs := flag.NewFlagSet("instantiate", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	env := addEnvFlags(fs, true)
+	label := fs.String("label", "", "label of the contract")
+	admin := fs.String("admin", "", "address that may migrate the contract (default: nobody)")
+	schemaDir := addSchemaFlag(fs)
+	fs.Usage = usageFor(fs, "instantiate [flags] CODE_ID MSG",
+		"Instantiates stored code. MSG is JSON, or @FILE to read it from a file.")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	codeID, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return err
+	}
+	msg, err := readMsg(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := checkMsg(*schemaDir, schema.KindInit, msg); err != nil {
+		return err
+	}
+	info, err := env.message()
+	if err != nil {
+		return err
+	}
+	return txCommand(home, vm, env, func(a *app) (interface{}, error) {
+		if err := a.validateAddress(info.Sender); err != nil {
+			return nil, err
+		}
+		if *admin != "" {
+			if err := a.validateAddress(*admin); err != nil {
+				return nil, err
+			}
+		}
+		return a.instantiate(codeID, info.Sender, info.SentFunds, msg, *label, *admin)
+	})
+}
+
+func runExecute(args []string) error {
+	fs := flag.NewFlagSet("execute", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	env := addEnvFlags(fs, true)
+	schemaDir := addSchemaFlag(fs)
+	fs.Usage = usageFor(fs, "execute [flags] CONTRACT MSG",
+		"Executes a contract. MSG is JSON, or @FILE to read it from a file.")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	msg, err := readMsg(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := checkMsg(*schemaDir, schema.KindHandle, msg); err != nil {
+		return err
+	}
+	info, err := env.message()
+	if err != nil {
+		return err
+	}
+	return txCommand(home, vm, env, func(a *app) (interface{}, error) {
+		if err := a.validateAddress(info.Sender); err != nil {
+			return nil, err
+		}
+		return a.execute(fs.Arg(0), info.Sender, info.SentFunds, msg)
+	})
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	env := addEnvFlags(fs, true)
+	schemaDir := addSchemaFlag(fs)
+	fs.Usage = usageFor(fs, "migrate [flags] CONTRACT NEW_CODE_ID MSG",
+		"Migrates a contract to new code, the sender must be its admin. MSG is JSON, or @FILE to read it from a file.")
+	fs.Parse(args)
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return errUsage
+	}
+
+	codeID, err := strconv.ParseUint(fs.Arg(1), 10, 64)
+	if err != nil {
+		return err
+	}
+	msg, err := readMsg(fs.Arg(2))
+	if err != nil {
+		return err
+	}
+	if err := checkMsg(*schemaDir, schema.KindMigrate, msg); err != nil {
+		return err
+	}
+	info, err := env.message()
+	if err != nil {
+		return err
+	}
+	return txCommand(home, vm, env, func(a *app) (interface{}, error) {
+		if err := a.validateAddress(info.Sender); err != nil {
+			return nil, err
+		}
+		return a.migrate(fs.Arg(0), info.Sender, codeID, msg)
+	})
+}
+
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	env := addEnvFlags(fs, false)
+	schemaDir := addSchemaFlag(fs)
+	fs.Usage = usageFor(fs, "query [flags] CONTRACT MSG",
+		"Runs a smart query and prints the result. MSG is JSON, or @FILE to read it from a file.")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	msg, err := readMsg(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := checkMsg(*schemaDir, schema.KindQuery, msg); err != nil {
+		return err
+	}
+	a, err := openApp(home, vm)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+	a.block = env.block(a.state.Height)
+
+	res, err := a.query(fs.Arg(0), msg, vm.gasLimit, nil)
+	if err != nil {
+		return err
+	}
+	// queries are never committed
+	return printJSON(struct {
+		Result     interface{} `json:"result"`
+		GasUsed    uint64      `json:"gas_used"`
+		StorageGas uint64      `json:"storage_gas"`
+	}{marshalResult(res), a.gasUsed, a.meter.GasConsumed()})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrateChecksSender(t *testing.T) {
+	home := tempHome(t)
+	admin := testAddress(t, "admin")
+	contract := testAddress(t, "contract")
+	state, err := loadChainState(home)
+	require.NoError(t, err)
+	state.Codes = []codeInfo{{ID: 1, Checksum: "abcd"}}
+	state.Contracts[contract] = &contractInfo{Address: contract, CodeID: 1, Creator: admin, Admin: admin}
+	require.NoError(t, state.save(home))
+
+	a := openTestApp(t)
+	invalid := a.validateAddress("admin")
+	require.Error(t, invalid)
+
+	cases := map[string]struct {
+		sender string
+		err    string
+	}{
+		"invalid sender": {
+			sender: "admin",
+			err:    invalid.Error(),
+		},
+		"not the admin": {
+			sender: testAddress(t, "stranger"),
+			err:    testAddress(t, "stranger") + " is not the admin of " + contract,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := runMigrate([]string{"-home", home, "-sender", tc.sender, contract, "1", `{}`})
+			assert.EqualError(t, err, tc.err)
+			// nothing was committed
+			loaded, err := loadChainState(home)
+			require.NoError(t, err)
+			assert.Equal(t, state, loaded)
+		})
+	}
+}
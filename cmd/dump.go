@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stateDump is the JSON format of a dumped contract storage. The JSONL format has one entry per line instead.
+type stateDump struct {
+	Contract string       `json:"contract"`
+	Encoding string       `json:"encoding"`
+	Entries  []stateEntry `json:"entries"`
+}
+
+// stateEntry is a key value pair of a contract storage. Key and value are encoded, or given as text
+// in KeyUTF8 and ValueUTF8 if the dump decoded them.
+type stateEntry struct {
+	Key       string  `json:"key,omitempty"`
+	KeyUTF8   *string `json:"key_utf8,omitempty"`
+	Value     string  `json:"value,omitempty"`
+	ValueUTF8 *string `json:"value_utf8,omitempty"`
+}
+
+// stateCodec encodes the keys and values of a dump
+type stateCodec struct {
+	encoding   string
+	decodeUTF8 bool
+}
+
+func newStateCodec(encoding string, decodeUTF8 bool) (stateCodec, error) {
+	switch encoding {
+	case "hex", "base64":
+		return stateCodec{encoding: encoding, decodeUTF8: decodeUTF8}, nil
+	default:
+		return stateCodec{}, fmt.Errorf("unknown encoding %q, use hex or base64", encoding)
+	}
+}
+
+func (c stateCodec) encode(bz []byte) (string, *string) {
+	if c.decodeUTF8 && isText(bz) {
+		text := string(bz)
+		return "", &text
+	}
+	if c.encoding == "hex" {
+		return hex.EncodeToString(bz), nil
+	}
+	return base64.StdEncoding.EncodeToString(bz), nil
+}
+
+func (c stateCodec) decode(encoded string, text *string) ([]byte, error) {
+	if text != nil {
+		return []byte(*text), nil
+	}
+	if c.encoding == "hex" {
+		return hex.DecodeString(encoded)
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func (c stateCodec) entry(key, value []byte) stateEntry {
+	var e stateEntry
+	e.Key, e.KeyUTF8 = c.encode(key)
+	e.Value, e.ValueUTF8 = c.encode(value)
+	return e
+}
+
+func (c stateCodec) pair(e stateEntry) ([]byte, []byte, error) {
+	key, err := c.decode(e.Key, e.KeyUTF8)
+	if err != nil {
+		return nil, nil, fmt.Errorf("key %q: %w", e.Key, err)
+	}
+	if len(key) == 0 {
+		return nil, nil, errors.New("entry without key")
+	}
+	value, err := c.decode(e.Value, e.ValueUTF8)
+	if err != nil {
+		return nil, nil, fmt.Errorf("value of key %q: %w", e.Key, err)
+	}
+	return key, value, nil
+}
+
+// isText is true for valid UTF-8 without control characters, which is safe to show as a JSON string
+func isText(bz []byte) bool {
+	if !utf8.Valid(bz) {
+		return false
+	}
+	for _, r := range string(bz) {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatOf returns the format of a dump file, given by -format or else by the file extension
+func formatOf(format string, path string) (string, error) {
+	if format == "" {
+		if filepath.Ext(path) == ".jsonl" {
+			return "jsonl", nil
+		}
+		return "json", nil
+	}
+	if format != "json" && format != "jsonl" {
+		return "", fmt.Errorf("unknown format %q, use json or jsonl", format)
+	}
+	return format, nil
+}
+
+func runDump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	format := fs.String("format", "", "json or jsonl (default: by the extension of FILE, json for stdout)")
+	encoding := fs.String("encoding", "hex", "encoding of keys and values, hex or base64")
+	decodeUTF8 := fs.Bool("utf8", false, "write keys and values that are text as key_utf8 and value_utf8")
+	fs.Usage = usageFor(fs, "dump [flags] CONTRACT [FILE]",
+		"Writes the storage of a contract to FILE, or to stdout. The dump can be imported with load.")
+	fs.Parse(args)
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	path := fs.Arg(1)
+	f, err := formatOf(*format, path)
+	if err != nil {
+		return err
+	}
+	codec, err := newStateCodec(*encoding, *decodeUTF8)
+	if err != nil {
+		return err
+	}
+	a, err := openApp(home, vm)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+	addr := fs.Arg(0)
+	if _, err := a.state.contract(addr); err != nil {
+		return err
+	}
+	db, err := a.stores.get(addr)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if path != "" && path != "-" {
+		out, err = os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	it, err := db.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	dump := stateDump{Contract: addr, Encoding: *encoding, Entries: []stateEntry{}}
+	enc := json.NewEncoder(w)
+	for ; it.Valid(); it.Next() {
+		entry := codec.entry(it.Key(), it.Value())
+		if f == "jsonl" {
+			if err := enc.Encode(entry); err != nil {
+				return err
+			}
+		} else {
+			dump.Entries = append(dump.Entries, entry)
+		}
+	}
+	// a failed read ends the iteration early, which must not give a truncated dump
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if f == "json" {
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dump); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func runLoad(args []string) error {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	format := fs.String("format", "", "json or jsonl (default: by the extension of FILE)")
+	encoding := fs.String("encoding", "hex", "encoding of keys and values of a jsonl file, a json file names its own")
+	clearFirst := fs.Bool("clear", false, "delete the existing storage of the contract first")
+	fs.Usage = usageFor(fs, "load [flags] CONTRACT FILE",
+		"Imports a dump into the storage of a local contract, overwriting existing keys. "+
+			"The contract must exist, e.g. instantiated from the same code.")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	f, err := formatOf(*format, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	entries, enc, err := readDump(file, f, *encoding)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", fs.Arg(1), err)
+	}
+	codec, err := newStateCodec(enc, false)
+	if err != nil {
+		return err
+	}
+
+	a, err := openApp(home, vm)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+	addr := fs.Arg(0)
+	if _, err := a.state.contract(addr); err != nil {
+		return err
+	}
+	db, err := a.stores.get(addr)
+	if err != nil {
+		return err
+	}
+	if *clearFirst {
+		var keys [][]byte
+		it, err := db.Iterator(nil, nil)
+		if err != nil {
+			return err
+		}
+		for ; it.Valid(); it.Next() {
+			keys = append(keys, it.Key())
+		}
+		err = it.Error()
+		it.Close()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := db.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	for i, entry := range entries {
+		key, value, err := codec.pair(entry)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if err := db.Set(key, value); err != nil {
+			return err
+		}
+	}
+	if err := a.commit(); err != nil {
+		return err
+	}
+	return printJSON(struct {
+		Contract string `json:"contract"`
+		Loaded   int    `json:"loaded"`
+	}{addr, len(entries)})
+}
+
+// readDump returns the entries of a dump and the encoding of their keys and values
+func readDump(r io.Reader, format string, encoding string) ([]stateEntry, string, error) {
+	if format == "json" {
+		var dump stateDump
+		if err := json.NewDecoder(r).Decode(&dump); err != nil {
+			return nil, "", err
+		}
+		if dump.Encoding != "" {
+			encoding = dump.Encoding
+		}
+		return dump.Entries, encoding, nil
+	}
+	var entries []stateEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry stateEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, "", fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, encoding, scanner.Err()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dumpTestHome returns a home with the contracts source and target, both with some storage
+func dumpTestHome(t *testing.T, source, target map[string]string) string {
+	home := tempHome(t)
+	a, err := openApp(&homeOptions{home: home}, testVMOptions())
+	require.NoError(t, err)
+	defer a.close()
+	a.state.Codes = []codeInfo{{ID: 1, Checksum: "abcd"}}
+	for addr, items := range map[string]map[string]string{testAddress(t, "source"): source, testAddress(t, "target"): target} {
+		a.state.Contracts[addr] = &contractInfo{Address: addr, CodeID: 1, Creator: "alice"}
+		db, err := a.stores.get(addr)
+		require.NoError(t, err)
+		for key, value := range items {
+			require.NoError(t, db.Set([]byte(key), []byte(value)))
+		}
+	}
+	require.NoError(t, a.commit())
+	return home
+}
+
+func contractStorage(t *testing.T, home string, addr string) map[string]string {
+	db, err := newContractStores(home).get(addr)
+	require.NoError(t, err)
+	return memDBContents(t, db)
+}
+
+func TestDumpLoad(t *testing.T) {
+	source := map[string]string{
+		"config":            `{"owner":"alice"}`,
+		"\x00\x07balance12": "\x00\x01\x02",
+		"empty":             "",
+		"\xff\xfe":          "text",
+	}
+	target := map[string]string{"config": "old", "stale": "x"}
+
+	cases := map[string]struct {
+		file     string
+		dumpArgs []string
+		loadArgs []string
+		// config is the expected entry of the key config in the dump
+		config stateEntry
+		// expected is the storage of the target after the load
+		expected map[string]string
+	}{
+		"json hex": {
+			file:     "dump.json",
+			config:   stateEntry{Key: "636f6e666967", Value: "7b226f776e6572223a22616c696365227d"},
+			expected: merge(target, source),
+		},
+		"json base64 and clear": {
+			file:     "dump.json",
+			dumpArgs: []string{"-encoding", "base64"},
+			loadArgs: []string{"-clear"},
+			config:   stateEntry{Key: "Y29uZmln", Value: "eyJvd25lciI6ImFsaWNlIn0="},
+			expected: source,
+		},
+		"json utf8": {
+			file:     "dump.json",
+			dumpArgs: []string{"-utf8"},
+			loadArgs: []string{"-clear"},
+			config:   stateEntry{KeyUTF8: strPtr("config"), ValueUTF8: strPtr(`{"owner":"alice"}`)},
+			expected: source,
+		},
+		"jsonl hex": {
+			file:     "dump.jsonl",
+			config:   stateEntry{Key: "636f6e666967", Value: "7b226f776e6572223a22616c696365227d"},
+			expected: merge(target, source),
+		},
+		"jsonl base64 utf8 and clear": {
+			file:     "dump.jsonl",
+			dumpArgs: []string{"-encoding", "base64", "-utf8"},
+			loadArgs: []string{"-encoding", "base64", "-clear"},
+			config:   stateEntry{KeyUTF8: strPtr("config"), ValueUTF8: strPtr(`{"owner":"alice"}`)},
+			expected: source,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			home := dumpTestHome(t, source, target)
+			path := filepath.Join(home, tc.file)
+			args := append([]string{"-home", home}, tc.dumpArgs...)
+			require.NoError(t, runDump(append(args, testAddress(t, "source"), path)))
+
+			bz, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			f, err := formatOf("", path)
+			require.NoError(t, err)
+			entries, _, err := readDump(bytes.NewReader(bz), f, "hex")
+			require.NoError(t, err)
+			require.Len(t, entries, len(source))
+			// the entries are sorted by key
+			assert.Equal(t, tc.config, entries[1])
+
+			args = append([]string{"-home", home}, tc.loadArgs...)
+			require.NoError(t, runLoad(append(args, testAddress(t, "target"), path)))
+			assert.Equal(t, tc.expected, contractStorage(t, home, testAddress(t, "target")))
+			assert.Equal(t, source, contractStorage(t, home, testAddress(t, "source")))
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := map[string]struct {
+		file    string
+		content string
+		err     string
+	}{
+		"invalid hex": {
+			file:    "dump.jsonl",
+			content: `{"key":"01","value":"zz"}`,
+			err:     `entry 1: value of key "01": encoding/hex: invalid byte: U+007A 'z'`,
+		},
+		"no key": {
+			file:    "dump.jsonl",
+			content: `{"key":"01","value":"02"}` + "\n\n" + `{"value":"02"}`,
+			err:     "entry 2: entry without key",
+		},
+		"invalid line": {
+			file:    "dump.jsonl",
+			content: `{"key":"01","value":"02"}` + "\n{",
+			err:     "line 2: unexpected end of JSON input",
+		},
+		"unknown encoding": {
+			file:    "dump.json",
+			content: `{"encoding":"base32","entries":[]}`,
+			err:     `unknown encoding "base32", use hex or base64`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			home := dumpTestHome(t, nil, map[string]string{"stale": "x"})
+			path := filepath.Join(home, tc.file)
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.content), 0644))
+			err := runLoad([]string{"-home", home, "-clear", testAddress(t, "target"), path})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+			// nothing was committed
+			assert.Equal(t, map[string]string{"stale": "x"}, contractStorage(t, home, testAddress(t, "target")))
+		})
+	}
+}
+
+func merge(maps ...map[string]string) map[string]string {
+	res := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func strPtr(s string) *string {
+	return &s
+}
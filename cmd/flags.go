@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CosmWasm/go-cosmwasm/schema"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// errUsage is returned after printing the usage of a command, main exits without printing it again
+var errUsage = errors.New("usage")
+
+// homeOptions selects the local state directory
+type homeOptions struct {
+	home string
+}
+
+func addHomeFlags(fs *flag.FlagSet) *homeOptions {
+	opts := &homeOptions{}
+	defaultHome := os.Getenv("WASMCLI_HOME")
+	if defaultHome == "" {
+		defaultHome = ".wasmcli"
+	}
+	fs.StringVar(&opts.home, "home", defaultHome, "local state directory (default from $WASMCLI_HOME)")
+	return opts
+}
+
+func ensureHome(home string) error {
+	return os.MkdirAll(home, 0755)
+}
+
+// vmOptions configure the Wasmer and the GoAPI
+type vmOptions struct {
+	features  string
+	prefix    string
+	gasLimit  uint64
+	cacheSize uint64
+}
+
+func addVMFlags(fs *flag.FlagSet) *vmOptions {
+	opts := &vmOptions{}
+	fs.StringVar(&opts.features, "features", "staking", "comma separated features supported by the chain")
+	fs.StringVar(&opts.prefix, "prefix", "terra", "bech32 prefix of addresses")
+	fs.Uint64Var(&opts.gasLimit, "gas-limit", 100_000_000, "gas limit of the call (VM gas)")
+	fs.Uint64Var(&opts.cacheSize, "cache-size", 0, "number of prepared contracts kept in memory")
+	return opts
+}
+
+// envOptions are the fields of the types.Env passed to the contract
+type envOptions struct {
+	height  uint64
+	time    int64
+	chainID string
+	sender  string
+	funds   string
+}
+
+func addEnvFlags(fs *flag.FlagSet, withMessage bool) *envOptions {
+	opts := &envOptions{}
+	fs.Uint64Var(&opts.height, "height", 0, "block height (default: the next height of the local chain)")
+	fs.Int64Var(&opts.time, "time", 0, "block time in seconds since the unix epoch (default: now)")
+	fs.StringVar(&opts.chainID, "chain-id", "localnet", "chain id")
+	if withMessage {
+		fs.StringVar(&opts.sender, "sender", "", "address of the sender (required)")
+		fs.StringVar(&opts.funds, "funds", "", "coins sent with the message, e.g. 100uluna,5ukrw")
+	}
+	return opts
+}
+
+// block returns the block info for a call, at defaultHeight unless -height is set
+func (o *envOptions) block(defaultHeight uint64) types.BlockInfo {
+	height := o.height
+	if height == 0 {
+		height = defaultHeight
+	}
+	t := o.time
+	if t == 0 {
+		t = time.Now().Unix()
+	}
+	return types.BlockInfo{
+		Height:  height,
+		Time:    uint64(t),
+		ChainID: o.chainID,
+	}
+}
+
+func (o *envOptions) message() (types.MessageInfo, error) {
+	if o.sender == "" {
+		return types.MessageInfo{}, errors.New("-sender is required")
+	}
+	funds, err := parseCoins(o.funds)
+	if err != nil {
+		return types.MessageInfo{}, err
+	}
+	return types.MessageInfo{
+		Sender:    o.sender,
+		SentFunds: funds,
+	}, nil
+}
+
+// addSchemaFlag adds -schema, the schema directory of the contract to check messages against
+func addSchemaFlag(fs *flag.FlagSet) *string {
+	return fs.String("schema", "", "schema directory of the contract, messages are validated against it before the call")
+}
+
+// checkMsg validates a message against the schema of its kind in dir, if a dir is given
+func checkMsg(dir string, kind string, msg []byte) error {
+	if dir == "" {
+		return nil
+	}
+	set, err := schema.LoadDir(dir)
+	if err != nil {
+		return err
+	}
+	return set.Validate(kind, msg)
+}
+
+// readMsg returns a JSON message given on the command line, or read from a file if it starts with @
+func readMsg(arg string) ([]byte, error) {
+	var msg []byte
+	if strings.HasPrefix(arg, "@") {
+		bz, err := ioutil.ReadFile(arg[1:])
+		if err != nil {
+			return nil, err
+		}
+		msg = bz
+	} else {
+		msg = []byte(arg)
+	}
+	if !json.Valid(msg) {
+		return nil, fmt.Errorf("message is not valid JSON: %s", msg)
+	}
+	return msg, nil
+}
+
+func usageFor(fs *flag.FlagSet, synopsis string, description string) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: wasmcli %s\n\n%s\n\nFlags:\n", synopsis, description)
+		fs.PrintDefaults()
+	}
+}
+
+func printJSON(v interface{}) error {
+	bz, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bz))
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+func TestEnvFlags(t *testing.T) {
+	cases := map[string]struct {
+		args    []string
+		block   types.BlockInfo
+		message types.MessageInfo
+		err     string
+	}{
+		"defaults": {
+			args:  []string{"-sender", "alice"},
+			block: types.BlockInfo{Height: 5, ChainID: "localnet"},
+			message: types.MessageInfo{
+				Sender:    "alice",
+				SentFunds: types.Coins{},
+			},
+		},
+		"all set": {
+			args:  []string{"-height", "17", "-time", "1600000000", "-chain-id", "testnet", "-sender", "bob", "-funds", "3ukrw,100uluna"},
+			block: types.BlockInfo{Height: 17, Time: 1600000000, ChainID: "testnet"},
+			message: types.MessageInfo{
+				Sender:    "bob",
+				SentFunds: types.Coins{types.NewCoin(3, "ukrw"), types.NewCoin(100, "uluna")},
+			},
+		},
+		"no sender": {
+			args:  nil,
+			block: types.BlockInfo{Height: 5, ChainID: "localnet"},
+			err:   "-sender is required",
+		},
+		"invalid funds": {
+			args:  []string{"-sender", "alice", "-funds", "lots"},
+			block: types.BlockInfo{Height: 5, ChainID: "localnet"},
+			err:   `invalid coin "lots", expected e.g. 100uluna`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			opts := addEnvFlags(fs, true)
+			require.NoError(t, fs.Parse(tc.args))
+
+			block := opts.block(5)
+			if tc.block.Time == 0 {
+				// the time defaults to now
+				assert.InDelta(t, time.Now().Unix(), int64(block.Time), 5)
+				block.Time = 0
+			}
+			assert.Equal(t, tc.block, block)
+
+			message, err := opts.message()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.message, message)
+		})
+	}
+}
+
+func TestEnvFlagsWithoutMessage(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	addEnvFlags(fs, false)
+	assert.Error(t, fs.Parse([]string{"-sender", "alice"}), "queries have no sender")
+}
+
+func TestReadMsg(t *testing.T) {
+	path := filepath.Join(tempHome(t), "msg.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"from":"file"}`), 0644))
+
+	cases := map[string]struct {
+		arg      string
+		expected string
+		err      bool
+	}{
+		"inline":       {arg: `{"release":{}}`, expected: `{"release":{}}`},
+		"file":         {arg: "@" + path, expected: `{"from":"file"}`},
+		"missing file": {arg: "@" + path + ".missing", err: true},
+		"invalid":      {arg: `{"release":`, err: true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			msg, err := readMsg(tc.arg)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(msg))
+		})
+	}
+}
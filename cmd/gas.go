@@ -0,0 +1,118 @@
+package main
+
+import (
+	dbm "github.com/tendermint/tm-db"
+
+	wasm "github.com/CosmWasm/go-cosmwasm"
+)
+
+// Storage gas costs of the Cosmos SDK KVStore, so contracts see realistic numbers
+const (
+	readCostFlat     = 1000
+	readCostPerByte  = 3
+	writeCostFlat    = 2000
+	writeCostPerByte = 30
+	deleteCost       = 1000
+	iterNextCostFlat = 30
+)
+
+// gasMeter counts the gas charged by the storage of one command
+type gasMeter struct {
+	consumed uint64
+}
+
+var _ wasm.GasMeter = (*gasMeter)(nil)
+
+func (m *gasMeter) GasConsumed() uint64 {
+	return m.consumed
+}
+
+func (m *gasMeter) consume(amount uint64) {
+	m.consumed += amount
+}
+
+// accessStats counts the storage accesses and queries of contract calls, for the profiler
+type accessStats struct {
+	Reads        uint64 `json:"reads"`
+	Writes       uint64 `json:"writes"`
+	Deletes      uint64 `json:"deletes"`
+	BytesWritten uint64 `json:"bytes_written"`
+	Queries      uint64 `json:"queries"`
+}
+
+// gasStore is a wasm.KVStore over a working copy of a contract storage, which charges gas like the SDK.
+// The working copy is a MemDB, so errors are not expected and cause a panic like in the SDK.
+type gasStore struct {
+	db    dbm.DB
+	meter *gasMeter
+	stats *accessStats
+}
+
+var _ wasm.KVStore = gasStore{}
+
+func (s gasStore) Get(key []byte) []byte {
+	s.meter.consume(readCostFlat)
+	s.stats.Reads++
+	value, err := s.db.Get(key)
+	if err != nil {
+		panic(err)
+	}
+	s.meter.consume(readCostPerByte * uint64(len(value)))
+	return value
+}
+
+func (s gasStore) Set(key, value []byte) {
+	s.meter.consume(writeCostFlat + writeCostPerByte*uint64(len(key)+len(value)))
+	s.stats.Writes++
+	s.stats.BytesWritten += uint64(len(key) + len(value))
+	if err := s.db.Set(key, value); err != nil {
+		panic(err)
+	}
+}
+
+func (s gasStore) Delete(key []byte) {
+	s.meter.consume(deleteCost)
+	s.stats.Deletes++
+	if err := s.db.Delete(key); err != nil {
+		panic(err)
+	}
+}
+
+func (s gasStore) Iterator(start, end []byte) dbm.Iterator {
+	it, err := s.db.Iterator(start, end)
+	if err != nil {
+		panic(err)
+	}
+	return &gasIterator{Iterator: it, meter: s.meter, stats: s.stats}
+}
+
+func (s gasStore) ReverseIterator(start, end []byte) dbm.Iterator {
+	it, err := s.db.ReverseIterator(start, end)
+	if err != nil {
+		panic(err)
+	}
+	return &gasIterator{Iterator: it, meter: s.meter, stats: s.stats}
+}
+
+// gasIterator charges for every item read
+type gasIterator struct {
+	dbm.Iterator
+	meter *gasMeter
+	stats *accessStats
+}
+
+func (it *gasIterator) Next() {
+	if it.Valid() {
+		it.meter.consume(iterNextCostFlat + readCostPerByte*uint64(len(it.Key())+len(it.Value())))
+		it.stats.Reads++
+	}
+	it.Iterator.Next()
+}
+
+// vmGasMultiplier is the VM gas per SDK gas, as in the wasm module of the chain
+const vmGasMultiplier = 100
+
+// sdkGas is the gas a transaction would be charged for a contract call
+func sdkGas(vmGas uint64, storageGas uint64) uint64 {
+	return vmGas/vmGasMultiplier + storageGas
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	wasm "github.com/CosmWasm/go-cosmwasm"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// entryPoints are the exports the VM calls, in the order they are reported
+var entryPoints = []string{"init", "handle", "query", "migrate", "allocate", "deallocate"}
+
+// wasmPageSize is the size of a wasm memory page in bytes
+const wasmPageSize = 65536
+
+// inspectReport is the static report printed by inspect
+type inspectReport struct {
+	// CodeID is the hex encoded checksum, as returned by Wasmer.Create
+	CodeID           string        `json:"code_id"`
+	Size             int           `json:"size"`
+	InterfaceVersion string        `json:"interface_version"`
+	EntryPoints      []string      `json:"entry_points"`
+	Exports          []string      `json:"exports"`
+	Imports          []string      `json:"imports"`
+	RequiredFeatures []string      `json:"required_features"`
+	MissingFeatures  []string      `json:"missing_features"`
+	Memories         []memoryLimit `json:"memories"`
+	Valid            bool          `json:"valid"`
+	// ValidationError is the reason the VM rejected the code
+	ValidationError string `json:"validation_error,omitempty"`
+}
+
+type memoryLimit struct {
+	MinPages uint32 `json:"min_pages"`
+	// MaxPages is nil if the memory can grow without limit
+	MaxPages *uint32 `json:"max_pages"`
+	Imported bool    `json:"imported"`
+}
+
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = usageFor(fs, "inspect [flags] FILE.wasm|CODE_ID",
+		"Prints a static report on wasm code, read from a file or stored under CODE_ID. "+
+			"Nothing is written to the local state.")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	code, err := readCode(home, vm, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	report, err := inspect(code, vm.features)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(report)
+	}
+	report.print(os.Stdout)
+	return nil
+}
+
+// readCode reads wasm code from a file, or from the state if arg is a code id and no such file exists
+func readCode(home *homeOptions, vm *vmOptions, arg string) ([]byte, error) {
+	id, parseErr := strconv.ParseUint(arg, 10, 64)
+	if _, statErr := os.Stat(arg); parseErr != nil || statErr == nil {
+		return ioutil.ReadFile(arg)
+	}
+	a, err := openApp(home, vm)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+	codeID, err := a.codeID(id)
+	if err != nil {
+		return nil, err
+	}
+	return a.wasmer.GetCode(codeID)
+}
+
+// inspect validates the code with a throwaway Wasmer, so that nothing is stored in the local state
+func inspect(code []byte, supportedFeatures string) (*inspectReport, error) {
+	report, err := analyze(code, supportedFeatures)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "wasmcli-inspect")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	wasmer, err := wasm.NewWasmer(dir, supportedFeatures, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer wasmer.Cleanup()
+	id, err := wasmer.Create(code)
+	if err != nil {
+		report.ValidationError = err.Error()
+	} else {
+		report.Valid = true
+		report.CodeID = hex.EncodeToString(id)
+	}
+	return report, nil
+}
+
+// analyze builds the parts of the report that are read from the code without the VM
+func analyze(code []byte, supportedFeatures string) (*inspectReport, error) {
+	module, err := types.ParseModule(code)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(code)
+	report := &inspectReport{
+		CodeID:           hex.EncodeToString(checksum[:]),
+		Size:             len(code),
+		EntryPoints:      []string{},
+		Exports:          nonNil(module.Exports),
+		Imports:          nonNil(module.ImportedFunctions()),
+		RequiredFeatures: nonNil(module.RequiredFeatures()),
+		MissingFeatures:  []string{},
+		Memories:         []memoryLimit{},
+	}
+	if version, err := types.DetectInterfaceVersion(module.ExportedFunctions); err == nil {
+		report.InterfaceVersion = version.String()
+	} else {
+		report.InterfaceVersion = "unknown"
+	}
+	for _, name := range entryPoints {
+		for _, fn := range module.ExportedFunctions {
+			if fn == name {
+				report.EntryPoints = append(report.EntryPoints, name)
+			}
+		}
+	}
+	supported := make(map[string]bool)
+	for _, f := range strings.Split(supportedFeatures, ",") {
+		supported[strings.TrimSpace(f)] = true
+	}
+	for _, f := range report.RequiredFeatures {
+		if !supported[f] {
+			report.MissingFeatures = append(report.MissingFeatures, f)
+		}
+	}
+	for _, m := range module.Memories {
+		report.Memories = append(report.Memories, memoryLimit{MinPages: m.Min, MaxPages: m.Max, Imported: m.Imported})
+	}
+	return report, nil
+}
+
+func (r *inspectReport) print(w io.Writer) {
+	fmt.Fprintf(w, "Code ID:            %s\n", r.CodeID)
+	fmt.Fprintf(w, "Size:               %d bytes\n", r.Size)
+	fmt.Fprintf(w, "Interface version:  %s\n", r.InterfaceVersion)
+	fmt.Fprintf(w, "Entry points:       %s\n", listOrNone(r.EntryPoints))
+	fmt.Fprintf(w, "Required features:  %s\n", listOrNone(r.RequiredFeatures))
+	if len(r.MissingFeatures) > 0 {
+		fmt.Fprintf(w, "Missing features:   %s\n", strings.Join(r.MissingFeatures, ", "))
+	}
+	fmt.Fprintf(w, "Memories:\n")
+	if len(r.Memories) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	for _, m := range r.Memories {
+		max := "unlimited"
+		if m.MaxPages != nil {
+			max = fmt.Sprintf("%d pages (%d KiB)", *m.MaxPages, uint64(*m.MaxPages)*wasmPageSize/1024)
+		}
+		imported := ""
+		if m.Imported {
+			imported = " (imported)"
+		}
+		fmt.Fprintf(w, "  min %d pages (%d KiB), max %s%s\n", m.MinPages, uint64(m.MinPages)*wasmPageSize/1024, max, imported)
+	}
+	fmt.Fprintf(w, "Imported functions:\n")
+	if len(r.Imports) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	for _, imp := range r.Imports {
+		fmt.Fprintf(w, "  %s\n", imp)
+	}
+	if r.Valid {
+		fmt.Fprintf(w, "Static validation:  passed\n")
+	} else {
+		fmt.Fprintf(w, "Static validation:  FAILED: %s\n", r.ValidationError)
+	}
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+// nonNil makes empty lists show up as [] rather than null in JSON
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
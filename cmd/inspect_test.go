@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inspectModule assembles a small module with an import, a memory of 2 to 3 pages, the entry points
+// init and query, interface version 4 and the required features staking and stargate.
+// The functions do nothing, the module is only read.
+func inspectModule() []byte {
+	export := func(name string, kind byte, idx byte) []byte {
+		return cat(wasmName(name), []byte{kind, idx})
+	}
+	emptyBody := []byte{0x02, 0x00, 0x0b}
+	return cat(
+		[]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00},
+		// types: 0 ()->()
+		wasmSection(1, 1, []byte{0x60, 0x00, 0x00}),
+		// imports: function 0
+		wasmSection(2, 1, cat(wasmName("env"), wasmName("db_read"), []byte{0x00, 0})),
+		// functions 1 to 4
+		wasmSection(3, 4, []byte{0, 0, 0, 0}),
+		// memory with 2 pages and a maximum of 3
+		wasmSection(5, 1, []byte{0x01, 0x02, 0x03}),
+		wasmSection(7, 6,
+			export("memory", 0x02, 0),
+			export("init", 0x00, 1),
+			export("query", 0x00, 2),
+			export("cosmwasm_vm_version_4", 0x00, 3),
+			export("requires_staking", 0x00, 4),
+			export("requires_stargate", 0x00, 4),
+		),
+		wasmSection(10, 4, emptyBody, emptyBody, emptyBody, emptyBody),
+	)
+}
+
+func wasmSection(id byte, count int, items ...[]byte) []byte {
+	contents := wasmVec(count, items...)
+	return cat([]byte{id}, uleb(uint32(len(contents))), contents)
+}
+
+func wasmVec(count int, items ...[]byte) []byte {
+	return cat(uleb(uint32(count)), cat(items...))
+}
+
+func wasmName(name string) []byte {
+	return wasmVec(len(name), []byte(name))
+}
+
+func uleb(n uint32) []byte {
+	var res []byte
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(res, b)
+		}
+		res = append(res, b|0x80)
+	}
+}
+
+func cat(parts ...[]byte) []byte {
+	var res []byte
+	for _, p := range parts {
+		res = append(res, p...)
+	}
+	return res
+}
+
+func TestAnalyze(t *testing.T) {
+	code := inspectModule()
+	checksum := sha256.Sum256(code)
+	maxPages := uint32(3)
+
+	cases := map[string]struct {
+		features string
+		missing  []string
+	}{
+		"one missing":  {features: "staking", missing: []string{"stargate"}},
+		"all":          {features: "stargate, staking", missing: []string{}},
+		"none":         {features: "", missing: []string{"staking", "stargate"}},
+		"other prefix": {features: "stakingX,stargate", missing: []string{"staking"}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			report, err := analyze(code, tc.features)
+			require.NoError(t, err)
+			assert.Equal(t, &inspectReport{
+				CodeID:           hex.EncodeToString(checksum[:]),
+				Size:             len(code),
+				InterfaceVersion: "4",
+				EntryPoints:      []string{"init", "query"},
+				Exports:          []string{"memory", "init", "query", "cosmwasm_vm_version_4", "requires_staking", "requires_stargate"},
+				Imports:          []string{"env.db_read"},
+				RequiredFeatures: []string{"staking", "stargate"},
+				MissingFeatures:  tc.missing,
+				Memories:         []memoryLimit{{MinPages: 2, MaxPages: &maxPages}},
+			}, report)
+		})
+	}
+
+	_, err := analyze([]byte("not wasm"), "staking")
+	assert.Error(t, err)
+}
+
+func TestInspectReportPrint(t *testing.T) {
+	report, err := analyze(inspectModule(), "staking")
+	require.NoError(t, err)
+	report.ValidationError = "no handle export"
+
+	var out bytes.Buffer
+	report.print(&out)
+	assert.Equal(t, "Code ID:            "+report.CodeID+"\n"+
+		fmt.Sprintf("Size:               %d bytes\n", report.Size)+
+		"Interface version:  4\n"+
+		"Entry points:       init, query\n"+
+		"Required features:  staking, stargate\n"+
+		"Missing features:   stargate\n"+
+		"Memories:\n"+
+		"  min 2 pages (128 KiB), max 3 pages (192 KiB)\n"+
+		"Imported functions:\n"+
+		"  env.db_read\n"+
+		"Static validation:  FAILED: no handle export\n", out.String())
+
+	// a module without memories, imports and version
+	report, err = analyze([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, "staking")
+	require.NoError(t, err)
+	report.Valid = true
+	out.Reset()
+	report.print(&out)
+	assert.Contains(t, out.String(), "Interface version:  unknown\nEntry points:       none\nRequired features:  none\n"+
+		"Memories:\n  none\nImported functions:\n  none\nStatic validation:  passed\n")
+}
+
+func TestInspectReportsValidationError(t *testing.T) {
+	// the VM rejects the module, it has no handle, allocate and deallocate exports
+	report, err := inspect(inspectModule(), "staking")
+	require.NoError(t, err)
+	assert.False(t, report.Valid)
+	assert.NotEmpty(t, report.ValidationError)
+	assert.Equal(t, []string{"stargate"}, report.MissingFeatures)
+}
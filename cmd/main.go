@@ -1,34 +1,69 @@
+// wasmcli runs contracts against a local state directory, without a chain. See `wasmcli help`.
 package main
 
 import (
 	"fmt"
-	wasm "github.com/CosmWasm/go-cosmwasm"
-	"io/ioutil"
 	"os"
+	"sort"
 )
 
-// This is just a demo to ensure we can compile a static go binary
-func main() {
-	file := os.Args[1]
-	fmt.Printf("Running %s...\n", file)
-	bz, err := ioutil.ReadFile(file)
-	if err != nil {
-		panic(err)
-	}
-	fmt.Println("Loaded!")
+type command struct {
+	run         func(args []string) error
+	description string
+}
 
-	os.MkdirAll("tmp", 0755)
-	wasmer, err := wasm.NewWasmer("tmp", "staking", 0)
-	if err != nil {
-		panic(err)
-	}
+var commands = map[string]command{
+	"store":       {runStore, "store wasm code"},
+	"instantiate": {runInstantiate, "instantiate a contract from stored code"},
+	"execute":     {runExecute, "execute a contract"},
+	"query":       {runQuery, "run a smart query on a contract"},
+	"repl":        {runRepl, "start an interactive session on an in-memory state"},
+	"replay":      {runReplay, "re-execute recorded calls and report divergences"},
+	"serve":       {runServe, "serve the local contracts over HTTP like the REST server of a node"},
+	"migrate":     {runMigrate, "migrate a contract to new code"},
+	"bank":        {runBank, "set or show balances of the mock bank"},
+	"dump":        {runDump, "export the storage of a contract"},
+	"load":        {runLoad, "import a storage dump into a contract"},
+	"inspect":     {runInspect, "print a static report on wasm code"},
+	"profile":     {runProfile, "report the gas of a scenario, or compare two builds"},
+	"schema":      {runSchema, "validate messages against the JSON schemas of a contract"},
+	"cache":       {runCache, "list, verify or prune the Wasmer data directory"},
+	"bench":       {runBench, "benchmark a message with a cold, warm and hot VM cache"},
+}
 
-	id, err := wasmer.Create(bz)
-	if err != nil {
-		panic(err)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: wasmcli COMMAND [flags] [args]\n\nRuns contracts against a local state directory.\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].description)
 	}
-	fmt.Printf("Got code id: %X\n", id)
+	fmt.Fprintf(os.Stderr, "\nRun `wasmcli COMMAND -h` for the flags of a command.\n")
+}
 
-	wasmer.Cleanup()
-	fmt.Println("finished")
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if err != errUsage {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// scenario is a sequence of contract calls to profile, read from a JSON or YAML file:
+//
+//	env:
+//	  height: 100
+//	  time: 1600000000
+//	balances:
+//	  terra1...: 1000uluna
+//	steps:
+//	  - name: init
+//	    instantiate: {sender: terra1..., msg: {...}}
+//	  - name: transfer
+//	    execute: {contract: init, sender: terra1..., funds: 10uluna, msg: {...}}
+//	  - name: balance
+//	    query: {contract: init, msg: {...}}
+type scenario struct {
+	Env scenarioEnv `json:"env"`
+	// Balances are set in the mock bank before the first step
+	Balances map[string]string `json:"balances"`
+	// Codes are stored after the profiled code, as code ids 2, 3, ...
+	// Relative paths are relative to the scenario file.
+	Codes []string       `json:"codes"`
+	Steps []scenarioStep `json:"steps"`
+}
+
+type scenarioEnv struct {
+	// Height is the block height of the first step, every instantiate and execute step starts a new block
+	Height  uint64 `json:"height"`
+	Time    uint64 `json:"time"`
+	ChainID string `json:"chain_id"`
+}
+
+// scenarioStep has exactly one of Instantiate, Execute and Query set
+type scenarioStep struct {
+	Name        string        `json:"name"`
+	Instantiate *scenarioCall `json:"instantiate"`
+	Execute     *scenarioCall `json:"execute"`
+	Query       *scenarioCall `json:"query"`
+}
+
+type scenarioCall struct {
+	// CodeID is the code to instantiate, the profiled code by default
+	CodeID uint64 `json:"code_id"`
+	// Contract is the name of an instantiate step or an address, the last instantiated contract by default
+	Contract string          `json:"contract"`
+	Sender   string          `json:"sender"`
+	Funds    string          `json:"funds"`
+	Label    string          `json:"label"`
+	Admin    string          `json:"admin"`
+	Msg      json.RawMessage `json:"msg"`
+}
+
+// action returns the name and the call of the action the step sets
+func (s *scenarioStep) action() (string, *scenarioCall, error) {
+	switch {
+	case s.Instantiate != nil && s.Execute == nil && s.Query == nil:
+		return "instantiate", s.Instantiate, nil
+	case s.Execute != nil && s.Instantiate == nil && s.Query == nil:
+		return "execute", s.Execute, nil
+	case s.Query != nil && s.Instantiate == nil && s.Execute == nil:
+		return "query", s.Query, nil
+	default:
+		return "", nil, errors.New("needs exactly one of instantiate, execute and query")
+	}
+}
+
+// default block of a scenario, so the gas of runs can be compared
+const (
+	scenarioHeight  = 1
+	scenarioTime    = 1_600_000_000
+	scenarioChainID = "localnet"
+)
+
+func loadScenario(path string) (*scenario, error) {
+	bz, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// YAML is a superset of JSON, so both are read as YAML and converted to JSON for the messages
+	var raw yamlValue
+	if err := yaml.Unmarshal(bz, &raw); err != nil {
+		return nil, fmt.Errorf("reading scenario: %w", err)
+	}
+	bz, err = json.Marshal(raw.v)
+	if err != nil {
+		return nil, fmt.Errorf("reading scenario: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(bz))
+	dec.DisallowUnknownFields()
+	var sc scenario
+	if err := dec.Decode(&sc); err != nil {
+		return nil, fmt.Errorf("reading scenario: %w", err)
+	}
+	if len(sc.Steps) == 0 {
+		return nil, errors.New("scenario has no steps")
+	}
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+		if _, _, err := step.action(); err != nil {
+			return nil, fmt.Errorf("reading scenario: %s: %w", step.Name, err)
+		}
+	}
+	for i, code := range sc.Codes {
+		if !filepath.IsAbs(code) {
+			sc.Codes[i] = filepath.Join(filepath.Dir(path), code)
+		}
+	}
+	return &sc, nil
+}
+
+// yamlValue is a YAML value as encoding/json would decode the same JSON. Maps get string keys, and only
+// true and false are booleans, as in YAML 1.2, so plain scalars like yes, no, on and off stay strings.
+type yamlValue struct {
+	v interface{}
+}
+
+func (y *yamlValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	switch v.(type) {
+	case map[interface{}]interface{}:
+		var items map[string]yamlValue
+		if err := unmarshal(&items); err != nil {
+			return err
+		}
+		obj := make(map[string]interface{}, len(items))
+		for key, item := range items {
+			obj[key] = item.v
+		}
+		y.v = obj
+	case []interface{}:
+		var items []yamlValue
+		if err := unmarshal(&items); err != nil {
+			return err
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = item.v
+		}
+		y.v = list
+	case bool:
+		var s string
+		if err := unmarshal(&s); err != nil {
+			return err
+		}
+		if strings.EqualFold(s, "true") || strings.EqualFold(s, "false") {
+			y.v = v
+		} else {
+			y.v = s
+		}
+	default:
+		y.v = v
+	}
+	return nil
+}
+
+// stepProfile are the numbers measured for one step
+type stepProfile struct {
+	Step   string `json:"step"`
+	Action string `json:"action"`
+	// GasUsed is the VM gas, StorageGas the SDK gas charged by the storage
+	GasUsed      uint64 `json:"gas_used"`
+	StorageGas   uint64 `json:"storage_gas"`
+	ResponseSize int    `json:"response_size"`
+	accessStats
+}
+
+type profileRun struct {
+	Code     string        `json:"code"`
+	Checksum string        `json:"checksum"`
+	Steps    []stepProfile `json:"steps"`
+}
+
+// runScenario runs all steps against a fresh in-memory state, nothing is kept after it returns
+func runScenario(vm *vmOptions, sc *scenario, path string) (*profileRun, error) {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := openMemoryApp(vm)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	info, err := a.store("", code)
+	if err != nil {
+		return nil, fmt.Errorf("storing %s: %w", path, err)
+	}
+	for _, extra := range sc.Codes {
+		bz, err := ioutil.ReadFile(extra)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := a.store("", bz); err != nil {
+			return nil, fmt.Errorf("storing %s: %w", extra, err)
+		}
+	}
+	for addr, amount := range sc.Balances {
+		coins, err := parseCoins(amount)
+		if err != nil {
+			return nil, err
+		}
+		a.state.Balances[addr] = coins
+	}
+
+	block := types.BlockInfo{Height: sc.Env.Height, Time: sc.Env.Time, ChainID: sc.Env.ChainID}
+	if block.Height == 0 {
+		block.Height = scenarioHeight
+	}
+	if block.Time == 0 {
+		block.Time = scenarioTime
+	}
+	if block.ChainID == "" {
+		block.ChainID = scenarioChainID
+	}
+
+	run := &profileRun{Code: path, Checksum: info.Checksum}
+	contracts := make(map[string]string)
+	last := ""
+	for _, step := range sc.Steps {
+		// every step gets the full gas limit and its own counters
+		a.gasUsed = 0
+		a.meter = &gasMeter{}
+		a.stats = accessStats{}
+		a.block = block
+
+		action, call, err := step.action()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, step.Name, err)
+		}
+		profile := stepProfile{Step: step.Name, Action: action}
+		switch action {
+		case "instantiate":
+			profile.ResponseSize, last, err = a.runInstantiateStep(call)
+			contracts[step.Name] = last
+			block.Height++
+		case "execute":
+			profile.ResponseSize, err = a.runExecuteStep(call, contractOf(call, contracts, last))
+			block.Height++
+		case "query":
+			var res []byte
+			res, err = a.query(contractOf(call, contracts, last), call.Msg, vm.gasLimit, nil)
+			profile.ResponseSize = len(res)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, step.Name, err)
+		}
+		profile.GasUsed = a.gasUsed
+		profile.StorageGas = a.meter.GasConsumed()
+		profile.accessStats = a.stats
+		run.Steps = append(run.Steps, profile)
+	}
+	return run, nil
+}
+
+// contractOf returns the address the call refers to, see scenarioCall.Contract
+func contractOf(call *scenarioCall, contracts map[string]string, last string) string {
+	if call.Contract == "" {
+		return last
+	}
+	if addr, ok := contracts[call.Contract]; ok {
+		return addr
+	}
+	return call.Contract
+}
+
+func (a *app) runInstantiateStep(call *scenarioCall) (int, string, error) {
+	funds, err := a.checkCall(call)
+	if err != nil {
+		return 0, "", err
+	}
+	codeID := call.CodeID
+	if codeID == 0 {
+		codeID = 1
+	}
+	res, err := a.instantiate(codeID, call.Sender, funds, call.Msg, call.Label, call.Admin)
+	if err != nil {
+		return 0, "", err
+	}
+	return responseSize(res), res.Contract, nil
+}
+
+func (a *app) runExecuteStep(call *scenarioCall, contract string) (int, error) {
+	funds, err := a.checkCall(call)
+	if err != nil {
+		return 0, err
+	}
+	res, err := a.execute(contract, call.Sender, funds, call.Msg)
+	if err != nil {
+		return 0, err
+	}
+	return responseSize(res), nil
+}
+
+// checkCall validates the sender of a call and returns its funds
+func (a *app) checkCall(call *scenarioCall) (types.Coins, error) {
+	if err := a.validateAddress(call.Sender); err != nil {
+		return nil, fmt.Errorf("sender: %w", err)
+	}
+	return parseCoins(call.Funds)
+}
+
+// responseSize is the size of what the contract returned, without the events of dispatched messages
+func responseSize(res *callResult) int {
+	bz, _ := json.Marshal(struct {
+		Data     []byte               `json:"data,omitempty"`
+		Log      []types.LogAttribute `json:"log,omitempty"`
+		Messages []types.CosmosMsg    `json:"messages,omitempty"`
+	}{res.Data, res.Log, res.Messages})
+	return len(bz)
+}
+
+// stepComparison compares the gas of a step between two builds, the diffs are B - A
+type stepComparison struct {
+	Step           string `json:"step"`
+	GasA           uint64 `json:"gas_a"`
+	GasB           uint64 `json:"gas_b"`
+	GasDiff        int64  `json:"gas_diff"`
+	StorageGasA    uint64 `json:"storage_gas_a"`
+	StorageGasB    uint64 `json:"storage_gas_b"`
+	StorageGasDiff int64  `json:"storage_gas_diff"`
+}
+
+// compareRuns compares two runs of the same scenario step by step
+func compareRuns(a, b *profileRun) ([]stepComparison, error) {
+	if len(a.Steps) != len(b.Steps) {
+		return nil, fmt.Errorf("%s has %d steps, %s has %d", a.Code, len(a.Steps), b.Code, len(b.Steps))
+	}
+	cmp := make([]stepComparison, len(a.Steps))
+	for i := range a.Steps {
+		sa, sb := a.Steps[i], b.Steps[i]
+		if sa.Step != sb.Step {
+			return nil, fmt.Errorf("step %d is %s in %s and %s in %s", i+1, sa.Step, a.Code, sb.Step, b.Code)
+		}
+		cmp[i] = stepComparison{
+			Step:           sa.Step,
+			GasA:           sa.GasUsed,
+			GasB:           sb.GasUsed,
+			GasDiff:        int64(sb.GasUsed) - int64(sa.GasUsed),
+			StorageGasA:    sa.StorageGas,
+			StorageGasB:    sb.StorageGas,
+			StorageGasDiff: int64(sb.StorageGas) - int64(sa.StorageGas),
+		}
+	}
+	return cmp, nil
+}
+
+func runProfile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	vm := addVMFlags(fs)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = usageFor(fs, "profile [flags] SCENARIO A.wasm [B.wasm]",
+		"Runs the steps of a JSON or YAML scenario against a fresh in-memory state and reports the gas, "+
+			"storage accesses and queries of every step. With two builds it compares their gas.")
+	fs.Parse(args)
+	if fs.NArg() != 2 && fs.NArg() != 3 {
+		fs.Usage()
+		return errUsage
+	}
+
+	sc, err := loadScenario(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var runs []*profileRun
+	for _, path := range fs.Args()[1:] {
+		run, err := runScenario(vm, sc, path)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, run)
+	}
+	var cmp []stepComparison
+	if len(runs) == 2 {
+		if cmp, err = compareRuns(runs[0], runs[1]); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		return printJSON(struct {
+			Runs       []*profileRun    `json:"runs"`
+			Comparison []stepComparison `json:"comparison,omitempty"`
+		}{runs, cmp})
+	}
+	for _, run := range runs {
+		printRun(run)
+	}
+	if cmp != nil {
+		printComparison(cmp)
+	}
+	return nil
+}
+
+func printRun(run *profileRun) {
+	fmt.Printf("%s (%s)\n\n", run.Code, shortChecksum(run.Checksum))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "STEP\tACTION\tGAS\tSTORAGE GAS\tRESPONSE\tREADS\tWRITES\tDELETES\tBYTES WRITTEN\tQUERIES\t")
+	var total stepProfile
+	for _, s := range run.Steps {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n", s.Step, s.Action, s.GasUsed, s.StorageGas,
+			s.ResponseSize, s.Reads, s.Writes, s.Deletes, s.BytesWritten, s.Queries)
+		total.GasUsed += s.GasUsed
+		total.StorageGas += s.StorageGas
+		total.ResponseSize += s.ResponseSize
+		total.Reads += s.Reads
+		total.Writes += s.Writes
+		total.Deletes += s.Deletes
+		total.BytesWritten += s.BytesWritten
+		total.Queries += s.Queries
+	}
+	fmt.Fprintf(w, "TOTAL\t\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n", total.GasUsed, total.StorageGas,
+		total.ResponseSize, total.Reads, total.Writes, total.Deletes, total.BytesWritten, total.Queries)
+	w.Flush()
+	fmt.Println()
+}
+
+func printComparison(cmp []stepComparison) {
+	fmt.Printf("Comparison (B - A)\n\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "STEP\tGAS A\tGAS B\tDIFF\tSTORAGE GAS A\tSTORAGE GAS B\tDIFF\t")
+	var total stepComparison
+	for _, c := range cmp {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%d\t%s\t\n", c.Step, c.GasA, c.GasB, formatDiff(c.GasA, c.GasB),
+			c.StorageGasA, c.StorageGasB, formatDiff(c.StorageGasA, c.StorageGasB))
+		total.GasA += c.GasA
+		total.GasB += c.GasB
+		total.StorageGasA += c.StorageGasA
+		total.StorageGasB += c.StorageGasB
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%s\t%d\t%d\t%s\t\n", total.GasA, total.GasB, formatDiff(total.GasA, total.GasB),
+		total.StorageGasA, total.StorageGasB, formatDiff(total.StorageGasA, total.StorageGasB))
+	w.Flush()
+}
+
+// formatDiff formats b - a with its sign and relative to a
+func formatDiff(a, b uint64) string {
+	diff := int64(b) - int64(a)
+	if a == 0 {
+		return fmt.Sprintf("%+d", diff)
+	}
+	return fmt.Sprintf("%+d (%+.1f%%)", diff, float64(diff)*100/float64(a))
+}
+
+func shortChecksum(checksum string) string {
+	if len(checksum) < 12 {
+		return checksum
+	}
+	return checksum[:12]
+}
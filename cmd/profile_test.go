@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadScenario(t *testing.T) {
+	dir := tempHome(t)
+	cases := map[string]struct {
+		file    string
+		content string
+		// expected is the scenario with the messages as JSON, err the expected error if set
+		expected *scenario
+		msgs     []string
+		err      string
+	}{
+		"yaml": {
+			file: "scenario.yaml",
+			content: `
+env: {height: 100, chain_id: testnet}
+balances:
+  alice: 100uluna
+codes: [other.wasm, /abs/other.wasm]
+steps:
+  - name: init
+    instantiate: {sender: alice, funds: 10uluna, msg: {verifier: bob, count: 3}}
+  - execute: {contract: init, sender: bob, msg: {release: {}}}
+  - query: {msg: {verifier: {}}}
+`,
+			expected: &scenario{
+				Env:      scenarioEnv{Height: 100, ChainID: "testnet"},
+				Balances: map[string]string{"alice": "100uluna"},
+				Codes:    []string{filepath.Join(dir, "other.wasm"), "/abs/other.wasm"},
+				Steps: []scenarioStep{
+					{Name: "init", Instantiate: &scenarioCall{Sender: "alice", Funds: "10uluna"}},
+					{Name: "step 2", Execute: &scenarioCall{Contract: "init", Sender: "bob"}},
+					{Name: "step 3", Query: &scenarioCall{}},
+				},
+			},
+			msgs: []string{`{"verifier":"bob","count":3}`, `{"release":{}}`, `{"verifier":{}}`},
+		},
+		"json": {
+			file:    "scenario.json",
+			content: `{"steps": [{"name": "init", "instantiate": {"code_id": 2, "sender": "alice", "msg": {"list": [1, "two", null]}}}]}`,
+			expected: &scenario{
+				Steps: []scenarioStep{{Name: "init", Instantiate: &scenarioCall{CodeID: 2, Sender: "alice"}}},
+			},
+			msgs: []string{`{"list":[1,"two",null]}`},
+		},
+		"no steps": {
+			file:    "scenario.yaml",
+			content: "env: {height: 1}\n",
+			err:     "scenario has no steps",
+		},
+		"unknown field": {
+			file:    "scenario.yaml",
+			content: "steps:\n  - quey: {msg: {}}\n",
+			err:     `reading scenario: json: unknown field "quey"`,
+		},
+		"two actions": {
+			file:    "scenario.yaml",
+			content: "steps:\n  - name: both\n    execute: {msg: {}}\n    query: {msg: {}}\n",
+			err:     "reading scenario: both: needs exactly one of instantiate, execute and query",
+		},
+		"no action": {
+			file:    "scenario.yaml",
+			content: "steps:\n  - name: nothing\n",
+			err:     "reading scenario: nothing: needs exactly one of instantiate, execute and query",
+		},
+		"invalid yaml": {
+			file:    "scenario.yaml",
+			content: "steps: [",
+			err:     "reading scenario: yaml: line 1: did not find expected node content",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.file)
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.content), 0644))
+			sc, err := loadScenario(path)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, sc.Steps, len(tc.msgs))
+			for i := range sc.Steps {
+				_, call, err := sc.Steps[i].action()
+				require.NoError(t, err)
+				assert.JSONEq(t, tc.msgs[i], string(call.Msg))
+				call.Msg = nil
+			}
+			assert.Equal(t, tc.expected, sc)
+		})
+	}
+}
+
+func TestYAMLValue(t *testing.T) {
+	cases := map[string]struct {
+		yaml string
+		json string
+	}{
+		// YAML 1.1 reads these as booleans, JSON and YAML 1.2 do not
+		"yes and no": {
+			yaml: "{a: yes, b: no, c: Y, d: n}",
+			json: `{"a":"yes","b":"no","c":"Y","d":"n"}`,
+		},
+		"on and off": {
+			yaml: "[on, off, ON]",
+			json: `["on","off","ON"]`,
+		},
+		"booleans": {
+			yaml: "{a: true, b: false, c: True, d: 'true'}",
+			json: `{"a":true,"b":false,"c":true,"d":"true"}`,
+		},
+		"keys": {
+			yaml: "{1: a, yes: b}",
+			json: `{"1":"a","yes":"b"}`,
+		},
+		"nested": {
+			yaml: "{transfer: {amount: '100', to: [{addr: on}], memo: null, ratio: 1.5}}",
+			json: `{"transfer":{"amount":"100","to":[{"addr":"on"}],"memo":null,"ratio":1.5}}`,
+		},
+		"json": {
+			yaml: `{"a": [1, "yes", {"b": false}]}`,
+			json: `{"a":[1,"yes",{"b":false}]}`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := tempHome(t)
+			path := filepath.Join(dir, "scenario.yaml")
+			content := "steps:\n  - query: {msg: " + tc.yaml + "}\n"
+			require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+			sc, err := loadScenario(path)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.json, string(sc.Steps[0].Query.Msg))
+		})
+	}
+}
+
+func TestContractOf(t *testing.T) {
+	contracts := map[string]string{"init": "terra1init", "other": "terra1other"}
+	cases := map[string]struct {
+		contract string
+		expected string
+	}{
+		"last by default": {contract: "", expected: "terra1last"},
+		"step name":       {contract: "other", expected: "terra1other"},
+		"address":         {contract: "terra1addr", expected: "terra1addr"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, contractOf(&scenarioCall{Contract: tc.contract}, contracts, "terra1last"))
+		})
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	a := &profileRun{Code: "a.wasm", Steps: []stepProfile{
+		{Step: "init", GasUsed: 1000, StorageGas: 200},
+		{Step: "query", GasUsed: 300},
+	}}
+	b := &profileRun{Code: "b.wasm", Steps: []stepProfile{
+		{Step: "init", GasUsed: 900, StorageGas: 250},
+		{Step: "query", GasUsed: 300, StorageGas: 10},
+	}}
+	cmp, err := compareRuns(a, b)
+	require.NoError(t, err)
+	assert.Equal(t, []stepComparison{
+		{Step: "init", GasA: 1000, GasB: 900, GasDiff: -100, StorageGasA: 200, StorageGasB: 250, StorageGasDiff: 50},
+		{Step: "query", GasA: 300, GasB: 300, GasDiff: 0, StorageGasA: 0, StorageGasB: 10, StorageGasDiff: 10},
+	}, cmp)
+
+	_, err = compareRuns(a, &profileRun{Code: "b.wasm", Steps: b.Steps[:1]})
+	assert.EqualError(t, err, "a.wasm has 2 steps, b.wasm has 1")
+	_, err = compareRuns(a, &profileRun{Code: "b.wasm", Steps: []stepProfile{b.Steps[1], b.Steps[0]}})
+	assert.EqualError(t, err, "step 1 is init in a.wasm and query in b.wasm")
+}
+
+func TestFormatDiff(t *testing.T) {
+	cases := map[string]struct {
+		a, b     uint64
+		expected string
+	}{
+		"equal":     {a: 100, b: 100, expected: "+0 (+0.0%)"},
+		"more":      {a: 200, b: 250, expected: "+50 (+25.0%)"},
+		"less":      {a: 300, b: 200, expected: "-100 (-33.3%)"},
+		"from zero": {a: 0, b: 10, expected: "+10"},
+		"to zero":   {a: 10, b: 0, expected: "-10 (-100.0%)"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, formatDiff(tc.a, tc.b))
+		})
+	}
+}
+
+// TestRunScenario profiles hackatom, the execute and the query find the contract by the name of its step
+func TestRunScenario(t *testing.T) {
+	verifier := testAddress(t, "verifier")
+	beneficiary := testAddress(t, "beneficiary")
+	initMsg, err := json.Marshal(map[string]string{"verifier": verifier, "beneficiary": beneficiary})
+	require.NoError(t, err)
+	sc := &scenario{
+		Balances: map[string]string{verifier: "100uluna"},
+		Steps: []scenarioStep{
+			{Name: "init", Instantiate: &scenarioCall{Sender: verifier, Funds: "40uluna", Msg: initMsg}},
+			{Name: "verifier", Query: &scenarioCall{Contract: "init", Msg: json.RawMessage(`{"verifier":{}}`)}},
+			{Name: "release", Execute: &scenarioCall{Contract: "init", Sender: verifier, Msg: json.RawMessage(`{"release":{}}`)}},
+		},
+	}
+	run, err := runScenario(testVMOptions(), sc, "../api/testdata/hackatom.wasm")
+	require.NoError(t, err)
+	require.Len(t, run.Steps, 3)
+	for i, action := range []string{"instantiate", "query", "execute"} {
+		assert.Equal(t, sc.Steps[i].Name, run.Steps[i].Step)
+		assert.Equal(t, action, run.Steps[i].Action)
+		assert.NotZero(t, run.Steps[i].GasUsed)
+	}
+	assert.NotZero(t, run.Steps[0].Writes)
+	assert.NotZero(t, run.Steps[1].ResponseSize)
+
+	// an unknown contract fails the step
+	sc.Steps[1].Query.Contract = testAddress(t, "nobody")
+	_, err = runScenario(testVMOptions(), sc, "../api/testdata/hackatom.wasm")
+	assert.Error(t, err)
+}
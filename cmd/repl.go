@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/CosmWasm/go-cosmwasm/bech32"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// blockInterval is the time between the simulated blocks of the repl
+const blockInterval = 5
+
+// maxHistory is the number of commands kept in the history file
+const maxHistory = 1000
+
+// historySlack is how many commands the history file may grow beyond maxHistory before it is trimmed,
+// so it is not rewritten for every command
+const historySlack = 100
+
+const replHelp = `Commands:
+  store FILE                        store wasm code
+  instantiate CODE_ID LABEL MSG     instantiate code, the contract can be referred to by its label
+  execute CONTRACT MSG              execute a contract
+  query CONTRACT MSG                run a smart query
+  migrate CONTRACT CODE_ID MSG      migrate a contract, the sender must be its admin
+  sender [NAME|ADDR]                show or set the sender, names are turned into addresses
+  funds [COINS]                     show or set the funds sent with messages, "funds -" sends none
+  admin [NAME|ADDR]                 show or set the admin of new contracts, "admin -" sets none
+  addr NAME                         show the address of a name
+  mint ADDR COINS                   add coins to an account
+  balance ADDR                      show the balance of an account
+  block [N]                         show the block, or advance it by N blocks
+  contracts                         list the contracts
+  keys CONTRACT [PREFIX]            list the storage keys of a contract
+  raw CONTRACT KEY                  show a raw storage value, KEY is text or 0x followed by hex
+  history                           show the command history, !N repeats command N and !! the last one
+  help                              show this help
+  exit                              leave the repl
+MSG is JSON and may contain spaces, or @FILE to read it from a file.
+`
+
+// repl keeps a Wasmer, an in-memory state and a block clock between commands
+type repl struct {
+	app     *app
+	sender  string
+	funds   types.Coins
+	admin   string
+	history []string
+	// historyFile is appended with every command, nothing is saved if empty
+	historyFile string
+	// historyLines is the number of lines in historyFile
+	historyLines int
+	out          io.Writer
+}
+
+func runRepl(args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	vm := addVMFlags(fs)
+	defaultHistory := ""
+	if dir, err := os.UserHomeDir(); err == nil {
+		defaultHistory = filepath.Join(dir, ".wasmcli_history")
+	}
+	historyFile := fs.String("history", defaultHistory, "file to keep the command history in, none if empty")
+	height := fs.Uint64("height", 1, "height of the first block")
+	fs.Usage = usageFor(fs, "repl [flags]",
+		"Starts an interactive session on a fresh in-memory state, which is discarded on exit. Type help for the commands.")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	a, err := openMemoryApp(vm)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+	a.block = types.BlockInfo{Height: *height, Time: uint64(time.Now().Unix()), ChainID: "localnet"}
+	a.state.Height = a.block.Height
+
+	r := &repl{app: a, historyFile: *historyFile, out: os.Stdout}
+	r.loadHistory()
+	if r.sender, err = r.address("alice"); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "wasmcli repl, type help for the commands. Sender is alice (%s).\n", r.sender)
+	return r.run(os.Stdin)
+}
+
+func (r *repl) run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16<<20)
+	for {
+		fmt.Fprintf(r.out, "wasm[%d]> ", r.app.block.Height)
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		line, err := r.expandHistory(line)
+		if err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+		r.addHistory(line)
+		if err := r.exec(line); err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		}
+	}
+}
+
+// expandHistory replaces !N and !! with a command from the history
+func (r *repl) expandHistory(line string) (string, error) {
+	if !strings.HasPrefix(line, "!") {
+		return line, nil
+	}
+	if len(r.history) == 0 {
+		return "", errors.New("the history is empty")
+	}
+	if line == "!!" {
+		line = r.history[len(r.history)-1]
+	} else {
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 1 || n > len(r.history) {
+			return "", fmt.Errorf("no command %s in the history", line)
+		}
+		line = r.history[n-1]
+	}
+	fmt.Fprintln(r.out, line)
+	return line, nil
+}
+
+func (r *repl) loadHistory() {
+	if r.historyFile == "" {
+		return
+	}
+	bz, err := ioutil.ReadFile(r.historyFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(bz), "\n") {
+		if line != "" {
+			r.history = append(r.history, line)
+		}
+	}
+	r.historyLines = len(r.history)
+	if len(r.history) > maxHistory {
+		r.history = r.history[len(r.history)-maxHistory:]
+	}
+}
+
+// addHistory appends line to the history and its file. Both keep the last maxHistory commands,
+// the file is trimmed once it has historySlack more.
+func (r *repl) addHistory(line string) {
+	r.history = append(r.history, line)
+	if len(r.history) > maxHistory {
+		r.history = r.history[len(r.history)-maxHistory:]
+	}
+	if r.historyFile == "" {
+		return
+	}
+	r.historyLines++
+	if r.historyLines > maxHistory+historySlack {
+		r.writeHistory()
+		return
+	}
+	f, err := os.OpenFile(r.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// writeHistory replaces the history file with the history. Like chainState.save, it writes a temporary file first,
+// so an interrupted write does not lose the history.
+func (r *repl) writeHistory() {
+	tmp := r.historyFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strings.Join(r.history, "\n")+"\n"), 0600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, r.historyFile); err != nil {
+		return
+	}
+	r.historyLines = len(r.history)
+}
+
+// splitArgs splits line into n arguments, the last one is the rest of the line and may contain spaces
+func splitArgs(line string, n int) ([]string, error) {
+	var args []string
+	rest := strings.TrimSpace(line)
+	for len(args) < n-1 && rest != "" {
+		i := strings.IndexAny(rest, " \t")
+		if i < 0 {
+			args = append(args, rest)
+			rest = ""
+			break
+		}
+		args = append(args, rest[:i])
+		rest = strings.TrimSpace(rest[i:])
+	}
+	if rest != "" {
+		args = append(args, rest)
+	}
+	if len(args) != n {
+		return nil, errors.New("wrong number of arguments, see help")
+	}
+	return args, nil
+}
+
+func (r *repl) exec(line string) error {
+	name, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], strings.TrimSpace(line[i:])
+	}
+	fields := strings.Fields(rest)
+
+	switch name {
+	case "help":
+		fmt.Fprint(r.out, replHelp)
+	case "history":
+		for i, cmd := range r.history {
+			fmt.Fprintf(r.out, "%5d  %s\n", i+1, cmd)
+		}
+	case "store":
+		if len(fields) != 1 {
+			return errors.New("usage: store FILE")
+		}
+		code, err := ioutil.ReadFile(fields[0])
+		if err != nil {
+			return err
+		}
+		return r.tx(func() (interface{}, error) {
+			return r.app.store(r.sender, code)
+		})
+	case "instantiate":
+		args, err := splitArgs(rest, 3)
+		if err != nil {
+			return err
+		}
+		codeID, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		if r.contractByLabel(args[1]) != "" {
+			return fmt.Errorf("there is a contract labeled %q already", args[1])
+		}
+		msg, err := readMsg(args[2])
+		if err != nil {
+			return err
+		}
+		return r.tx(func() (interface{}, error) {
+			return r.app.instantiate(codeID, r.sender, r.funds, msg, args[1], r.admin)
+		})
+	case "execute":
+		args, err := splitArgs(rest, 2)
+		if err != nil {
+			return err
+		}
+		addr, err := r.contract(args[0])
+		if err != nil {
+			return err
+		}
+		msg, err := readMsg(args[1])
+		if err != nil {
+			return err
+		}
+		return r.tx(func() (interface{}, error) {
+			return r.app.execute(addr, r.sender, r.funds, msg)
+		})
+	case "migrate":
+		args, err := splitArgs(rest, 3)
+		if err != nil {
+			return err
+		}
+		addr, err := r.contract(args[0])
+		if err != nil {
+			return err
+		}
+		codeID, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		msg, err := readMsg(args[2])
+		if err != nil {
+			return err
+		}
+		return r.tx(func() (interface{}, error) {
+			return r.app.migrate(addr, r.sender, codeID, msg)
+		})
+	case "query":
+		args, err := splitArgs(rest, 2)
+		if err != nil {
+			return err
+		}
+		addr, err := r.contract(args[0])
+		if err != nil {
+			return err
+		}
+		msg, err := readMsg(args[1])
+		if err != nil {
+			return err
+		}
+		r.resetGas()
+		res, err := r.app.query(addr, msg, r.app.vm.gasLimit, nil)
+		if err != nil {
+			return err
+		}
+		return r.print(struct {
+			Result     interface{} `json:"result"`
+			GasUsed    uint64      `json:"gas_used"`
+			StorageGas uint64      `json:"storage_gas"`
+		}{marshalResult(res), r.app.gasUsed, r.app.meter.GasConsumed()})
+	case "sender":
+		if len(fields) > 1 {
+			return errors.New("usage: sender [NAME|ADDR]")
+		}
+		if len(fields) == 1 {
+			addr, err := r.address(fields[0])
+			if err != nil {
+				return err
+			}
+			r.sender = addr
+		}
+		fmt.Fprintln(r.out, r.sender)
+	case "funds":
+		if len(fields) > 1 {
+			return errors.New("usage: funds [COINS]")
+		}
+		if len(fields) == 1 {
+			coins := types.Coins(nil)
+			if fields[0] != "-" {
+				var err error
+				if coins, err = parseCoins(fields[0]); err != nil {
+					return err
+				}
+			}
+			r.funds = coins
+		}
+		fmt.Fprintln(r.out, formatCoins(r.funds))
+	case "admin":
+		if len(fields) > 1 {
+			return errors.New("usage: admin [NAME|ADDR]")
+		}
+		if len(fields) == 1 {
+			r.admin = ""
+			if fields[0] != "-" {
+				addr, err := r.address(fields[0])
+				if err != nil {
+					return err
+				}
+				r.admin = addr
+			}
+		}
+		fmt.Fprintln(r.out, r.admin)
+	case "addr":
+		if len(fields) != 1 {
+			return errors.New("usage: addr NAME")
+		}
+		addr, err := r.address(fields[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(r.out, addr)
+	case "mint":
+		if len(fields) != 2 {
+			return errors.New("usage: mint ADDR COINS")
+		}
+		addr, err := r.address(fields[0])
+		if err != nil {
+			return err
+		}
+		coins, err := parseCoins(fields[1])
+		if err != nil {
+			return err
+		}
+		r.app.state.Balances[addr] = addCoins(r.app.state.Balances[addr], coins)
+		fmt.Fprintln(r.out, formatCoins(r.app.state.Balances[addr]))
+	case "balance":
+		if len(fields) != 1 {
+			return errors.New("usage: balance ADDR")
+		}
+		addr, err := r.address(fields[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(r.out, formatCoins(r.app.state.Balances[addr]))
+	case "block":
+		if len(fields) > 1 {
+			return errors.New("usage: block [N]")
+		}
+		if len(fields) == 1 {
+			n, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			r.app.block.Height += n
+			r.app.block.Time += n * blockInterval
+			r.app.state.Height = r.app.block.Height
+		}
+		return r.print(r.app.block)
+	case "contracts":
+		for _, addr := range r.app.state.contractAddresses() {
+			c := r.app.state.Contracts[addr]
+			fmt.Fprintf(r.out, "%s  code %d  %s\n", addr, c.CodeID, c.Label)
+		}
+	case "keys":
+		if len(fields) != 1 && len(fields) != 2 {
+			return errors.New("usage: keys CONTRACT [PREFIX]")
+		}
+		addr, err := r.contract(fields[0])
+		if err != nil {
+			return err
+		}
+		var prefix []byte
+		if len(fields) == 2 {
+			if prefix, err = parseKey(fields[1]); err != nil {
+				return err
+			}
+		}
+		return r.listKeys(addr, prefix)
+	case "raw":
+		if len(fields) != 2 {
+			return errors.New("usage: raw CONTRACT KEY")
+		}
+		addr, err := r.contract(fields[0])
+		if err != nil {
+			return err
+		}
+		key, err := parseKey(fields[1])
+		if err != nil {
+			return err
+		}
+		db, err := r.app.stores.get(addr)
+		if err != nil {
+			return err
+		}
+		value, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return fmt.Errorf("no value for key %s", formatKey(key))
+		}
+		fmt.Fprintln(r.out, formatValue(value))
+	default:
+		return fmt.Errorf("unknown command %q, type help for the commands", name)
+	}
+	return nil
+}
+
+// tx runs a call that may change the state and restores the state if it fails, like a failed transaction
+func (r *repl) tx(call func() (interface{}, error)) error {
+	restore, err := r.app.snapshot()
+	if err != nil {
+		return err
+	}
+	r.resetGas()
+	res, err := call()
+	if err != nil {
+		if restoreErr := restore(); restoreErr != nil {
+			return fmt.Errorf("%v, and restoring the state failed: %v", err, restoreErr)
+		}
+		return err
+	}
+	if c, ok := res.(*callResult); ok {
+		c.GasUsed = r.app.gasUsed
+		c.StorageGas = r.app.meter.GasConsumed()
+	}
+	return r.print(res)
+}
+
+// resetGas gives every command the full gas limit
+func (r *repl) resetGas() {
+	r.app.gasUsed = 0
+	r.app.meter = &gasMeter{}
+}
+
+func copyMemDB(db *dbm.MemDB) (*dbm.MemDB, error) {
+	cp := dbm.NewMemDB()
+	it, err := db.Iterator(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		if err := cp.Set(it.Key(), it.Value()); err != nil {
+			return nil, err
+		}
+	}
+	return cp, it.Error()
+}
+
+// address returns addr if it is a valid address, or else the address derived from it as a name
+func (r *repl) address(addr string) (string, error) {
+	if r.app.validateAddress(addr) == nil {
+		return addr, nil
+	}
+	hash := sha256.Sum256([]byte("wasmcli/account/" + addr))
+	return bech32.EncodeBytes(r.app.vm.prefix, hash[:20])
+}
+
+// contract returns the address of a contract given by address or label
+func (r *repl) contract(arg string) (string, error) {
+	if _, ok := r.app.state.Contracts[arg]; ok {
+		return arg, nil
+	}
+	if addr := r.contractByLabel(arg); addr != "" {
+		return addr, nil
+	}
+	return "", fmt.Errorf("unknown contract %s", arg)
+}
+
+func (r *repl) contractByLabel(label string) string {
+	for addr, c := range r.app.state.Contracts {
+		if c.Label == label {
+			return addr
+		}
+	}
+	return ""
+}
+
+func (r *repl) listKeys(addr string, prefix []byte) error {
+	db, err := r.app.stores.get(addr)
+	if err != nil {
+		return err
+	}
+	it, err := db.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		if bytes.HasPrefix(it.Key(), prefix) {
+			fmt.Fprintln(r.out, formatKey(it.Key()))
+		}
+	}
+	return it.Error()
+}
+
+// parseKey reads a storage key given as text, or as hex after 0x
+func parseKey(arg string) ([]byte, error) {
+	if strings.HasPrefix(arg, "0x") {
+		return hex.DecodeString(arg[2:])
+	}
+	return []byte(arg), nil
+}
+
+// formatKey shows a key as text if possible, else as hex after 0x
+func formatKey(key []byte) string {
+	if isText(key) && !strings.HasPrefix(string(key), "0x") && !strings.ContainsAny(string(key), " \t") {
+		return string(key)
+	}
+	return "0x" + hex.EncodeToString(key)
+}
+
+// formatValue shows a value as text if possible, else as hex after 0x
+func formatValue(value []byte) string {
+	if isText(value) {
+		return string(value)
+	}
+	return "0x" + hex.EncodeToString(value)
+}
+
+func (r *repl) print(v interface{}) error {
+	bz, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, string(bz))
+	return nil
+}
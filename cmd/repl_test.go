@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitArgs(t *testing.T) {
+	cases := map[string]struct {
+		line     string
+		n        int
+		expected []string
+	}{
+		"one":              {line: "alice", n: 1, expected: []string{"alice"}},
+		"rest with spaces": {line: "1 alice {\"count\": 1}", n: 3, expected: []string{"1", "alice", `{"count": 1}`}},
+		"tabs and padding": {line: "  1\t\talice  ", n: 2, expected: []string{"1", "alice"}},
+		"too few":          {line: "1 alice", n: 3},
+		"all rest":         {line: "1 alice", n: 1, expected: []string{"1 alice"}},
+		"empty":            {line: "  ", n: 1},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			args, err := splitArgs(tc.line, tc.n)
+			if tc.expected == nil {
+				assert.EqualError(t, err, "wrong number of arguments, see help")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, args)
+		})
+	}
+}
+
+func TestExpandHistory(t *testing.T) {
+	cases := map[string]struct {
+		history  []string
+		line     string
+		expected string
+		err      string
+	}{
+		"no expansion": {
+			history:  []string{"block"},
+			line:     "query c1 {}",
+			expected: "query c1 {}",
+		},
+		"last": {
+			history:  []string{"block", "balance alice"},
+			line:     "!!",
+			expected: "balance alice",
+		},
+		"by number": {
+			history:  []string{"block", "balance alice"},
+			line:     "!1",
+			expected: "block",
+		},
+		"empty history": {
+			line: "!!",
+			err:  "the history is empty",
+		},
+		"out of range": {
+			history: []string{"block"},
+			line:    "!2",
+			err:     "no command !2 in the history",
+		},
+		"zero": {
+			history: []string{"block"},
+			line:    "!0",
+			err:     "no command !0 in the history",
+		},
+		"not a number": {
+			history: []string{"block"},
+			line:    "!block",
+			err:     "no command !block in the history",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := &repl{history: tc.history, out: &out}
+			line, err := r.expandHistory(tc.line)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, line)
+			if tc.expected != tc.line {
+				// the expanded command is shown
+				assert.Equal(t, tc.expected+"\n", out.String())
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	cases := map[string]struct {
+		arg      string
+		expected []byte
+		err      bool
+	}{
+		"text":        {arg: "config", expected: []byte("config")},
+		"hex":         {arg: "0x00ff", expected: []byte{0x00, 0xff}},
+		"empty hex":   {arg: "0x", expected: []byte{}},
+		"invalid hex": {arg: "0xzz", err: true},
+		"odd hex":     {arg: "0x123", err: true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			key, err := parseKey(tc.arg)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, key)
+			// formatKey reverses it
+			parsed, err := parseKey(formatKey(key))
+			require.NoError(t, err)
+			assert.Equal(t, key, parsed)
+		})
+	}
+}
+
+func historyFileLines(t *testing.T, path string) []string {
+	bz, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(bz), "\n"), "\n")
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(tempHome(t), "history")
+	r := &repl{historyFile: path, out: ioutil.Discard}
+	r.loadHistory()
+	assert.Empty(t, r.history)
+	r.addHistory("block")
+	r.addHistory("balance alice")
+	assert.Equal(t, []string{"block", "balance alice"}, historyFileLines(t, path))
+
+	// a new session continues the history
+	r = &repl{historyFile: path, out: ioutil.Discard}
+	r.loadHistory()
+	assert.Equal(t, []string{"block", "balance alice"}, r.history)
+
+	// without a file only the session has a history
+	r = &repl{out: ioutil.Discard}
+	r.addHistory("block")
+	assert.Equal(t, []string{"block"}, r.history)
+}
+
+func TestHistoryIsTrimmed(t *testing.T) {
+	path := filepath.Join(tempHome(t), "history")
+	r := &repl{historyFile: path, out: ioutil.Discard}
+	for i := 1; i <= maxHistory+historySlack; i++ {
+		r.addHistory(fmt.Sprintf("cmd %d", i))
+	}
+	assert.Len(t, r.history, maxHistory)
+	assert.Equal(t, "cmd 101", r.history[0])
+	// the file grows up to the slack
+	assert.Len(t, historyFileLines(t, path), maxHistory+historySlack)
+
+	// then it is trimmed to the history
+	r.addHistory("one more")
+	lines := historyFileLines(t, path)
+	assert.Equal(t, r.history, lines)
+	assert.Len(t, lines, maxHistory)
+	assert.Equal(t, "one more", lines[maxHistory-1])
+
+	// a long file is trimmed when it is loaded, and on the next write
+	long := make([]string, 3*maxHistory)
+	for i := range long {
+		long[i] = fmt.Sprintf("old %d", i)
+	}
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Join(long, "\n")+"\n"), 0600))
+	r = &repl{historyFile: path, out: ioutil.Discard}
+	r.loadHistory()
+	assert.Equal(t, long[2*maxHistory:], r.history)
+	r.addHistory("new")
+	assert.Len(t, historyFileLines(t, path), maxHistory)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/CosmWasm/go-cosmwasm/replay"
+)
+
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	fs.Usage = usageFor(fs, "replay [flags] FILE",
+		"Re-executes the calls recorded by a replay.Recorder (a JSON list of replay.Call) and reports "+
+			"every divergence in response, gas or writes. The code of the calls must be stored in the local state.")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	bz, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var calls []replay.Call
+	if err := json.Unmarshal(bz, &calls); err != nil {
+		return fmt.Errorf("reading %s: %w", fs.Arg(0), err)
+	}
+	a, err := openApp(home, vm)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	type callReport struct {
+		Call        int                 `json:"call"`
+		Kind        string              `json:"kind"`
+		Divergences []replay.Divergence `json:"divergences"`
+	}
+	var reports []callReport
+	diverged := 0
+	for i, call := range calls {
+		report, err := replay.Replay(a.wasmer, call, a.api)
+		if err != nil {
+			return fmt.Errorf("call %d: %w", i+1, err)
+		}
+		if !report.OK() {
+			diverged++
+		}
+		reports = append(reports, callReport{Call: i + 1, Kind: call.Kind, Divergences: report.Divergences})
+	}
+	if err := printJSON(reports); err != nil {
+		return err
+	}
+	if diverged > 0 {
+		return fmt.Errorf("%d of %d calls diverged", diverged, len(calls))
+	}
+	return nil
+}
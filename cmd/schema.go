@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/CosmWasm/go-cosmwasm/schema"
+)
+
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Usage = usageFor(fs, "schema validate SCHEMA_DIR KIND MSG | schema examples SCHEMA_DIR KIND",
+		"Validates a message against the JSON schemas of a contract (the directory written by `cargo schema`), "+
+			"or prints an example message for every variant of a kind. KIND is init, handle, query or migrate "+
+			"(instantiate and execute are accepted too). MSG is JSON, or @FILE to read it from a file.")
+	fs.Parse(args)
+
+	switch {
+	case fs.Arg(0) == "validate" && fs.NArg() == 4:
+	case fs.Arg(0) == "examples" && fs.NArg() == 3:
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	kind, err := schema.ParseKind(fs.Arg(2))
+	if err != nil {
+		return err
+	}
+	set, err := schema.LoadDir(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	s := set.Schema(kind)
+	if s == nil {
+		return fmt.Errorf("no %s message schema in %s", kind, fs.Arg(1))
+	}
+
+	if fs.Arg(0) == "examples" {
+		return printJSON(s.Examples())
+	}
+	msg, err := readMsg(fs.Arg(3))
+	if err != nil {
+		return err
+	}
+	err = s.Validate(msg)
+	errs, ok := err.(schema.ValidationErrors)
+	if err != nil && !ok {
+		return err
+	}
+	type problem struct {
+		Path    string `json:"path"`
+		Message string `json:"message"`
+	}
+	problems := []problem{}
+	for _, e := range errs {
+		path := e.Path
+		if path == "" {
+			path = "/"
+		}
+		problems = append(problems, problem{path, e.Message})
+	}
+	if err := printJSON(struct {
+		Valid  bool            `json:"valid"`
+		Errors []problem       `json:"errors"`
+		Msg    json.RawMessage `json:"msg"`
+	}{len(problems) == 0, problems, msg}); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems in the %s message", len(problems), kind)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// server answers the wasm REST routes of a node from the local state:
+//
+//	GET  /wasm/codes/{codeID}                           code info
+//	GET  /wasm/contracts/{contract}                     contract info
+//	GET  /wasm/contracts/{contract}/store?query_msg=MSG smart query
+//	GET  /wasm/contracts/{contract}/store/raw?key=KEY   raw query, KEY is text or 0x followed by hex
+//	POST /wasm/contracts/{contract}                     execute, committed to the local state
+//	POST /wasm/contracts/{contract}/simulate            execute without committing, returns the gas
+//
+// Every request sees the state on disk, so commands run next to the server are picked up.
+// Requests are served one at a time.
+//
+// Browsers may use the GET routes from any origin. The POST routes change the local state, so only
+// allowOrigin may use them from a browser ("*" for all origins).
+type server struct {
+	mu          sync.Mutex
+	app         *app
+	chainID     string
+	allowOrigin string
+}
+
+// restResponse wraps results like the REST server of a node
+type restResponse struct {
+	Height string      `json:"height"`
+	Result interface{} `json:"result"`
+}
+
+// executeRequest is the body of execute and simulate, with the fields of the node's execute route
+type executeRequest struct {
+	BaseReq struct {
+		From string `json:"from"`
+	} `json:"base_req"`
+	// ExecMsg is the message, either as JSON or as a string containing JSON
+	ExecMsg json.RawMessage `json:"exec_msg"`
+	Coins   types.Coins     `json:"coins"`
+}
+
+// httpError is an error with the status code to answer it with
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return httpError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return httpError{http.StatusNotFound, fmt.Errorf(format, args...)}
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return httpError{http.StatusForbidden, fmt.Errorf(format, args...)}
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	home := addHomeFlags(fs)
+	vm := addVMFlags(fs)
+	listen := fs.String("listen", "127.0.0.1:1317", "address to listen on")
+	chainID := fs.String("chain-id", "localnet", "chain id")
+	allowOrigin := fs.String("allow-origin", "", "origin of a dApp allowed to execute contracts from the browser, * for any (default: none)")
+	fs.Usage = usageFor(fs, "serve [flags]",
+		"Serves the local contracts over HTTP, with the wasm REST routes of a node:\n\n"+
+			"  GET  /wasm/codes/{codeID}\n"+
+			"  GET  /wasm/contracts/{contract}\n"+
+			"  GET  /wasm/contracts/{contract}/store?query_msg=MSG\n"+
+			"  GET  /wasm/contracts/{contract}/store/raw?key=KEY\n"+
+			"  POST /wasm/contracts/{contract}           {\"base_req\":{\"from\":ADDR},\"exec_msg\":MSG,\"coins\":[...]}\n"+
+			"  POST /wasm/contracts/{contract}/simulate  same body, nothing is committed\n\n"+
+			"Web pages of any origin may use the GET routes. Only -allow-origin may use the POST routes.")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	a, err := openApp(home, vm)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+	s := &server{app: a, chainID: *chainID, allowOrigin: *allowOrigin}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wasm/", s.handle)
+	log.Printf("Serving the contracts in %s on http://%s/wasm/", home.home, *listen)
+	return http.ListenAndServe(*listen, mux)
+}
+
+// mayWrite tells if a request from origin may use the POST routes. Requests without an origin
+// do not come from a web page.
+func (s *server) mayWrite(origin string) bool {
+	return origin == "" || s.allowOrigin == "*" || origin == s.allowOrigin
+}
+
+// cors sets the CORS headers for dApps in the browser, which call us from another origin
+func (s *server) cors(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	w.Header().Add("Vary", "Origin")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if s.mayWrite(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	}
+}
+
+func (s *server) handle(w http.ResponseWriter, r *http.Request) {
+	s.cors(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res interface{}
+	var err error
+	// browsers send some POST requests without asking first, so we must not run them
+	if origin := r.Header.Get("Origin"); r.Method != http.MethodGet && !s.mayWrite(origin) {
+		err = forbidden("origin %s may not change the state, see -allow-origin", origin)
+	} else {
+		res, err = s.route(r)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		var herr httpError
+		if errors.As(err, &herr) {
+			status = herr.status
+		}
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		writeJSON(w, status, struct {
+			Error string `json:"error"`
+		}{err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, restResponse{
+		Height: strconv.FormatUint(s.app.state.Height, 10),
+		Result: res,
+	})
+}
+
+func (s *server) route(r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/wasm/"), "/"), "/")
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(parts) == 2 && parts[0] == "codes" && r.Method == http.MethodGet:
+		id, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, badRequest("invalid code id %q", parts[1])
+		}
+		info, err := s.app.state.code(id)
+		if err != nil {
+			return nil, notFound("%v", err)
+		}
+		return info, nil
+	case len(parts) >= 2 && parts[0] == "contracts":
+		contract, err := s.app.state.contract(parts[1])
+		if err != nil {
+			return nil, notFound("%v", err)
+		}
+		rest := strings.Join(parts[2:], "/")
+		switch {
+		case rest == "" && r.Method == http.MethodGet:
+			return contract, nil
+		case rest == "" && r.Method == http.MethodPost:
+			return s.execute(r, contract.Address, true)
+		case rest == "simulate" && r.Method == http.MethodPost:
+			return s.execute(r, contract.Address, false)
+		case rest == "store" && r.Method == http.MethodGet:
+			return s.smartQuery(r, contract.Address)
+		case rest == "store/raw" && r.Method == http.MethodGet:
+			return s.rawQuery(r, contract.Address)
+		}
+	}
+	return nil, notFound("no route %s %s", r.Method, r.URL.Path)
+}
+
+// reload reads the state from disk and resets the gas for a new request
+func (s *server) reload() error {
+	state, err := loadChainState(s.app.home)
+	if err != nil {
+		return err
+	}
+	s.app.state = state
+	s.app.stores = newContractStores(s.app.home)
+	s.app.meter = &gasMeter{}
+	s.app.stats = accessStats{}
+	s.app.gasUsed = 0
+	s.app.block = types.BlockInfo{
+		Height:  state.Height,
+		Time:    uint64(time.Now().Unix()),
+		ChainID: s.chainID,
+	}
+	return nil
+}
+
+func (s *server) smartQuery(r *http.Request, addr string) (interface{}, error) {
+	// not readMsg, which would let requests read local files
+	msg := []byte(r.URL.Query().Get("query_msg"))
+	if !json.Valid(msg) {
+		return nil, badRequest("query_msg is not valid JSON")
+	}
+	res, err := s.app.query(addr, msg, s.app.vm.gasLimit, nil)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return marshalResult(res), nil
+}
+
+func (s *server) rawQuery(r *http.Request, addr string) (interface{}, error) {
+	key := r.URL.Query().Get("key")
+	keyBz := []byte(key)
+	if strings.HasPrefix(key, "0x") {
+		var err error
+		if keyBz, err = hex.DecodeString(key[2:]); err != nil {
+			return nil, badRequest("key: %v", err)
+		}
+	}
+	db, err := s.app.stores.get(addr)
+	if err != nil {
+		return nil, err
+	}
+	value, err := db.Get(keyBz)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	}{keyBz, value}, nil
+}
+
+// execute runs an execute request, and commits it as the next block if commit is set
+func (s *server) execute(r *http.Request, addr string, commit bool) (interface{}, error) {
+	var req executeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, badRequest("invalid body: %v", err)
+	}
+	sender := req.BaseReq.From
+	if err := s.app.validateAddress(sender); err != nil {
+		return nil, badRequest("base_req.from: %v", err)
+	}
+	msg := []byte(req.ExecMsg)
+	var str string
+	if json.Unmarshal(req.ExecMsg, &str) == nil {
+		msg = []byte(str)
+	}
+	if !json.Valid(msg) {
+		return nil, badRequest("exec_msg is not valid JSON")
+	}
+
+	s.app.block.Height = s.app.state.Height + 1
+	res, err := s.app.execute(addr, sender, req.Coins, msg)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	res.GasUsed = s.app.gasUsed
+	res.StorageGas = s.app.meter.GasConsumed()
+	if !commit {
+		return struct {
+			*callResult
+			GasEstimate string `json:"gas_estimate"`
+		}{res, strconv.FormatUint(sdkGas(res.GasUsed, res.StorageGas), 10)}, nil
+	}
+	s.app.state.Height = s.app.block.Height
+	if err := s.app.commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	bz, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bz)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// newTestServer serves a home with one code and one contract of it, which has no storage
+func newTestServer(t *testing.T, allowOrigin string) (*server, string) {
+	log.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	home := tempHome(t)
+	a, err := openApp(&homeOptions{home: home}, testVMOptions())
+	require.NoError(t, err)
+	t.Cleanup(a.close)
+	contract := testAddress(t, "contract")
+	a.state.Height = 12
+	a.state.Codes = []codeInfo{{ID: 1, Checksum: "abcd"}}
+	a.state.Contracts[contract] = &contractInfo{Address: contract, CodeID: 1, Creator: "alice"}
+	require.NoError(t, a.state.save(home))
+	return &server{app: a, chainID: "testnet", allowOrigin: allowOrigin}, contract
+}
+
+func serveRequest(s *server, method string, path string, body string, origin string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	s.handle(w, r)
+	return w
+}
+
+func TestServeRoutes(t *testing.T) {
+	s, contract := newTestServer(t, "")
+	alice := testAddress(t, "alice")
+
+	cases := map[string]struct {
+		method string
+		path   string
+		body   string
+		status int
+		// result is the expected result, or the expected error for failures
+		result string
+	}{
+		"code": {
+			method: http.MethodGet,
+			path:   "/wasm/codes/1",
+			status: http.StatusOK,
+			result: `{"id":1,"checksum":"abcd"}`,
+		},
+		"contract": {
+			method: http.MethodGet,
+			path:   "/wasm/contracts/" + contract + "/",
+			status: http.StatusOK,
+			result: `{"address":"` + contract + `","code_id":1,"creator":"alice"}`,
+		},
+		"raw query of a missing key": {
+			method: http.MethodGet,
+			path:   "/wasm/contracts/" + contract + "/store/raw?key=0x0102",
+			status: http.StatusOK,
+			result: `{"key":"AQI=","value":null}`,
+		},
+		"invalid code id": {
+			method: http.MethodGet,
+			path:   "/wasm/codes/one",
+			status: http.StatusBadRequest,
+			result: `invalid code id "one"`,
+		},
+		"unknown code": {
+			method: http.MethodGet,
+			path:   "/wasm/codes/2",
+			status: http.StatusNotFound,
+			result: "unknown code id 2",
+		},
+		"unknown contract": {
+			method: http.MethodGet,
+			path:   "/wasm/contracts/" + alice,
+			status: http.StatusNotFound,
+			result: "unknown contract " + alice,
+		},
+		"unknown route": {
+			method: http.MethodGet,
+			path:   "/wasm/contracts/" + contract + "/history",
+			status: http.StatusNotFound,
+			result: "no route GET /wasm/contracts/" + contract + "/history",
+		},
+		"wrong method": {
+			method: http.MethodPost,
+			path:   "/wasm/codes/1",
+			status: http.StatusNotFound,
+			result: "no route POST /wasm/codes/1",
+		},
+		"invalid raw key": {
+			method: http.MethodGet,
+			path:   "/wasm/contracts/" + contract + "/store/raw?key=0xzz",
+			status: http.StatusBadRequest,
+			result: "key: encoding/hex: invalid byte: U+007A 'z'",
+		},
+		"invalid query": {
+			method: http.MethodGet,
+			path:   "/wasm/contracts/" + contract + "/store?query_msg=%7B",
+			status: http.StatusBadRequest,
+			result: "query_msg is not valid JSON",
+		},
+		"invalid body": {
+			method: http.MethodPost,
+			path:   "/wasm/contracts/" + contract,
+			body:   `{"base_req":`,
+			status: http.StatusBadRequest,
+			result: "invalid body: unexpected EOF",
+		},
+		"invalid sender": {
+			method: http.MethodPost,
+			path:   "/wasm/contracts/" + contract + "/simulate",
+			body:   `{"base_req":{"from":"alice"},"exec_msg":{}}`,
+			status: http.StatusBadRequest,
+		},
+		"invalid message": {
+			method: http.MethodPost,
+			path:   "/wasm/contracts/" + contract,
+			body:   `{"base_req":{"from":"` + alice + `"},"exec_msg":"{"}`,
+			status: http.StatusBadRequest,
+			result: "exec_msg is not valid JSON",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := serveRequest(s, tc.method, tc.path, tc.body, "")
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			var res struct {
+				Height string          `json:"height"`
+				Result json.RawMessage `json:"result"`
+				Error  string          `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			if tc.status == http.StatusOK {
+				assert.Equal(t, "12", res.Height)
+				assert.JSONEq(t, tc.result, string(res.Result))
+			} else if tc.result != "" {
+				assert.Equal(t, tc.result, res.Error)
+			} else {
+				assert.NotEmpty(t, res.Error)
+			}
+		})
+	}
+}
+
+func TestServeCORS(t *testing.T) {
+	const dApp = "http://localhost:3000"
+	cases := map[string]struct {
+		allowOrigin string
+		method      string
+		origin      string
+		status      int
+		// the expected CORS headers, none if empty
+		allowedOrigin  string
+		allowedMethods string
+	}{
+		"get without origin": {
+			method: http.MethodGet,
+			status: http.StatusOK,
+		},
+		"get from any origin": {
+			method:         http.MethodGet,
+			origin:         "http://evil.example",
+			status:         http.StatusOK,
+			allowedOrigin:  "*",
+			allowedMethods: "GET, OPTIONS",
+		},
+		"preflight from another origin": {
+			allowOrigin:    dApp,
+			method:         http.MethodOptions,
+			origin:         "http://evil.example",
+			status:         http.StatusNoContent,
+			allowedOrigin:  "*",
+			allowedMethods: "GET, OPTIONS",
+		},
+		"preflight from the allowed origin": {
+			allowOrigin:    dApp,
+			method:         http.MethodOptions,
+			origin:         dApp,
+			status:         http.StatusNoContent,
+			allowedOrigin:  dApp,
+			allowedMethods: "GET, POST, OPTIONS",
+		},
+		"post from another origin": {
+			allowOrigin:    dApp,
+			method:         http.MethodPost,
+			origin:         "http://evil.example",
+			status:         http.StatusForbidden,
+			allowedOrigin:  "*",
+			allowedMethods: "GET, OPTIONS",
+		},
+		"post without allowed origins": {
+			method:         http.MethodPost,
+			origin:         dApp,
+			status:         http.StatusForbidden,
+			allowedOrigin:  "*",
+			allowedMethods: "GET, OPTIONS",
+		},
+		// the body is invalid, but the request reaches the route
+		"post from the allowed origin": {
+			allowOrigin:    dApp,
+			method:         http.MethodPost,
+			origin:         dApp,
+			status:         http.StatusBadRequest,
+			allowedOrigin:  dApp,
+			allowedMethods: "GET, POST, OPTIONS",
+		},
+		"post with all origins allowed": {
+			allowOrigin:    "*",
+			method:         http.MethodPost,
+			origin:         dApp,
+			status:         http.StatusBadRequest,
+			allowedOrigin:  dApp,
+			allowedMethods: "GET, POST, OPTIONS",
+		},
+		"post without origin": {
+			method: http.MethodPost,
+			status: http.StatusBadRequest,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, contract := newTestServer(t, tc.allowOrigin)
+			w := serveRequest(s, tc.method, "/wasm/contracts/"+contract, "", tc.origin)
+			assert.Equal(t, tc.status, w.Code, w.Body.String())
+			assert.Equal(t, tc.allowedOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tc.allowedMethods, w.Header().Get("Access-Control-Allow-Methods"))
+		})
+	}
+}
+
+// TestServeSimulate executes hackatom, which sends its balance to the beneficiary, with and without committing
+func TestServeSimulate(t *testing.T) {
+	s, _ := newTestServer(t, "")
+	wasm, err := ioutil.ReadFile("../api/testdata/hackatom.wasm")
+	require.NoError(t, err)
+	verifier := testAddress(t, "verifier")
+	beneficiary := testAddress(t, "beneficiary")
+	a := s.app
+	a.state.Balances[verifier] = types.Coins{types.NewCoin(100, "uluna")}
+	code, err := a.store("", wasm)
+	require.NoError(t, err)
+	initMsg, err := json.Marshal(map[string]string{"verifier": verifier, "beneficiary": beneficiary})
+	require.NoError(t, err)
+	res, err := a.instantiate(code.ID, verifier, types.Coins{types.NewCoin(40, "uluna")}, initMsg, "", "")
+	require.NoError(t, err)
+	require.NoError(t, a.commit())
+	hackatom := res.Contract
+
+	body := `{"base_req":{"from":"` + verifier + `"},"exec_msg":{"release":{}}}`
+	w := serveRequest(s, http.MethodPost, "/wasm/contracts/"+hackatom+"/simulate", body, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var simulated struct {
+		Result struct {
+			GasEstimate string `json:"gas_estimate"`
+			GasUsed     uint64 `json:"gas_used"`
+		} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &simulated))
+	assert.NotZero(t, simulated.Result.GasUsed)
+	assert.NotEmpty(t, simulated.Result.GasEstimate)
+
+	// nothing was committed
+	state, err := loadChainState(a.home)
+	require.NoError(t, err)
+	assert.Equal(t, types.Coins{types.NewCoin(40, "uluna")}, state.Balances[hackatom])
+	assert.Empty(t, state.Balances[beneficiary])
+	height := state.Height
+
+	w = serveRequest(s, http.MethodPost, "/wasm/contracts/"+hackatom, body, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	state, err = loadChainState(a.home)
+	require.NoError(t, err)
+	assert.Equal(t, types.Coins{}, state.Balances[hackatom])
+	assert.Equal(t, types.Coins{types.NewCoin(40, "uluna")}, state.Balances[beneficiary])
+	assert.Equal(t, height+1, state.Height)
+}
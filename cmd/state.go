@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// The state directory contains
+//
+//	state.json           the chain state (codes, contracts, balances, block height)
+//	wasm/                the Wasmer data directory with the stored code
+//	contracts/<addr>.db  the storage of every contract (goleveldb)
+const (
+	stateFile    = "state.json"
+	wasmDir      = "wasm"
+	contractsDir = "contracts"
+)
+
+// chainState is everything the CLI keeps in state.json
+type chainState struct {
+	Height      uint64                   `json:"height"`
+	Codes       []codeInfo               `json:"codes"`
+	Contracts   map[string]*contractInfo `json:"contracts"`
+	Balances    map[string]types.Coins   `json:"balances"`
+	ContractSeq uint64                   `json:"contract_seq"`
+}
+
+type codeInfo struct {
+	ID uint64 `json:"id"`
+	// Checksum is the hex encoded CodeID of the Wasmer
+	Checksum string `json:"checksum"`
+	// InterfaceVersion is given to the Wasmer when the app opens, so it does not read the wasm for it
+	InterfaceVersion types.InterfaceVersion `json:"interface_version,omitempty"`
+	Creator          string                 `json:"creator,omitempty"`
+}
+
+type contractInfo struct {
+	Address string `json:"address"`
+	CodeID  uint64 `json:"code_id"`
+	Creator string `json:"creator"`
+	// Admin may migrate the contract, nobody can if empty
+	Admin string `json:"admin,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+func loadChainState(home string) (*chainState, error) {
+	state := &chainState{
+		Contracts: make(map[string]*contractInfo),
+		Balances:  make(map[string]types.Coins),
+	}
+	bz, err := ioutil.ReadFile(filepath.Join(home, stateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bz, state); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", stateFile, err)
+	}
+	if state.Contracts == nil {
+		state.Contracts = make(map[string]*contractInfo)
+	}
+	if state.Balances == nil {
+		state.Balances = make(map[string]types.Coins)
+	}
+	return state, nil
+}
+
+// save writes the state to a temporary file first, so an interrupted write does not corrupt it
+func (s *chainState) save(home string) error {
+	bz, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(home, stateFile+".tmp")
+	if err := ioutil.WriteFile(tmp, bz, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(home, stateFile))
+}
+
+func (s *chainState) code(id uint64) (*codeInfo, error) {
+	for i := range s.Codes {
+		if s.Codes[i].ID == id {
+			return &s.Codes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown code id %d", id)
+}
+
+func (s *chainState) contract(addr string) (*contractInfo, error) {
+	c, ok := s.Contracts[addr]
+	if !ok {
+		return nil, fmt.Errorf("unknown contract %s", addr)
+	}
+	return c, nil
+}
+
+// contractAddresses returns the addresses of all contracts in a stable order
+func (s *chainState) contractAddresses() []string {
+	addrs := make([]string, 0, len(s.Contracts))
+	for addr := range s.Contracts {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// contractStores holds a working copy of the storage of every contract used by one command.
+// Contracts only see the working copies, which are written to disk by commit if the command succeeded.
+// Without a directory the stores only live in memory.
+type contractStores struct {
+	dir     string
+	working map[string]*dbm.MemDB
+}
+
+func newContractStores(home string) *contractStores {
+	return &contractStores{
+		dir:     filepath.Join(home, contractsDir),
+		working: make(map[string]*dbm.MemDB),
+	}
+}
+
+func newMemoryStores() *contractStores {
+	return &contractStores{working: make(map[string]*dbm.MemDB)}
+}
+
+// get returns the working copy of the contract storage, loading it from disk on first use
+func (c *contractStores) get(addr string) (*dbm.MemDB, error) {
+	if mem, ok := c.working[addr]; ok {
+		return mem, nil
+	}
+	mem := dbm.NewMemDB()
+	if c.dir == "" {
+		c.working[addr] = mem
+		return mem, nil
+	}
+	err := c.withDB(addr, func(db dbm.DB) error {
+		it, err := db.Iterator(nil, nil)
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for ; it.Valid(); it.Next() {
+			if err := mem.Set(it.Key(), it.Value()); err != nil {
+				return err
+			}
+		}
+		return it.Error()
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.working[addr] = mem
+	return mem, nil
+}
+
+// commit replaces the storage on disk with the working copies
+func (c *contractStores) commit() error {
+	if c.dir == "" {
+		return nil
+	}
+	for addr, mem := range c.working {
+		err := c.withDB(addr, func(db dbm.DB) error {
+			batch := db.NewBatch()
+			defer batch.Close()
+			it, err := db.Iterator(nil, nil)
+			if err != nil {
+				return err
+			}
+			for ; it.Valid(); it.Next() {
+				batch.Delete(it.Key())
+			}
+			it.Close()
+			memIt, err := mem.Iterator(nil, nil)
+			if err != nil {
+				return err
+			}
+			defer memIt.Close()
+			for ; memIt.Valid(); memIt.Next() {
+				batch.Set(memIt.Key(), memIt.Value())
+			}
+			return batch.WriteSync()
+		})
+		if err != nil {
+			return fmt.Errorf("writing storage of %s: %w", addr, err)
+		}
+	}
+	return nil
+}
+
+func (c *contractStores) withDB(addr string, fn func(db dbm.DB) error) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	db, err := dbm.NewGoLevelDB(addr, c.dir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return fn(db)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+func tempHome(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "wasmcli")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestChainStateLoadSave(t *testing.T) {
+	home := tempHome(t)
+
+	// a new home has an empty state
+	state, err := loadChainState(home)
+	require.NoError(t, err)
+	assert.Equal(t, &chainState{
+		Contracts: map[string]*contractInfo{},
+		Balances:  map[string]types.Coins{},
+	}, state)
+
+	state.Height = 7
+	state.Codes = append(state.Codes, codeInfo{ID: 1, Checksum: "abcd", InterfaceVersion: types.InterfaceVersion3, Creator: "alice"})
+	state.Contracts["contract"] = &contractInfo{Address: "contract", CodeID: 1, Creator: "alice", Admin: "bob"}
+	state.Balances["alice"] = types.Coins{types.NewCoin(100, "uluna")}
+	state.ContractSeq = 1
+	require.NoError(t, state.save(home))
+	_, err = os.Stat(filepath.Join(home, stateFile+".tmp"))
+	assert.True(t, os.IsNotExist(err), "the temporary file is renamed")
+
+	loaded, err := loadChainState(home)
+	require.NoError(t, err)
+	assert.Equal(t, state, loaded)
+
+	code, err := loaded.code(1)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", code.Checksum)
+	_, err = loaded.code(2)
+	assert.EqualError(t, err, "unknown code id 2")
+	_, err = loaded.contract("other")
+	assert.EqualError(t, err, "unknown contract other")
+
+	// null maps are replaced
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, stateFile), []byte(`{"height":3}`), 0644))
+	loaded, err = loadChainState(home)
+	require.NoError(t, err)
+	assert.NotNil(t, loaded.Contracts)
+	assert.NotNil(t, loaded.Balances)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, stateFile), []byte(`{`), 0644))
+	_, err = loadChainState(home)
+	assert.Error(t, err)
+}
+
+func TestContractAddresses(t *testing.T) {
+	state := &chainState{Contracts: map[string]*contractInfo{"c": {}, "a": {}, "b": {}}}
+	assert.Equal(t, []string{"a", "b", "c"}, state.contractAddresses())
+}
+
+func TestContractStores(t *testing.T) {
+	cases := map[string]struct {
+		open func(home string) *contractStores
+		// persistent stores keep committed data for the next command
+		persistent bool
+	}{
+		"on disk": {
+			open:       newContractStores,
+			persistent: true,
+		},
+		"in memory": {
+			open:       func(string) *contractStores { return newMemoryStores() },
+			persistent: false,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			home := tempHome(t)
+			stores := tc.open(home)
+			db, err := stores.get("contract")
+			require.NoError(t, err)
+			require.NoError(t, db.Set([]byte("foo"), []byte("bar")))
+			require.NoError(t, db.Set([]byte("gone"), []byte("soon")))
+			// the working copy is returned again within a command
+			again, err := stores.get("contract")
+			require.NoError(t, err)
+			assert.Same(t, db, again)
+			require.NoError(t, stores.commit())
+
+			stores = tc.open(home)
+			db, err = stores.get("contract")
+			require.NoError(t, err)
+			if !tc.persistent {
+				assert.Empty(t, memDBContents(t, db))
+				_, err := os.Stat(filepath.Join(home, contractsDir))
+				assert.True(t, os.IsNotExist(err), "nothing is written to disk")
+				return
+			}
+			assert.Equal(t, map[string]string{"foo": "bar", "gone": "soon"}, memDBContents(t, db))
+
+			// a commit replaces the storage, including deletes
+			require.NoError(t, db.Delete([]byte("gone")))
+			require.NoError(t, db.Set([]byte("new"), []byte("value")))
+			require.NoError(t, stores.commit())
+			db, err = tc.open(home).get("contract")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"foo": "bar", "new": "value"}, memDBContents(t, db))
+
+			// changes without a commit are lost
+			stores = tc.open(home)
+			db, err = stores.get("contract")
+			require.NoError(t, err)
+			require.NoError(t, db.Set([]byte("foo"), []byte("changed")))
+			db, err = tc.open(home).get("contract")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"foo": "bar", "new": "value"}, memDBContents(t, db))
+		})
+	}
+}
+
+// memDBContents returns all items of a working copy
+func memDBContents(t *testing.T, db *dbm.MemDB) map[string]string {
+	items := make(map[string]string)
+	it, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		items[string(it.Key())] = string(it.Value())
+	}
+	return items
+}
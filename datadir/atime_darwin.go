@@ -0,0 +1,18 @@
+// +build darwin
+
+package datadir
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// lastUsed is the access time of a file, or its modification time if that is later
+func lastUsed(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return latest(info.ModTime(), time.Unix(stat.Atimespec.Sec, stat.Atimespec.Nsec))
+}
@@ -0,0 +1,19 @@
+// +build linux
+
+package datadir
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// lastUsed is the access time of a file, or its modification time if that is later.
+// Access times are only as good as the mount options, with relatime they are updated once a day.
+func lastUsed(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return latest(info.ModTime(), time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)))
+}
@@ -0,0 +1,13 @@
+// +build !linux,!darwin
+
+package datadir
+
+import (
+	"os"
+	"time"
+)
+
+// lastUsed is the modification time of a file, access times are not read on this platform
+func lastUsed(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
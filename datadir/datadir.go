@@ -0,0 +1,275 @@
+// Package datadir manages the data directory of a Wasmer, which keeps the raw wasm and the compiled
+// modules of every code forever. It lists the stored codes, verifies them and prunes the ones no longer needed.
+//
+// The layout is the one of the cosmwasm-vm the library is built with:
+//
+//	DATA_DIR/wasm/<code id>                 the raw wasm, the code id is its sha256 in hex
+//	DATA_DIR/modules/<backend>/<code id>    the module compiled by a backend (singlepass, cranelift)
+//
+// Files that do not fit this layout are left alone. Listing and verifying can be done next to a running
+// Wasmer, but Prune must only be used when no Wasmer has the directory open.
+package datadir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	wasmDir    = "wasm"
+	modulesDir = "modules"
+)
+
+// Entry is a code stored in the data directory
+type Entry struct {
+	CodeID []byte
+	// WasmSize is the size of the raw wasm, 0 if HasWasm is false
+	WasmSize int64
+	HasWasm  bool
+	Modules  []Module
+	// LastUsed is the last access to the wasm or a module, as far as the file system tracks access times
+	LastUsed time.Time
+}
+
+// Module is a compiled module of a code
+type Module struct {
+	Backend  string
+	Size     int64
+	LastUsed time.Time
+}
+
+// Size is the disk usage of the entry
+func (e Entry) Size() int64 {
+	size := e.WasmSize
+	for _, m := range e.Modules {
+		size += m.Size
+	}
+	return size
+}
+
+// WasmPath is the file of the raw wasm of a code
+func WasmPath(dataDir string, id []byte) string {
+	return filepath.Join(dataDir, wasmDir, hex.EncodeToString(id))
+}
+
+// ModulePath is the file of the module of a code compiled by backend
+func ModulePath(dataDir string, backend string, id []byte) string {
+	return filepath.Join(dataDir, modulesDir, backend, hex.EncodeToString(id))
+}
+
+// List returns the codes in the data directory, ordered by code id. Codes with modules but no wasm are included.
+func List(dataDir string) ([]Entry, error) {
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*Entry)
+	entry := func(id []byte) *Entry {
+		e, ok := entries[string(id)]
+		if !ok {
+			e = &Entry{CodeID: id}
+			entries[string(id)] = e
+		}
+		return e
+	}
+
+	wasms, err := readCodeFiles(filepath.Join(dataDir, wasmDir))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range wasms {
+		e := entry(f.id)
+		e.HasWasm = true
+		e.WasmSize = f.info.Size()
+		e.LastUsed = latest(e.LastUsed, lastUsed(f.info))
+	}
+
+	backends, err := readDir(filepath.Join(dataDir, modulesDir))
+	if err != nil {
+		return nil, err
+	}
+	for _, backend := range backends {
+		if !backend.IsDir() {
+			continue
+		}
+		modules, err := readCodeFiles(filepath.Join(dataDir, modulesDir, backend.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range modules {
+			e := entry(f.id)
+			m := Module{Backend: backend.Name(), Size: f.info.Size(), LastUsed: lastUsed(f.info)}
+			e.Modules = append(e.Modules, m)
+			e.LastUsed = latest(e.LastUsed, m.LastUsed)
+		}
+	}
+
+	list := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].CodeID, list[j].CodeID) < 0
+	})
+	return list, nil
+}
+
+type codeFile struct {
+	id   []byte
+	info os.FileInfo
+}
+
+// readCodeFiles returns the files in dir named by a code id
+func readCodeFiles(dir string) ([]codeFile, error) {
+	infos, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []codeFile
+	for _, info := range infos {
+		id, err := hex.DecodeString(info.Name())
+		if err != nil || len(id) != sha256.Size || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, codeFile{id, info})
+	}
+	return files, nil
+}
+
+// readDir is ioutil.ReadDir, but a missing directory is empty
+func readDir(dir string) ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return infos, err
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// Problem kinds found by Verify
+const (
+	// ProblemChecksum is wasm that does not hash to its code id
+	ProblemChecksum = "checksum_mismatch"
+	// ProblemMissingWasm is a code with compiled modules but without wasm, it cannot be recompiled
+	ProblemMissingWasm = "missing_wasm"
+	// ProblemUnreadableWasm is wasm that cannot be read, so its checksum is unknown
+	ProblemUnreadableWasm = "unreadable_wasm"
+	// ProblemMissingModule is wasm without a compiled module
+	ProblemMissingModule = "missing_module"
+	// ProblemCorruptModule is a compiled module that is empty or cannot be read
+	ProblemCorruptModule = "corrupt_module"
+)
+
+// Problem is something wrong with a code in the data directory
+type Problem struct {
+	CodeID []byte
+	Kind   string
+	Detail string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", hex.EncodeToString(p.CodeID), p.Kind, p.Detail)
+}
+
+// Recompilable tells if the problem goes away by compiling the wasm again, see Wasmer.Recompile
+func (p Problem) Recompilable() bool {
+	return p.Kind == ProblemMissingModule || p.Kind == ProblemCorruptModule
+}
+
+// Verify checks every wasm against its code id and that it has a readable compiled module.
+// Modules are only checked to be present and non-empty, their format is private to the VM.
+func Verify(dataDir string) ([]Problem, error) {
+	entries, err := List(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	for _, e := range entries {
+		problems = append(problems, verifyEntry(dataDir, e)...)
+	}
+	return problems, nil
+}
+
+func verifyEntry(dataDir string, e Entry) []Problem {
+	var problems []Problem
+	if !e.HasWasm {
+		problems = append(problems, Problem{e.CodeID, ProblemMissingWasm, "compiled modules without wasm"})
+	} else if wasm, err := ioutil.ReadFile(WasmPath(dataDir, e.CodeID)); err != nil {
+		problems = append(problems, Problem{e.CodeID, ProblemUnreadableWasm, err.Error()})
+	} else if sum := sha256.Sum256(wasm); !bytes.Equal(sum[:], e.CodeID) {
+		problems = append(problems, Problem{e.CodeID, ProblemChecksum, "wasm hashes to " + hex.EncodeToString(sum[:])})
+	}
+
+	if len(e.Modules) == 0 {
+		problems = append(problems, Problem{e.CodeID, ProblemMissingModule, "no compiled module"})
+	}
+	for _, m := range e.Modules {
+		f, err := os.Open(ModulePath(dataDir, m.Backend, e.CodeID))
+		if err == nil {
+			f.Close()
+		}
+		switch {
+		case err != nil:
+			problems = append(problems, Problem{e.CodeID, ProblemCorruptModule, err.Error()})
+		case m.Size == 0:
+			problems = append(problems, Problem{e.CodeID, ProblemCorruptModule, m.Backend + " module is empty"})
+		}
+	}
+	return problems
+}
+
+// Prune removes every code not in keep, its wasm and all its modules, and returns the removed entries.
+// With dryRun set nothing is removed. Keep must hold every code id the chain still refers to.
+func Prune(dataDir string, keep [][]byte, dryRun bool) ([]Entry, error) {
+	entries, err := List(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]bool, len(keep))
+	for _, id := range keep {
+		kept[string(id)] = true
+	}
+	var removed []Entry
+	for _, e := range entries {
+		if kept[string(e.CodeID)] {
+			continue
+		}
+		if !dryRun {
+			if err := Remove(dataDir, e); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
+
+// Remove deletes the wasm and the modules of an entry
+func Remove(dataDir string, e Entry) error {
+	paths := make([]string, 0, len(e.Modules)+1)
+	// the modules go first, so an interrupted removal never leaves modules without wasm
+	for _, m := range e.Modules {
+		paths = append(paths, ModulePath(dataDir, m.Backend, e.CodeID))
+	}
+	if e.HasWasm {
+		paths = append(paths, WasmPath(dataDir, e.CodeID))
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package datadir
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, content []byte) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, content, 0644))
+}
+
+// storeCode writes wasm and a module like the VM does, and returns the code id
+func storeCode(t *testing.T, dataDir string, wasm []byte, module []byte) []byte {
+	sum := sha256.Sum256(wasm)
+	id := sum[:]
+	writeFile(t, WasmPath(dataDir, id), wasm)
+	if module != nil {
+		writeFile(t, ModulePath(dataDir, "singlepass", id), module)
+	}
+	return id
+}
+
+func tempDataDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "datadir")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestList(t *testing.T) {
+	dataDir := tempDataDir(t)
+	good := storeCode(t, dataDir, []byte("good wasm"), []byte("compiled"))
+	noModule := storeCode(t, dataDir, []byte("no module"), nil)
+	// files outside the layout are ignored
+	writeFile(t, filepath.Join(dataDir, wasmDir, "README"), []byte("hi"))
+	writeFile(t, filepath.Join(dataDir, modulesDir, "singlepass", "abcd"), []byte("hi"))
+
+	entries, err := List(dataDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	byID := map[string]Entry{}
+	for _, e := range entries {
+		byID[string(e.CodeID)] = e
+	}
+
+	e := byID[string(good)]
+	assert.True(t, e.HasWasm)
+	assert.Equal(t, int64(9), e.WasmSize)
+	require.Len(t, e.Modules, 1)
+	assert.Equal(t, Module{Backend: "singlepass", Size: 8, LastUsed: e.Modules[0].LastUsed}, e.Modules[0])
+	assert.Equal(t, int64(17), e.Size())
+	assert.False(t, e.LastUsed.IsZero())
+
+	e = byID[string(noModule)]
+	assert.True(t, e.HasWasm)
+	assert.Empty(t, e.Modules)
+
+	_, err = List(filepath.Join(dataDir, "missing"))
+	assert.Error(t, err)
+	// a new data directory has no subdirectories yet
+	entries, err = List(tempDataDir(t))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestVerify(t *testing.T) {
+	dataDir := tempDataDir(t)
+	storeCode(t, dataDir, []byte("good wasm"), []byte("compiled"))
+	noModule := storeCode(t, dataDir, []byte("no module"), nil)
+	emptyModule := storeCode(t, dataDir, []byte("empty module"), []byte{})
+	tampered := storeCode(t, dataDir, []byte("original"), []byte("compiled"))
+	writeFile(t, WasmPath(dataDir, tampered), []byte("tampered"))
+	noWasm := storeCode(t, dataDir, []byte("no wasm"), []byte("compiled"))
+	require.NoError(t, os.Remove(WasmPath(dataDir, noWasm)))
+
+	problems, err := Verify(dataDir)
+	require.NoError(t, err)
+	found := map[string]string{}
+	for _, p := range problems {
+		found[string(p.CodeID)] = p.Kind
+	}
+	assert.Equal(t, map[string]string{
+		string(noModule):    ProblemMissingModule,
+		string(emptyModule): ProblemCorruptModule,
+		string(tampered):    ProblemChecksum,
+		string(noWasm):      ProblemMissingWasm,
+	}, found)
+
+	for _, p := range problems {
+		assert.Equal(t, p.Kind == ProblemMissingModule || p.Kind == ProblemCorruptModule, p.Recompilable())
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dataDir := tempDataDir(t)
+	keep := storeCode(t, dataDir, []byte("keep"), []byte("compiled"))
+	stale := storeCode(t, dataDir, []byte("stale"), []byte("compiled"))
+	writeFile(t, ModulePath(dataDir, "cranelift", stale), []byte("compiled too"))
+	orphan := storeCode(t, dataDir, []byte("orphan"), []byte("compiled"))
+	require.NoError(t, os.Remove(WasmPath(dataDir, orphan)))
+
+	removed, err := Prune(dataDir, [][]byte{keep}, true)
+	require.NoError(t, err)
+	assert.Len(t, removed, 2)
+	entries, err := List(dataDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "dry run removes nothing")
+
+	removed, err = Prune(dataDir, [][]byte{keep}, false)
+	require.NoError(t, err)
+	var ids [][]byte
+	for _, e := range removed {
+		ids = append(ids, e.CodeID)
+	}
+	assert.ElementsMatch(t, [][]byte{stale, orphan}, ids)
+
+	entries, err = List(dataDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, keep, entries[0].CodeID)
+	for _, path := range []string{
+		WasmPath(dataDir, stale),
+		ModulePath(dataDir, "singlepass", stale),
+		ModulePath(dataDir, "cranelift", stale),
+		ModulePath(dataDir, "singlepass", orphan),
+	} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+}
+
+func TestVerifyUnreadableWasm(t *testing.T) {
+	dataDir := tempDataDir(t)
+	id := storeCode(t, dataDir, []byte("wasm"), []byte("compiled"))
+	entries, err := List(dataDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	// the wasm goes away after it was listed
+	require.NoError(t, os.Remove(WasmPath(dataDir, id)))
+
+	problems := verifyEntry(dataDir, entries[0])
+	require.Len(t, problems, 1)
+	assert.Equal(t, ProblemUnreadableWasm, problems[0].Kind)
+	assert.Equal(t, id, problems[0].CodeID)
+	assert.False(t, problems[0].Recompilable())
+}
@@ -0,0 +1,167 @@
+// Package dispatch routes the messages returned by contracts to handlers provided by the embedding chain.
+package dispatch
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// Context is the chain specific context of one dispatch (e.g. the sdk.Context of the current tx).
+// It is passed through to the handlers untouched.
+type Context interface{}
+
+// Event is emitted by handlers to describe what they did
+type Event = types.Event
+
+// Handlers for the individual message variants. contract is the address of the contract
+// that returned the message, which is the sender of all its messages.
+type (
+	SendHandler        func(ctx Context, contract types.HumanAddress, msg *types.SendMsg) ([]Event, error)
+	DelegateHandler    func(ctx Context, contract types.HumanAddress, msg *types.DelegateMsg) ([]Event, error)
+	UndelegateHandler  func(ctx Context, contract types.HumanAddress, msg *types.UndelegateMsg) ([]Event, error)
+	RedelegateHandler  func(ctx Context, contract types.HumanAddress, msg *types.RedelegateMsg) ([]Event, error)
+	WithdrawHandler    func(ctx Context, contract types.HumanAddress, msg *types.WithdrawMsg) ([]Event, error)
+	ExecuteHandler     func(ctx Context, contract types.HumanAddress, msg *types.ExecuteMsg) ([]Event, error)
+	InstantiateHandler func(ctx Context, contract types.HumanAddress, msg *types.InstantiateMsg) ([]Event, error)
+)
+
+// Handlers for a whole message family. They are used for all variants of the family
+// that have no variant handler registered.
+type (
+	BankHandler    func(ctx Context, contract types.HumanAddress, msg *types.BankMsg) ([]Event, error)
+	StakingHandler func(ctx Context, contract types.HumanAddress, msg *types.StakingMsg) ([]Event, error)
+	WasmHandler    func(ctx Context, contract types.HumanAddress, msg *types.WasmMsg) ([]Event, error)
+	CustomHandler  func(ctx Context, contract types.HumanAddress, msg json.RawMessage) ([]Event, error)
+)
+
+// Dispatcher turns the messages returned by a contract into actions on the chain.
+// The embedding chain only registers the handlers it supports, all other messages
+// are rejected with types.UnsupportedRequest.
+//
+// Register all handlers before the first call to Dispatch, registration is not thread-safe.
+type Dispatcher struct {
+	send        SendHandler
+	delegate    DelegateHandler
+	undelegate  UndelegateHandler
+	redelegate  RedelegateHandler
+	withdraw    WithdrawHandler
+	execute     ExecuteHandler
+	instantiate InstantiateHandler
+
+	bank    BankHandler
+	staking StakingHandler
+	wasm    WasmHandler
+	custom  CustomHandler
+}
+
+// NewDispatcher returns a Dispatcher without any handlers
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// The Handle* methods register a handler, replacing any previous one for the same message.
+// They return the Dispatcher to allow chaining.
+
+func (d *Dispatcher) HandleSend(h SendHandler) *Dispatcher               { d.send = h; return d }
+func (d *Dispatcher) HandleDelegate(h DelegateHandler) *Dispatcher       { d.delegate = h; return d }
+func (d *Dispatcher) HandleUndelegate(h UndelegateHandler) *Dispatcher   { d.undelegate = h; return d }
+func (d *Dispatcher) HandleRedelegate(h RedelegateHandler) *Dispatcher   { d.redelegate = h; return d }
+func (d *Dispatcher) HandleWithdraw(h WithdrawHandler) *Dispatcher       { d.withdraw = h; return d }
+func (d *Dispatcher) HandleExecute(h ExecuteHandler) *Dispatcher         { d.execute = h; return d }
+func (d *Dispatcher) HandleInstantiate(h InstantiateHandler) *Dispatcher { d.instantiate = h; return d }
+
+func (d *Dispatcher) HandleBank(h BankHandler) *Dispatcher       { d.bank = h; return d }
+func (d *Dispatcher) HandleStaking(h StakingHandler) *Dispatcher { d.staking = h; return d }
+func (d *Dispatcher) HandleWasm(h WasmHandler) *Dispatcher       { d.wasm = h; return d }
+func (d *Dispatcher) HandleCustom(h CustomHandler) *Dispatcher   { d.custom = h; return d }
+
+// Dispatch runs the handlers for all msgs in order and returns the events of all of them.
+// It stops at the first error, which is returned wrapped with the index of the failing message.
+// Since handlers may already have changed state, the caller must discard the state changes on error.
+func (d *Dispatcher) Dispatch(ctx Context, contract types.HumanAddress, msgs []types.CosmosMsg) ([]Event, error) {
+	var events []Event
+	for i := range msgs {
+		evts, err := d.DispatchMsg(ctx, contract, &msgs[i])
+		if err != nil {
+			return nil, fmt.Errorf("dispatching message %d: %w", i, err)
+		}
+		events = append(events, evts...)
+	}
+	return events, nil
+}
+
+// DispatchMsg runs the handler for a single message
+func (d *Dispatcher) DispatchMsg(ctx Context, contract types.HumanAddress, msg *types.CosmosMsg) ([]Event, error) {
+	switch {
+	case msg.Bank != nil:
+		return d.dispatchBank(ctx, contract, msg.Bank)
+	case msg.Staking != nil:
+		return d.dispatchStaking(ctx, contract, msg.Staking)
+	case msg.Wasm != nil:
+		return d.dispatchWasm(ctx, contract, msg.Wasm)
+	case msg.Custom != nil:
+		if d.custom == nil {
+			return nil, types.UnsupportedRequest{Kind: "custom"}
+		}
+		return d.custom(ctx, contract, msg.Custom)
+	default:
+		return nil, types.UnsupportedRequest{Kind: "unknown message"}
+	}
+}
+
+func (d *Dispatcher) dispatchBank(ctx Context, contract types.HumanAddress, msg *types.BankMsg) ([]Event, error) {
+	switch {
+	case msg.Send != nil && d.send != nil:
+		return d.send(ctx, contract, msg.Send)
+	case d.bank != nil:
+		return d.bank(ctx, contract, msg)
+	case msg.Send != nil:
+		return nil, types.UnsupportedRequest{Kind: "bank.send"}
+	default:
+		return nil, types.UnsupportedRequest{Kind: "bank"}
+	}
+}
+
+func (d *Dispatcher) dispatchStaking(ctx Context, contract types.HumanAddress, msg *types.StakingMsg) ([]Event, error) {
+	switch {
+	case msg.Delegate != nil && d.delegate != nil:
+		return d.delegate(ctx, contract, msg.Delegate)
+	case msg.Undelegate != nil && d.undelegate != nil:
+		return d.undelegate(ctx, contract, msg.Undelegate)
+	case msg.Redelegate != nil && d.redelegate != nil:
+		return d.redelegate(ctx, contract, msg.Redelegate)
+	case msg.Withdraw != nil && d.withdraw != nil:
+		return d.withdraw(ctx, contract, msg.Withdraw)
+	case d.staking != nil:
+		return d.staking(ctx, contract, msg)
+	case msg.Delegate != nil:
+		return nil, types.UnsupportedRequest{Kind: "staking.delegate"}
+	case msg.Undelegate != nil:
+		return nil, types.UnsupportedRequest{Kind: "staking.undelegate"}
+	case msg.Redelegate != nil:
+		return nil, types.UnsupportedRequest{Kind: "staking.redelegate"}
+	case msg.Withdraw != nil:
+		return nil, types.UnsupportedRequest{Kind: "staking.withdraw"}
+	default:
+		return nil, types.UnsupportedRequest{Kind: "staking"}
+	}
+}
+
+func (d *Dispatcher) dispatchWasm(ctx Context, contract types.HumanAddress, msg *types.WasmMsg) ([]Event, error) {
+	switch {
+	case msg.Execute != nil && d.execute != nil:
+		return d.execute(ctx, contract, msg.Execute)
+	case msg.Instantiate != nil && d.instantiate != nil:
+		return d.instantiate(ctx, contract, msg.Instantiate)
+	case d.wasm != nil:
+		return d.wasm(ctx, contract, msg)
+	case msg.Execute != nil:
+		return nil, types.UnsupportedRequest{Kind: "wasm.execute"}
+	case msg.Instantiate != nil:
+		return nil, types.UnsupportedRequest{Kind: "wasm.instantiate"}
+	default:
+		return nil, types.UnsupportedRequest{Kind: "wasm"}
+	}
+}
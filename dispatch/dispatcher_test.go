@@ -0,0 +1,135 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+const contractAddr = "contract"
+
+func sendMsg(to string) types.CosmosMsg {
+	return types.CosmosMsg{
+		Bank: &types.BankMsg{
+			Send: &types.SendMsg{
+				FromAddress: contractAddr,
+				ToAddress:   to,
+				Amount:      types.Coins{types.NewCoin(100, "ATOM")},
+			},
+		},
+	}
+}
+
+func delegateMsg(validator string) types.CosmosMsg {
+	return types.CosmosMsg{
+		Staking: &types.StakingMsg{
+			Delegate: &types.DelegateMsg{
+				Validator: validator,
+				Amount:    types.NewCoin(50, "stake"),
+			},
+		},
+	}
+}
+
+func event(typ, key, value string) Event {
+	return Event{Type: typ, Attributes: []types.LogAttribute{{Key: key, Value: value}}}
+}
+
+func TestDispatchRunsHandlersInOrder(t *testing.T) {
+	var calls []string
+	d := NewDispatcher().
+		HandleSend(func(ctx Context, contract types.HumanAddress, msg *types.SendMsg) ([]Event, error) {
+			assert.Equal(t, "ctx", ctx)
+			assert.Equal(t, contractAddr, contract)
+			calls = append(calls, "send:"+msg.ToAddress)
+			return []Event{event("transfer", "recipient", msg.ToAddress)}, nil
+		}).
+		HandleDelegate(func(ctx Context, contract types.HumanAddress, msg *types.DelegateMsg) ([]Event, error) {
+			calls = append(calls, "delegate:"+msg.Validator)
+			return []Event{event("delegate", "validator", msg.Validator)}, nil
+		})
+
+	msgs := []types.CosmosMsg{sendMsg("bob"), delegateMsg("val1"), sendMsg("alice")}
+	events, err := d.Dispatch("ctx", contractAddr, msgs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"send:bob", "delegate:val1", "send:alice"}, calls)
+	assert.Equal(t, []Event{
+		event("transfer", "recipient", "bob"),
+		event("delegate", "validator", "val1"),
+		event("transfer", "recipient", "alice"),
+	}, events)
+}
+
+func TestDispatchStopsAtFirstError(t *testing.T) {
+	var calls int
+	failure := types.NotFound{Kind: "account"}
+	d := NewDispatcher().HandleSend(func(ctx Context, contract types.HumanAddress, msg *types.SendMsg) ([]Event, error) {
+		calls++
+		if msg.ToAddress == "fail" {
+			return nil, failure
+		}
+		return []Event{event("transfer", "recipient", msg.ToAddress)}, nil
+	})
+
+	msgs := []types.CosmosMsg{sendMsg("bob"), sendMsg("fail"), sendMsg("alice")}
+	events, err := d.Dispatch(nil, contractAddr, msgs)
+	require.Error(t, err)
+	assert.Nil(t, events)
+	assert.Equal(t, 2, calls)
+	assert.True(t, errors.Is(err, failure))
+	_, code, ok := types.ABCIInfo(err)
+	require.True(t, ok)
+	assert.Equal(t, types.CodeNotFound, code)
+}
+
+func TestDispatchUnsupported(t *testing.T) {
+	d := NewDispatcher()
+
+	_, err := d.DispatchMsg(nil, contractAddr, &types.CosmosMsg{})
+	assert.IsType(t, types.UnsupportedRequest{}, err)
+
+	msg := sendMsg("bob")
+	_, err = d.DispatchMsg(nil, contractAddr, &msg)
+	assert.Equal(t, types.UnsupportedRequest{Kind: "bank.send"}, err)
+
+	msg = delegateMsg("val")
+	_, err = d.DispatchMsg(nil, contractAddr, &msg)
+	assert.Equal(t, types.UnsupportedRequest{Kind: "staking.delegate"}, err)
+
+	_, err = d.DispatchMsg(nil, contractAddr, &types.CosmosMsg{Wasm: &types.WasmMsg{Execute: &types.ExecuteMsg{}}})
+	assert.Equal(t, types.UnsupportedRequest{Kind: "wasm.execute"}, err)
+
+	_, err = d.DispatchMsg(nil, contractAddr, &types.CosmosMsg{Custom: json.RawMessage(`{}`)})
+	assert.Equal(t, types.UnsupportedRequest{Kind: "custom"}, err)
+}
+
+func TestDispatchFamilyFallback(t *testing.T) {
+	var families []string
+	d := NewDispatcher().
+		HandleStaking(func(ctx Context, contract types.HumanAddress, msg *types.StakingMsg) ([]Event, error) {
+			families = append(families, "staking")
+			return nil, nil
+		}).
+		HandleWithdraw(func(ctx Context, contract types.HumanAddress, msg *types.WithdrawMsg) ([]Event, error) {
+			families = append(families, "withdraw")
+			return nil, nil
+		}).
+		HandleCustom(func(ctx Context, contract types.HumanAddress, msg json.RawMessage) ([]Event, error) {
+			families = append(families, "custom:"+string(msg))
+			return nil, nil
+		})
+
+	msgs := []types.CosmosMsg{
+		delegateMsg("val"),
+		{Staking: &types.StakingMsg{Withdraw: &types.WithdrawMsg{Validator: "val"}}},
+		{Custom: json.RawMessage(`{"swap":{}}`)},
+	}
+	_, err := d.Dispatch(nil, contractAddr, msgs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"staking", "withdraw", `custom:{"swap":{}}`}, families)
+}
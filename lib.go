@@ -1,8 +1,12 @@
 package cosmwasm
 
 import (
-	"encoding/json"
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
 
 	"github.com/CosmWasm/go-cosmwasm/api"
 	"github.com/CosmWasm/go-cosmwasm/types"
@@ -26,11 +30,31 @@ type Querier = types.Querier
 // GasMeter is a read-only version of the sdk gas meter
 type GasMeter = api.GasMeter
 
+// CallbackPanicHandler is called by the Wasmer when one of the Go callbacks (storage, api or querier)
+// panicked during a contract call. The error carries the panic value, the stack trace and the callback name.
+// It is returned from the call as well, but the handler is the place to log it with the stack.
+type CallbackPanicHandler func(err types.CallbackPanicError)
+
+// LogCallbackPanic is the default CallbackPanicHandler, which writes the panic to the standard logger
+func LogCallbackPanic(err types.CallbackPanicError) {
+	log.Printf("Panic in Go callback %s: %#v\n%s", err.CallSite, err.Value, err.Stack)
+}
+
+// DefaultMaxCallDepth is the default limit of nested contract calls, see SetMaxCallDepth
+const DefaultMaxCallDepth = 10
+
 // Wasmer is the main entry point to this library.
 // You should create an instance with it's own subdirectory to manage state inside,
 // and call it for all cosmwasm code related actions.
 type Wasmer struct {
 	cache api.Cache
+
+	// versions caches the interface version of every code we have seen, indexed by string(CodeID)
+	versions      map[string]types.InterfaceVersion
+	versionsMutex sync.RWMutex
+
+	panicHandler CallbackPanicHandler
+	maxCallDepth int
 }
 
 // NewWasmer creates an new binding, with the given dataDir where
@@ -43,7 +67,57 @@ func NewWasmer(dataDir string, supportedFeatures string, cacheSize uint64) (*Was
 	if err != nil {
 		return nil, err
 	}
-	return &Wasmer{cache: cache}, nil
+	return &Wasmer{
+		cache:        cache,
+		versions:     make(map[string]types.InterfaceVersion),
+		panicHandler: LogCallbackPanic,
+		maxCallDepth: DefaultMaxCallDepth,
+	}, nil
+}
+
+// SetMaxCallDepth limits the depth of nested contract calls through smart queries, which protects
+// against stack exhaustion by contracts querying each other in a cycle. Smart queries that would go deeper
+// fail with types.ExceededRecursionLimit.
+//
+// The depth can only be tracked across nested calls if the Querier passed to the Wasmer implements
+// types.CallStackQuerier. This must be called before the Wasmer is used by multiple goroutines.
+func (w *Wasmer) SetMaxCallDepth(depth int) {
+	w.maxCallDepth = depth
+}
+
+// SetIteratorBatchSize lets contracts read the items of storage iterators in batches of size, see api.WithIteratorBatchSize
+// and api.DefaultIteratorBatchSize. It is disabled (0) by default, as it changes the gas consumed on the gas meter of the store.
+// This must be called before the Wasmer is used by multiple goroutines.
+func (w *Wasmer) SetIteratorBatchSize(size uint64) {
+	w.cache = api.WithIteratorBatchSize(w.cache, size)
+}
+
+// enterCall continues the call stack of querier with contract (if not empty) and wraps querier
+// to track the stack in the queries of the contract
+func (w *Wasmer) enterCall(querier Querier, contract types.HumanAddress) (Querier, error) {
+	stack := types.CallStackOf(querier)
+	if contract != "" {
+		stack = stack.Push(contract)
+	}
+	if stack.Depth() > w.maxCallDepth {
+		return nil, types.ExceededRecursionLimit{Limit: w.maxCallDepth}
+	}
+	return types.WithCallStack(querier, stack, w.maxCallDepth), nil
+}
+
+// SetCallbackPanicHandler replaces the handler for panics in Go callbacks, which is LogCallbackPanic by default.
+// Use nil to ignore them (they are still returned as types.CallbackPanicError).
+// This must be called before the Wasmer is used by multiple goroutines.
+func (w *Wasmer) SetCallbackPanicHandler(handler CallbackPanicHandler) {
+	w.panicHandler = handler
+}
+
+// reportCallbackPanic passes err to the panic handler if it is a types.CallbackPanicError
+func (w *Wasmer) reportCallbackPanic(err error) {
+	var panicErr types.CallbackPanicError
+	if w.panicHandler != nil && errors.As(err, &panicErr) {
+		w.panicHandler(panicErr)
+	}
 }
 
 // Cleanup should be called when no longer using this to free resources on the rust-side
@@ -62,7 +136,15 @@ func (w *Wasmer) Cleanup() {
 //
 // TODO: return gas cost? Add gas limit??? there is no metering here...
 func (w *Wasmer) Create(code WasmCode) (CodeID, error) {
-	return api.Create(w.cache, code)
+	id, err := api.Create(w.cache, code)
+	if err != nil {
+		return nil, err
+	}
+	// the VM accepted it, so we can remember the version right away
+	if version, err := detectInterfaceVersion(code); err == nil {
+		w.SetInterfaceVersion(id, version)
+	}
+	return id, nil
 }
 
 // GetCode will load the original wasm code for the given code id.
@@ -76,6 +158,65 @@ func (w *Wasmer) GetCode(code CodeID) (WasmCode, error) {
 	return api.GetCode(w.cache, code)
 }
 
+// Recompile compiles stored code again and writes its compiled module back to the data directory,
+// e.g. after the module was lost or corrupted on disk. The stored wasm is checked against the code id first,
+// if it does not match the code must be created again from the original wasm.
+func (w *Wasmer) Recompile(code CodeID) error {
+	wasm, err := w.GetCode(code)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(wasm); !bytes.Equal(sum[:], code) {
+		return fmt.Errorf("stored wasm of code %X does not match its code id", []byte(code))
+	}
+	// storing the same code again rewrites the wasm and the module
+	_, err = w.Create(wasm)
+	return err
+}
+
+// GetInterfaceVersion returns the version of the contract interface the given code was compiled against,
+// as marked by its `cosmwasm_vm_version_*` export. This determines the format of the results the
+// contract returns, which the Wasmer normalizes into types.Response.
+//
+// The result is cached, so only the first call for a given code id needs to load the wasm. Chains should
+// store the version with the code id after Create and hand it back with SetInterfaceVersion when they
+// start, so the wasm is never read for it.
+func (w *Wasmer) GetInterfaceVersion(code CodeID) (types.InterfaceVersion, error) {
+	w.versionsMutex.RLock()
+	version, ok := w.versions[string(code)]
+	w.versionsMutex.RUnlock()
+	if ok {
+		return version, nil
+	}
+
+	wasm, err := w.GetCode(code)
+	if err != nil {
+		return types.InterfaceVersionUnknown, err
+	}
+	version, err = detectInterfaceVersion(wasm)
+	if err != nil {
+		return types.InterfaceVersionUnknown, err
+	}
+	w.SetInterfaceVersion(code, version)
+	return version, nil
+}
+
+// SetInterfaceVersion tells the Wasmer the interface version of a code, as returned by GetInterfaceVersion before,
+// e.g. when a chain loads its stored codes
+func (w *Wasmer) SetInterfaceVersion(code CodeID, version types.InterfaceVersion) {
+	w.versionsMutex.Lock()
+	defer w.versionsMutex.Unlock()
+	w.versions[string(code)] = version
+}
+
+func detectInterfaceVersion(wasm []byte) (types.InterfaceVersion, error) {
+	module, err := types.ParseModule(wasm)
+	if err != nil {
+		return types.InterfaceVersionUnknown, err
+	}
+	return types.DetectInterfaceVersion(module.Exports)
+}
+
 // Instantiate will create a new contract based on the given codeID.
 // We can set the initMsg (contract "genesis") here, and it then receives
 // an account and address and can be invoked (Execute) many times.
@@ -93,25 +234,30 @@ func (w *Wasmer) Instantiate(
 	querier Querier,
 	gasMeter GasMeter,
 	gasLimit uint64,
-) (*types.InitResponse, uint64, error) {
-	paramBin, err := json.Marshal(env)
+) (*types.Response, uint64, error) {
+	version, err := w.GetInterfaceVersion(code)
+	if err != nil {
+		return nil, 0, err
+	}
+	paramBin, err := types.CanonicalJSONMarshal(env)
+	if err != nil {
+		return nil, 0, err
+	}
+	querier, err = w.enterCall(querier, env.Contract.Address)
 	if err != nil {
 		return nil, 0, err
 	}
 	data, gasUsed, err := api.Instantiate(w.cache, code, paramBin, initMsg, &gasMeter, store, &goapi, &querier, gasLimit)
 	if err != nil {
+		w.reportCallbackPanic(err)
 		return nil, gasUsed, err
 	}
 
-	var resp types.InitResult
-	err = json.Unmarshal(data, &resp)
+	resp, err := types.ParseResponse(version, data)
 	if err != nil {
 		return nil, gasUsed, err
 	}
-	if resp.Err != nil {
-		return nil, gasUsed, fmt.Errorf("%v", resp.Err)
-	}
-	return resp.Ok, gasUsed, nil
+	return resp, gasUsed, nil
 }
 
 // Execute calls a given contract. Since the only difference between contracts with the same CodeID is the
@@ -129,30 +275,45 @@ func (w *Wasmer) Execute(
 	querier Querier,
 	gasMeter GasMeter,
 	gasLimit uint64,
-) (*types.HandleResponse, uint64, error) {
-	paramBin, err := json.Marshal(env)
+) (*types.Response, uint64, error) {
+	version, err := w.GetInterfaceVersion(code)
+	if err != nil {
+		return nil, 0, err
+	}
+	paramBin, err := types.CanonicalJSONMarshal(env)
+	if err != nil {
+		return nil, 0, err
+	}
+	querier, err = w.enterCall(querier, env.Contract.Address)
 	if err != nil {
 		return nil, 0, err
 	}
 	data, gasUsed, err := api.Handle(w.cache, code, paramBin, executeMsg, &gasMeter, store, &goapi, &querier, gasLimit)
 	if err != nil {
+		w.reportCallbackPanic(err)
 		return nil, gasUsed, err
 	}
 
-	var resp types.HandleResult
-	err = json.Unmarshal(data, &resp)
+	resp, err := types.ParseResponse(version, data)
 	if err != nil {
 		return nil, gasUsed, err
 	}
-	if resp.Err != nil {
-		return nil, gasUsed, fmt.Errorf("%v", resp.Err)
-	}
-	return resp.Ok, gasUsed, nil
+	return resp, gasUsed, nil
+}
+
+// queryStore is the store a query gets: queries must not change the state, so writes
+// abort the contract with a types.WriteInQueryError
+func queryStore(store KVStore) KVStore {
+	return api.NewReadOnlyStore(store)
 }
 
 // Query allows a client to execute a contract-specific query. If the result is not empty, it should be
 // valid json-encoded data to return to the client.
 // The meaning of path and data can be determined by the code. Path is the suffix of the abci.QueryRequest.Path
+// The contract only gets read access to store. If it tries to write, the query fails with types.WriteInQueryError.
+//
+// For a smart query from another contract, querier should return the stack given to
+// types.CallStackQuerier.QueryWithCallStack, which already contains the address of this contract.
 func (w *Wasmer) Query(
 	code CodeID,
 	queryMsg []byte,
@@ -162,20 +323,25 @@ func (w *Wasmer) Query(
 	gasMeter GasMeter,
 	gasLimit uint64,
 ) ([]byte, uint64, error) {
-	data, gasUsed, err := api.Query(w.cache, code, queryMsg, &gasMeter, store, &goapi, &querier, gasLimit)
+	version, err := w.GetInterfaceVersion(code)
+	if err != nil {
+		return nil, 0, err
+	}
+	querier, err = w.enterCall(querier, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	data, gasUsed, err := api.Query(w.cache, code, queryMsg, &gasMeter, queryStore(store), &goapi, &querier, gasLimit)
 	if err != nil {
+		w.reportCallbackPanic(err)
 		return nil, gasUsed, err
 	}
 
-	var resp types.QueryResponse
-	err = json.Unmarshal(data, &resp)
+	resp, err := types.ParseQueryResult(version, data)
 	if err != nil {
 		return nil, gasUsed, err
 	}
-	if resp.Err != nil {
-		return nil, gasUsed, fmt.Errorf("%v", resp.Err)
-	}
-	return resp.Ok, gasUsed, nil
+	return resp, gasUsed, nil
 }
 
 // Migrate will migrate an existing contract to a new code binary.
@@ -193,23 +359,28 @@ func (w *Wasmer) Migrate(
 	querier Querier,
 	gasMeter GasMeter,
 	gasLimit uint64,
-) (*types.MigrateResponse, uint64, error) {
-	paramBin, err := json.Marshal(env)
+) (*types.Response, uint64, error) {
+	version, err := w.GetInterfaceVersion(code)
+	if err != nil {
+		return nil, 0, err
+	}
+	paramBin, err := types.CanonicalJSONMarshal(env)
+	if err != nil {
+		return nil, 0, err
+	}
+	querier, err = w.enterCall(querier, env.Contract.Address)
 	if err != nil {
 		return nil, 0, err
 	}
 	data, gasUsed, err := api.Migrate(w.cache, code, paramBin, migrateMsg, &gasMeter, store, &goapi, &querier, gasLimit)
 	if err != nil {
+		w.reportCallbackPanic(err)
 		return nil, gasUsed, err
 	}
 
-	var resp types.MigrateResult
-	err = json.Unmarshal(data, &resp)
+	resp, err := types.ParseResponse(version, data)
 	if err != nil {
 		return nil, gasUsed, err
 	}
-	if resp.Err != nil {
-		return nil, gasUsed, fmt.Errorf("%v", resp.Err)
-	}
-	return resp.Ok, gasUsed, nil
+	return resp, gasUsed, nil
 }
@@ -0,0 +1,111 @@
+package cosmwasm
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/CosmWasm/go-cosmwasm/api"
+	"github.com/CosmWasm/go-cosmwasm/datadir"
+)
+
+// memStore is a KVStore over a MemDB
+type memStore struct {
+	db *dbm.MemDB
+}
+
+var _ KVStore = memStore{}
+
+func newMemStore() memStore {
+	return memStore{db: dbm.NewMemDB()}
+}
+
+func (s memStore) Get(key []byte) []byte {
+	v, err := s.db.Get(key)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (s memStore) Set(key, value []byte) {
+	if err := s.db.Set(key, value); err != nil {
+		panic(err)
+	}
+}
+
+func (s memStore) Delete(key []byte) {
+	if err := s.db.Delete(key); err != nil {
+		panic(err)
+	}
+}
+
+func (s memStore) Iterator(start, end []byte) dbm.Iterator {
+	it, err := s.db.Iterator(start, end)
+	if err != nil {
+		panic(err)
+	}
+	return it
+}
+
+func (s memStore) ReverseIterator(start, end []byte) dbm.Iterator {
+	it, err := s.db.ReverseIterator(start, end)
+	if err != nil {
+		panic(err)
+	}
+	return it
+}
+
+func TestQueryStoreIsReadOnly(t *testing.T) {
+	store := newMemStore()
+	store.Set([]byte("foo"), []byte("bar"))
+
+	query := queryStore(store)
+	assert.True(t, api.IsReadOnly(query), "the db callbacks must reject writes of a query")
+	assert.Equal(t, []byte("bar"), query.Get([]byte("foo")))
+	assert.PanicsWithError(t, "contract tried to set key 666F6F in a read-only query", func() {
+		query.Set([]byte("foo"), []byte("changed"))
+	})
+	assert.PanicsWithError(t, "contract tried to delete key 666F6F in a read-only query", func() {
+		query.Delete([]byte("foo"))
+	})
+	assert.Equal(t, []byte("bar"), store.Get([]byte("foo")))
+}
+
+func TestRecompile(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "wasmer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+	wasmer, err := NewWasmer(dataDir, "staking", 0)
+	require.NoError(t, err)
+	defer wasmer.Cleanup()
+
+	wasm, err := ioutil.ReadFile("./api/testdata/hackatom.wasm")
+	require.NoError(t, err)
+	id, err := wasmer.Create(wasm)
+	require.NoError(t, err)
+
+	entries, err := datadir.List(dataDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NotEmpty(t, entries[0].Modules)
+	for _, m := range entries[0].Modules {
+		require.NoError(t, os.Remove(datadir.ModulePath(dataDir, m.Backend, id)))
+	}
+	problems, err := datadir.Verify(dataDir)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, datadir.ProblemMissingModule, problems[0].Kind)
+
+	require.NoError(t, wasmer.Recompile(id))
+	for _, m := range entries[0].Modules {
+		assert.FileExists(t, datadir.ModulePath(dataDir, m.Backend, id))
+	}
+	problems, err = datadir.Verify(dataDir)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
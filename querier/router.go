@@ -0,0 +1,148 @@
+// Package querier provides a composable implementation of types.Querier, so embedding chains
+// only have to implement the query families they support.
+package querier
+
+import (
+	"encoding/json"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// BankQuerier answers bank queries
+type BankQuerier interface {
+	Query(request *types.BankQuery) ([]byte, error)
+}
+
+// StakingQuerier answers staking queries
+type StakingQuerier interface {
+	Query(request *types.StakingQuery) ([]byte, error)
+}
+
+// WasmQuerier answers queries to other contracts. It gets the remaining gas of the calling contract,
+// as a smart query executes another contract. For smart queries, stack ends with the queried contract.
+// It must be set as Stack of the QueryRouter passed to the nested Wasmer call, to limit the call depth.
+type WasmQuerier interface {
+	Query(request *types.WasmQuery, gasLimit uint64, stack types.CallStack) ([]byte, error)
+}
+
+// CustomQuerier answers chain specific queries, the request is passed as it comes from the contract
+type CustomQuerier interface {
+	Query(request json.RawMessage) ([]byte, error)
+}
+
+// GasMeter is the part of the sdk gas meter we need to see what the sub-queriers charged
+type GasMeter interface {
+	GasConsumed() uint64
+}
+
+// TerraQuery is the envelope of custom queries on Terra, which are routed to a module by name
+type TerraQuery struct {
+	Route     string          `json:"route"`
+	QueryData json.RawMessage `json:"query_data"`
+}
+
+// QueryRouter implements types.Querier by dispatching each request to the sub-querier of its family.
+// Requests of a family without sub-querier are rejected with types.UnsupportedRequest.
+//
+// Custom queries that come in the TerraQuery envelope are routed to the matching entry of Terra
+// (getting only the query_data), all other custom queries go to Custom.
+//
+// The gas reported to the VM is the flat QueryCost per query plus everything the sub-queriers charged
+// on GasMeter (if set). Since a QueryRouter counts gas, use a new one for every contract call.
+type QueryRouter struct {
+	Bank    BankQuerier
+	Staking StakingQuerier
+	Wasm    WasmQuerier
+	Custom  CustomQuerier
+	Terra   map[string]CustomQuerier
+
+	// GasMeter is optional and should be the meter the sub-queriers charge on
+	GasMeter GasMeter
+	// QueryCost is charged for every query, independent of the result
+	QueryCost uint64
+	// Stack is the call stack of the contract call the router is used for, empty for calls from a transaction
+	Stack types.CallStack
+
+	usedGas uint64
+}
+
+var _ types.CallStackQuerier = (*QueryRouter)(nil)
+
+// NewQueryRouter returns a router without any routes, which can be set on the returned value
+func NewQueryRouter(gasMeter GasMeter, queryCost uint64) *QueryRouter {
+	return &QueryRouter{
+		Terra:     make(map[string]CustomQuerier),
+		GasMeter:  gasMeter,
+		QueryCost: queryCost,
+	}
+}
+
+// Query implements types.Querier
+func (r *QueryRouter) Query(request types.QueryRequest, gasLimit uint64) ([]byte, error) {
+	stack := r.Stack
+	if request.Wasm != nil && request.Wasm.Smart != nil {
+		stack = stack.Push(request.Wasm.Smart.ContractAddr)
+	}
+	return r.QueryWithCallStack(request, gasLimit, stack)
+}
+
+// CallStack implements types.CallStackQuerier
+func (r *QueryRouter) CallStack() types.CallStack {
+	return r.Stack
+}
+
+// QueryWithCallStack implements types.CallStackQuerier
+func (r *QueryRouter) QueryWithCallStack(request types.QueryRequest, gasLimit uint64, stack types.CallStack) ([]byte, error) {
+	r.usedGas += r.QueryCost
+	switch {
+	case request.Bank != nil:
+		if r.Bank == nil {
+			return nil, types.UnsupportedRequest{Kind: "bank"}
+		}
+		return r.Bank.Query(request.Bank)
+	case request.Staking != nil:
+		if r.Staking == nil {
+			return nil, types.UnsupportedRequest{Kind: "staking"}
+		}
+		return r.Staking.Query(request.Staking)
+	case request.Wasm != nil:
+		if r.Wasm == nil {
+			return nil, types.UnsupportedRequest{Kind: "wasm"}
+		}
+		remaining := uint64(0)
+		if gasLimit > r.QueryCost {
+			remaining = gasLimit - r.QueryCost
+		}
+		return r.Wasm.Query(request.Wasm, remaining, stack)
+	case request.Custom != nil:
+		return r.queryCustom(request.Custom)
+	default:
+		return nil, types.UnsupportedRequest{Kind: "unknown query"}
+	}
+}
+
+func (r *QueryRouter) queryCustom(request json.RawMessage) ([]byte, error) {
+	if len(r.Terra) != 0 {
+		var terra TerraQuery
+		if err := json.Unmarshal(request, &terra); err == nil && terra.Route != "" {
+			if q, ok := r.Terra[terra.Route]; ok {
+				return q.Query(terra.QueryData)
+			}
+			if r.Custom == nil {
+				return nil, types.UnsupportedRequest{Kind: "custom route " + terra.Route}
+			}
+		}
+	}
+	if r.Custom == nil {
+		return nil, types.UnsupportedRequest{Kind: "custom"}
+	}
+	return r.Custom.Query(request)
+}
+
+// GasConsumed implements types.Querier
+func (r *QueryRouter) GasConsumed() uint64 {
+	if r.GasMeter == nil {
+		return r.usedGas
+	}
+	return r.usedGas + r.GasMeter.GasConsumed()
+}
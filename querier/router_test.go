@@ -0,0 +1,133 @@
+package querier
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+type meter struct {
+	consumed uint64
+}
+
+func (m *meter) GasConsumed() uint64 {
+	return m.consumed
+}
+
+type bankQuerier struct {
+	meter *meter
+}
+
+func (q bankQuerier) Query(request *types.BankQuery) ([]byte, error) {
+	q.meter.consumed += 1000
+	if request.Balance == nil {
+		return nil, types.UnsupportedRequest{Kind: "bank"}
+	}
+	return json.Marshal(types.BalanceResponse{Amount: types.NewCoin(123, request.Balance.Denom)})
+}
+
+type wasmQuerier struct {
+	lastLimit uint64
+	lastStack types.CallStack
+}
+
+func (q *wasmQuerier) Query(request *types.WasmQuery, gasLimit uint64, stack types.CallStack) ([]byte, error) {
+	q.lastLimit = gasLimit
+	q.lastStack = stack
+	return []byte(`{"wasm":true}`), nil
+}
+
+type echoQuerier string
+
+func (q echoQuerier) Query(request json.RawMessage) ([]byte, error) {
+	return []byte(string(q) + ":" + string(request)), nil
+}
+
+func TestRouterDispatchesByFamily(t *testing.T) {
+	m := &meter{}
+	wasm := &wasmQuerier{}
+	router := NewQueryRouter(m, 10)
+	router.Bank = bankQuerier{meter: m}
+	router.Wasm = wasm
+
+	bz, err := router.Query(types.QueryRequest{Bank: &types.BankQuery{Balance: &types.BalanceQuery{Address: "foo", Denom: "uluna"}}}, 5000)
+	require.NoError(t, err)
+	var balance types.BalanceResponse
+	require.NoError(t, json.Unmarshal(bz, &balance))
+	assert.Equal(t, types.NewCoin(123, "uluna"), balance.Amount)
+	// flat cost plus what the bank querier charged
+	assert.Equal(t, uint64(1010), router.GasConsumed())
+
+	bz, err = router.Query(types.QueryRequest{Wasm: &types.WasmQuery{Smart: &types.SmartQuery{ContractAddr: "other"}}}, 5000)
+	require.NoError(t, err)
+	assert.Equal(t, `{"wasm":true}`, string(bz))
+	assert.Equal(t, uint64(4990), wasm.lastLimit)
+	assert.Equal(t, uint64(1020), router.GasConsumed())
+}
+
+func TestRouterUnsetRoutes(t *testing.T) {
+	router := NewQueryRouter(nil, 0)
+
+	_, err := router.Query(types.QueryRequest{Bank: &types.BankQuery{}}, 100)
+	assert.Equal(t, types.UnsupportedRequest{Kind: "bank"}, err)
+	_, err = router.Query(types.QueryRequest{Staking: &types.StakingQuery{}}, 100)
+	assert.Equal(t, types.UnsupportedRequest{Kind: "staking"}, err)
+	_, err = router.Query(types.QueryRequest{Wasm: &types.WasmQuery{}}, 100)
+	assert.Equal(t, types.UnsupportedRequest{Kind: "wasm"}, err)
+	_, err = router.Query(types.QueryRequest{Custom: json.RawMessage(`{}`)}, 100)
+	assert.Equal(t, types.UnsupportedRequest{Kind: "custom"}, err)
+	_, err = router.Query(types.QueryRequest{}, 100)
+	assert.IsType(t, types.UnsupportedRequest{}, err)
+
+	// this is what the contract gets to see
+	res := types.ToQuerierResult(router.Query(types.QueryRequest{Bank: &types.BankQuery{}}, 100))
+	require.NotNil(t, res.Err)
+	assert.NotNil(t, res.Err.UnsupportedRequest)
+}
+
+func TestRouterTerraRoutes(t *testing.T) {
+	router := NewQueryRouter(nil, 0)
+	router.Terra["market"] = echoQuerier("market")
+	router.Terra["oracle"] = echoQuerier("oracle")
+
+	bz, err := router.Query(types.QueryRequest{Custom: json.RawMessage(`{"route":"oracle","query_data":{"exchange_rates":{}}}`)}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, `oracle:{"exchange_rates":{}}`, string(bz))
+
+	_, err = router.Query(types.QueryRequest{Custom: json.RawMessage(`{"route":"treasury","query_data":{}}`)}, 100)
+	assert.Equal(t, types.UnsupportedRequest{Kind: "custom route treasury"}, err)
+
+	// everything else falls through to the generic custom querier
+	router.Custom = echoQuerier("custom")
+	bz, err = router.Query(types.QueryRequest{Custom: json.RawMessage(`{"ping":{}}`)}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, `custom:{"ping":{}}`, string(bz))
+	bz, err = router.Query(types.QueryRequest{Custom: json.RawMessage(`{"route":"treasury","query_data":{}}`)}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, `custom:{"route":"treasury","query_data":{}}`, string(bz))
+}
+
+func TestRouterPassesCallStack(t *testing.T) {
+	wasm := &wasmQuerier{}
+	router := NewQueryRouter(nil, 0)
+	router.Wasm = wasm
+	router.Stack = types.CallStack{"a"}
+	assert.Equal(t, types.CallStack{"a"}, router.CallStack())
+
+	// called directly, the router pushes the target of smart queries itself
+	_, err := router.Query(types.QueryRequest{Wasm: &types.WasmQuery{Smart: &types.SmartQuery{ContractAddr: "b"}}}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, types.CallStack{"a", "b"}, wasm.lastStack)
+
+	// through the wrapper of the Wasmer, which also limits the depth
+	querier := types.WithCallStack(router, router.Stack, 1)
+	_, err = querier.Query(types.QueryRequest{Wasm: &types.WasmQuery{Raw: &types.RawQuery{ContractAddr: "b"}}}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, types.CallStack{"a"}, wasm.lastStack)
+	_, err = querier.Query(types.QueryRequest{Wasm: &types.WasmQuery{Smart: &types.SmartQuery{ContractAddr: "b"}}}, 100)
+	assert.Equal(t, types.ExceededRecursionLimit{Limit: 1}, err)
+}
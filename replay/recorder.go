@@ -0,0 +1,264 @@
+package replay
+
+import (
+	"encoding/json"
+	"sync"
+
+	dbm "github.com/tendermint/tm-db"
+
+	wasm "github.com/CosmWasm/go-cosmwasm"
+	"github.com/CosmWasm/go-cosmwasm/api"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// Recorder wraps a Wasmer and records every Instantiate, Execute, Migrate and Query call.
+// All other methods are those of the Wasmer. It is safe for concurrent use like the Wasmer.
+type Recorder struct {
+	*wasm.Wasmer
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder returns a Recorder which runs the calls on wasmer
+func NewRecorder(wasmer *wasm.Wasmer) *Recorder {
+	return &Recorder{Wasmer: wasmer}
+}
+
+// Calls returns the calls recorded so far, in the order they finished
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Reset forgets the recorded calls
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+func (r *Recorder) add(call *Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, *call)
+}
+
+// Instantiate records a call of Wasmer.Instantiate
+func (r *Recorder) Instantiate(
+	code wasm.CodeID,
+	env types.Env,
+	initMsg []byte,
+	store wasm.KVStore,
+	goapi wasm.GoAPI,
+	querier wasm.Querier,
+	gasMeter wasm.GasMeter,
+	gasLimit uint64,
+) (*types.Response, uint64, error) {
+	call := &Call{Kind: KindInstantiate, CodeID: code, Env: &env, Msg: initMsg, GasLimit: gasLimit}
+	res, gasUsed, err := r.Wasmer.Instantiate(code, env, initMsg, recordStore(store, gasMeter, call), goapi,
+		recordQuerier(querier, call), gasMeter, gasLimit)
+	call.finish(res, gasUsed, err)
+	r.add(call)
+	return res, gasUsed, err
+}
+
+// Execute records a call of Wasmer.Execute
+func (r *Recorder) Execute(
+	code wasm.CodeID,
+	env types.Env,
+	executeMsg []byte,
+	store wasm.KVStore,
+	goapi wasm.GoAPI,
+	querier wasm.Querier,
+	gasMeter wasm.GasMeter,
+	gasLimit uint64,
+) (*types.Response, uint64, error) {
+	call := &Call{Kind: KindExecute, CodeID: code, Env: &env, Msg: executeMsg, GasLimit: gasLimit}
+	res, gasUsed, err := r.Wasmer.Execute(code, env, executeMsg, recordStore(store, gasMeter, call), goapi,
+		recordQuerier(querier, call), gasMeter, gasLimit)
+	call.finish(res, gasUsed, err)
+	r.add(call)
+	return res, gasUsed, err
+}
+
+// Migrate records a call of Wasmer.Migrate
+func (r *Recorder) Migrate(
+	code wasm.CodeID,
+	env types.Env,
+	migrateMsg []byte,
+	store wasm.KVStore,
+	goapi wasm.GoAPI,
+	querier wasm.Querier,
+	gasMeter wasm.GasMeter,
+	gasLimit uint64,
+) (*types.Response, uint64, error) {
+	call := &Call{Kind: KindMigrate, CodeID: code, Env: &env, Msg: migrateMsg, GasLimit: gasLimit}
+	res, gasUsed, err := r.Wasmer.Migrate(code, env, migrateMsg, recordStore(store, gasMeter, call), goapi,
+		recordQuerier(querier, call), gasMeter, gasLimit)
+	call.finish(res, gasUsed, err)
+	r.add(call)
+	return res, gasUsed, err
+}
+
+// Query records a call of Wasmer.Query
+func (r *Recorder) Query(
+	code wasm.CodeID,
+	queryMsg []byte,
+	store wasm.KVStore,
+	goapi wasm.GoAPI,
+	querier wasm.Querier,
+	gasMeter wasm.GasMeter,
+	gasLimit uint64,
+) ([]byte, uint64, error) {
+	call := &Call{Kind: KindQuery, CodeID: code, Msg: queryMsg, GasLimit: gasLimit}
+	res, gasUsed, err := r.Wasmer.Query(code, queryMsg, recordStore(store, gasMeter, call), goapi,
+		recordQuerier(querier, call), gasMeter, gasLimit)
+	call.finish(res, gasUsed, err)
+	r.add(call)
+	return res, gasUsed, err
+}
+
+func (c *Call) finish(res interface{}, gasUsed uint64, err error) {
+	c.GasUsed = gasUsed
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	// the response types are plain JSON structs, so this cannot fail
+	c.Response, _ = json.Marshal(res)
+}
+
+// recordingStore records the operations on a store, with the gas charged on the meter of the call
+type recordingStore struct {
+	store wasm.KVStore
+	meter wasm.GasMeter
+	call  *Call
+}
+
+var _ wasm.KVStore = recordingStore{}
+
+func recordStore(store wasm.KVStore, meter wasm.GasMeter, call *Call) wasm.KVStore {
+	return recordingStore{store: store, meter: meter, call: call}
+}
+
+// ReadOnly forwards the read-only marker of the recorded store, see api.IsReadOnly
+func (s recordingStore) ReadOnly() bool {
+	return api.IsReadOnly(s.store)
+}
+
+func (s recordingStore) Get(key []byte) []byte {
+	before := s.meter.GasConsumed()
+	value := s.store.Get(key)
+	s.call.Store = append(s.call.Store, StoreOp{Op: OpGet, Key: copyBytes(key), Value: copyBytes(value),
+		Gas: s.meter.GasConsumed() - before})
+	return value
+}
+
+func (s recordingStore) Set(key, value []byte) {
+	before := s.meter.GasConsumed()
+	s.store.Set(key, value)
+	s.call.Store = append(s.call.Store, StoreOp{Op: OpSet, Key: copyBytes(key), Value: copyBytes(value),
+		Gas: s.meter.GasConsumed() - before})
+}
+
+func (s recordingStore) Delete(key []byte) {
+	before := s.meter.GasConsumed()
+	s.store.Delete(key)
+	s.call.Store = append(s.call.Store, StoreOp{Op: OpDelete, Key: copyBytes(key),
+		Gas: s.meter.GasConsumed() - before})
+}
+
+func (s recordingStore) Iterator(start, end []byte) dbm.Iterator {
+	before := s.meter.GasConsumed()
+	it := s.store.Iterator(start, end)
+	return s.recordIterator(OpIterator, start, end, it, before)
+}
+
+func (s recordingStore) ReverseIterator(start, end []byte) dbm.Iterator {
+	before := s.meter.GasConsumed()
+	it := s.store.ReverseIterator(start, end)
+	return s.recordIterator(OpReverseIterator, start, end, it, before)
+}
+
+func (s recordingStore) recordIterator(op string, start, end []byte, it dbm.Iterator, before uint64) dbm.Iterator {
+	s.call.Store = append(s.call.Store, StoreOp{Op: op, Start: copyBytes(start), End: copyBytes(end),
+		Gas: s.meter.GasConsumed() - before})
+	return &recordingIterator{Iterator: it, meter: s.meter, call: s.call, index: len(s.call.Store) - 1}
+}
+
+// recordingIterator adds every item the contract moves past to the operation that created it
+type recordingIterator struct {
+	dbm.Iterator
+	meter wasm.GasMeter
+	call  *Call
+	index int
+}
+
+func (it *recordingIterator) Next() {
+	if !it.Valid() {
+		it.Iterator.Next()
+		return
+	}
+	item := StoreItem{Key: copyBytes(it.Key()), Value: copyBytes(it.Value())}
+	before := it.meter.GasConsumed()
+	it.Iterator.Next()
+	item.Gas = it.meter.GasConsumed() - before
+	op := &it.call.Store[it.index]
+	op.Items = append(op.Items, item)
+}
+
+// recordingQuerier records the queries and their results. It passes the call stack on, so the Wasmer
+// can still limit the depth of nested queries.
+type recordingQuerier struct {
+	querier types.Querier
+	call    *Call
+}
+
+var _ types.CallStackQuerier = recordingQuerier{}
+
+func recordQuerier(querier types.Querier, call *Call) types.Querier {
+	return recordingQuerier{querier: querier, call: call}
+}
+
+func (q recordingQuerier) Query(request types.QueryRequest, gasLimit uint64) ([]byte, error) {
+	return q.record(request, func() ([]byte, error) {
+		return q.querier.Query(request, gasLimit)
+	})
+}
+
+func (q recordingQuerier) GasConsumed() uint64 {
+	return q.querier.GasConsumed()
+}
+
+func (q recordingQuerier) CallStack() types.CallStack {
+	return types.CallStackOf(q.querier)
+}
+
+func (q recordingQuerier) QueryWithCallStack(request types.QueryRequest, gasLimit uint64, stack types.CallStack) ([]byte, error) {
+	return q.record(request, func() ([]byte, error) {
+		if sq, ok := q.querier.(types.CallStackQuerier); ok {
+			return sq.QueryWithCallStack(request, gasLimit, stack)
+		}
+		return q.querier.Query(request, gasLimit)
+	})
+}
+
+func (q recordingQuerier) record(request types.QueryRequest, query func() ([]byte, error)) ([]byte, error) {
+	before := q.querier.GasConsumed()
+	res, err := query()
+	q.call.Queries = append(q.call.Queries, QueryRecord{
+		Request: request,
+		Result:  types.ToQuerierResult(res, err),
+		Gas:     q.querier.GasConsumed() - before,
+	})
+	return res, err
+}
+
+func copyBytes(bz []byte) []byte {
+	if bz == nil {
+		return nil
+	}
+	return append([]byte{}, bz...)
+}
@@ -0,0 +1,94 @@
+// Package replay records the inputs and outputs of Wasmer calls and re-executes them offline.
+//
+// A Recorder is a drop-in replacement for the Wasmer which captures every call: the env and message,
+// every storage operation with its result and gas, and every query with its answer. Replay runs a recorded
+// call again, feeding back the recorded reads and query answers instead of a live store and querier,
+// and reports where the response, the error, the gas or the writes differ. This checks that an upgrade
+// of the VM or of this library keeps the consensus relevant behavior of historical transactions.
+package replay
+
+import (
+	"encoding/json"
+
+	wasm "github.com/CosmWasm/go-cosmwasm"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// kinds of calls
+const (
+	KindInstantiate = "instantiate"
+	KindExecute     = "execute"
+	KindMigrate     = "migrate"
+	KindQuery       = "query"
+)
+
+// storage operations
+const (
+	OpGet             = "get"
+	OpSet             = "set"
+	OpDelete          = "delete"
+	OpIterator        = "iterator"
+	OpReverseIterator = "reverse_iterator"
+)
+
+// Call is everything that went into and came out of one contract call
+type Call struct {
+	Kind   string      `json:"kind"`
+	CodeID wasm.CodeID `json:"code_id"`
+	// Env is nil for queries
+	Env      *types.Env `json:"env,omitempty"`
+	Msg      []byte     `json:"msg"`
+	GasLimit uint64     `json:"gas_limit"`
+
+	// Store lists the storage operations in the order the contract made them
+	Store []StoreOp `json:"store"`
+	// Queries lists the queries in the order the contract made them
+	Queries []QueryRecord `json:"queries"`
+
+	// Response is the JSON encoding of the response, the result bytes for queries
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	GasUsed  uint64          `json:"gas_used"`
+}
+
+// StoreOp is one storage operation. Value is the result of a get (nil if the key was not found)
+// or the value of a set. Iterators list the items the contract read from them.
+type StoreOp struct {
+	Op    string      `json:"op"`
+	Key   []byte      `json:"key,omitempty"`
+	Value []byte      `json:"value"`
+	Start []byte      `json:"start,omitempty"`
+	End   []byte      `json:"end,omitempty"`
+	Items []StoreItem `json:"items,omitempty"`
+	// Gas is what the operation charged on the gas meter, for iterators only the creation
+	Gas uint64 `json:"gas"`
+}
+
+// StoreItem is an item read from an iterator, with the gas charged for moving to the next one
+type StoreItem struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Gas   uint64 `json:"gas"`
+}
+
+// QueryRecord is a query of the contract with the answer it got
+type QueryRecord struct {
+	Request types.QueryRequest  `json:"request"`
+	Result  types.QuerierResult `json:"result"`
+	// Gas is what the querier charged for the query
+	Gas uint64 `json:"gas"`
+}
+
+// writes returns the net effect of the operations on the store, nil values mean deleted keys
+func writes(ops []StoreOp) map[string][]byte {
+	res := make(map[string][]byte)
+	for _, op := range ops {
+		switch op.Op {
+		case OpSet:
+			res[string(op.Key)] = op.Value
+		case OpDelete:
+			res[string(op.Key)] = nil
+		}
+	}
+	return res
+}
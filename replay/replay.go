@@ -0,0 +1,361 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	dbm "github.com/tendermint/tm-db"
+
+	wasm "github.com/CosmWasm/go-cosmwasm"
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+// Divergence is a difference between a recorded call and its replay
+type Divergence struct {
+	// What is one of "response", "error", "gas", "store", "query" and "writes"
+	What   string `json:"what"`
+	Detail string `json:"detail"`
+}
+
+func (d Divergence) String() string {
+	return d.What + ": " + d.Detail
+}
+
+// Report is the result of replaying a call
+type Report struct {
+	// Replayed is the call as recorded during the replay
+	Replayed    Call         `json:"replayed"`
+	Divergences []Divergence `json:"divergences"`
+}
+
+// OK is true if the replay did exactly what was recorded
+func (r *Report) OK() bool {
+	return len(r.Divergences) == 0
+}
+
+func (r *Report) diverge(what string, format string, args ...interface{}) {
+	r.Divergences = append(r.Divergences, Divergence{What: what, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Replay runs a recorded call again on wasmer, which must have the code of the call. The store and the querier
+// answer with what was recorded and charge the recorded gas. goapi should be configured like the one of the
+// recorded call, since address conversions are not recorded.
+//
+// As long as the contract makes the recorded storage operations and queries in the recorded order,
+// they are answered from the recording. After the first difference, which is reported, the storage is served
+// from the state known from the recording, without gas, and unrecorded queries fail with types.Unknown.
+func Replay(wasmer *wasm.Wasmer, call Call, goapi wasm.GoAPI) (*Report, error) {
+	store := newReplayStore(call.Store)
+	querier := &replayQuerier{queries: call.Queries}
+	recorder := NewRecorder(wasmer)
+	switch call.Kind {
+	case KindInstantiate, KindExecute, KindMigrate:
+		if call.Env == nil {
+			return nil, fmt.Errorf("%s call without env", call.Kind)
+		}
+	}
+	switch call.Kind {
+	case KindInstantiate:
+		recorder.Instantiate(call.CodeID, *call.Env, call.Msg, store, goapi, querier, store.meter, call.GasLimit)
+	case KindExecute:
+		recorder.Execute(call.CodeID, *call.Env, call.Msg, store, goapi, querier, store.meter, call.GasLimit)
+	case KindMigrate:
+		recorder.Migrate(call.CodeID, *call.Env, call.Msg, store, goapi, querier, store.meter, call.GasLimit)
+	case KindQuery:
+		recorder.Query(call.CodeID, call.Msg, store, goapi, querier, store.meter, call.GasLimit)
+	default:
+		return nil, fmt.Errorf("unknown kind of call %q", call.Kind)
+	}
+
+	report := &Report{Replayed: recorder.Calls()[0]}
+	report.Divergences = append(report.Divergences, store.divergences...)
+	if !store.diverged && store.next < len(store.ops) {
+		report.diverge("store", "replayed %d of %d operations", store.next, len(store.ops))
+	}
+	report.Divergences = append(report.Divergences, querier.divergences...)
+	if querier.next < len(querier.queries) {
+		report.diverge("query", "replayed %d of %d queries", querier.next, len(querier.queries))
+	}
+	compare(report, &call, &report.Replayed)
+	return report, nil
+}
+
+// compare adds the differences in the outcome of two calls to the report
+func compare(report *Report, recorded *Call, replayed *Call) {
+	if recorded.Error != replayed.Error {
+		report.diverge("error", "recorded %q, replayed %q", recorded.Error, replayed.Error)
+	}
+	if !bytes.Equal(recorded.Response, replayed.Response) {
+		report.diverge("response", "recorded %s, replayed %s", recorded.Response, replayed.Response)
+	}
+	if recorded.GasUsed != replayed.GasUsed {
+		report.diverge("gas", "recorded %d, replayed %d", recorded.GasUsed, replayed.GasUsed)
+	}
+
+	before, after := writes(recorded.Store), writes(replayed.Store)
+	var keys []string
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v1, ok1 := before[key]
+		v2, ok2 := after[key]
+		if ok1 != ok2 || (v1 == nil) != (v2 == nil) || !bytes.Equal(v1, v2) {
+			report.diverge("writes", "key %X: recorded %s, replayed %s", key, describeWrite(v1, ok1), describeWrite(v2, ok2))
+		}
+	}
+}
+
+func describeWrite(value []byte, written bool) string {
+	switch {
+	case !written:
+		return "no write"
+	case value == nil:
+		return "delete"
+	default:
+		return fmt.Sprintf("set %X", value)
+	}
+}
+
+// replayMeter is the gas meter of a replay, charged with the recorded gas of the storage operations
+type replayMeter struct {
+	consumed uint64
+}
+
+func (m *replayMeter) GasConsumed() uint64 {
+	return m.consumed
+}
+
+// replayStore answers storage operations from a recording
+type replayStore struct {
+	ops []StoreOp
+	// next is the index of the recorded operation the contract should make next
+	next     int
+	diverged bool
+	// state is the storage as far as known from the recording, updated with the writes of the replay
+	state       *dbm.MemDB
+	meter       *replayMeter
+	divergences []Divergence
+}
+
+var _ wasm.KVStore = (*replayStore)(nil)
+
+func newReplayStore(ops []StoreOp) *replayStore {
+	return &replayStore{ops: ops, state: initialState(ops), meter: &replayMeter{}}
+}
+
+// initialState is the storage before the call, as far as the call read it
+func initialState(ops []StoreOp) *dbm.MemDB {
+	state := dbm.NewMemDB()
+	written := make(map[string]bool)
+	known := func(key, value []byte) {
+		if value != nil && !written[string(key)] {
+			mustSet(state, key, value)
+		}
+	}
+	for _, op := range ops {
+		switch op.Op {
+		case OpGet:
+			known(op.Key, op.Value)
+		case OpSet, OpDelete:
+			written[string(op.Key)] = true
+		case OpIterator, OpReverseIterator:
+			for _, item := range op.Items {
+				known(item.Key, item.Value)
+			}
+		}
+	}
+	return state
+}
+
+// match returns the next recorded operation if it equals the given one, and reports the first divergence
+func (s *replayStore) match(op StoreOp) (*StoreOp, bool) {
+	if s.diverged {
+		return nil, false
+	}
+	if s.next < len(s.ops) {
+		rec := &s.ops[s.next]
+		if rec.Op == op.Op && bytes.Equal(rec.Key, op.Key) && bytes.Equal(rec.Start, op.Start) &&
+			bytes.Equal(rec.End, op.End) && (op.Op != OpSet || bytes.Equal(rec.Value, op.Value)) {
+			s.next++
+			s.meter.consumed += rec.Gas
+			return rec, true
+		}
+		s.diverged = true
+		s.divergences = append(s.divergences, Divergence{What: "store", Detail: fmt.Sprintf(
+			"operation %d: recorded %s, replayed %s", s.next+1, describeOp(rec), describeOp(&op))})
+		return nil, false
+	}
+	s.diverged = true
+	s.divergences = append(s.divergences, Divergence{What: "store", Detail: fmt.Sprintf(
+		"operation %d: nothing recorded, replayed %s", s.next+1, describeOp(&op))})
+	return nil, false
+}
+
+func describeOp(op *StoreOp) string {
+	switch op.Op {
+	case OpIterator, OpReverseIterator:
+		return fmt.Sprintf("%s %X..%X", op.Op, op.Start, op.End)
+	case OpSet:
+		return fmt.Sprintf("%s %X=%X", op.Op, op.Key, op.Value)
+	default:
+		return fmt.Sprintf("%s %X", op.Op, op.Key)
+	}
+}
+
+func (s *replayStore) Get(key []byte) []byte {
+	if rec, ok := s.match(StoreOp{Op: OpGet, Key: key}); ok {
+		return rec.Value
+	}
+	value, err := s.state.Get(key)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func (s *replayStore) Set(key, value []byte) {
+	s.match(StoreOp{Op: OpSet, Key: key, Value: value})
+	mustSet(s.state, key, value)
+}
+
+func (s *replayStore) Delete(key []byte) {
+	s.match(StoreOp{Op: OpDelete, Key: key})
+	if err := s.state.Delete(key); err != nil {
+		panic(err)
+	}
+}
+
+func (s *replayStore) Iterator(start, end []byte) dbm.Iterator {
+	if rec, ok := s.match(StoreOp{Op: OpIterator, Start: start, End: end}); ok {
+		return &replayIterator{store: s, op: rec}
+	}
+	it, err := s.state.Iterator(start, end)
+	if err != nil {
+		panic(err)
+	}
+	return it
+}
+
+func (s *replayStore) ReverseIterator(start, end []byte) dbm.Iterator {
+	if rec, ok := s.match(StoreOp{Op: OpReverseIterator, Start: start, End: end}); ok {
+		return &replayIterator{store: s, op: rec}
+	}
+	it, err := s.state.ReverseIterator(start, end)
+	if err != nil {
+		panic(err)
+	}
+	return it
+}
+
+func mustSet(db *dbm.MemDB, key, value []byte) {
+	if value == nil {
+		value = []byte{}
+	}
+	if err := db.Set(key, value); err != nil {
+		panic(err)
+	}
+}
+
+// replayIterator returns the recorded items of an iterator
+type replayIterator struct {
+	store *replayStore
+	op    *StoreOp
+	pos   int
+}
+
+var _ dbm.Iterator = (*replayIterator)(nil)
+
+func (it *replayIterator) Domain() ([]byte, []byte) {
+	return it.op.Start, it.op.End
+}
+
+// Valid is false after the recorded items, either the end of the range or where the contract stopped reading
+func (it *replayIterator) Valid() bool {
+	return it.pos < len(it.op.Items)
+}
+
+func (it *replayIterator) Next() {
+	if !it.Valid() {
+		panic("next on invalid iterator")
+	}
+	it.store.meter.consumed += it.op.Items[it.pos].Gas
+	it.pos++
+}
+
+func (it *replayIterator) Key() []byte {
+	if !it.Valid() {
+		panic("key on invalid iterator")
+	}
+	return it.op.Items[it.pos].Key
+}
+
+func (it *replayIterator) Value() []byte {
+	if !it.Valid() {
+		panic("value on invalid iterator")
+	}
+	return it.op.Items[it.pos].Value
+}
+
+func (it *replayIterator) Error() error {
+	return nil
+}
+
+func (it *replayIterator) Close() {}
+
+// replayQuerier answers queries with the recorded results, in the recorded order
+type replayQuerier struct {
+	queries     []QueryRecord
+	next        int
+	gasUsed     uint64
+	divergences []Divergence
+}
+
+var _ types.Querier = (*replayQuerier)(nil)
+
+func (q *replayQuerier) Query(request types.QueryRequest, gasLimit uint64) ([]byte, error) {
+	replayed, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	if q.next >= len(q.queries) {
+		q.divergences = append(q.divergences, Divergence{What: "query", Detail: fmt.Sprintf(
+			"query %d: nothing recorded, replayed %s", q.next+1, replayed)})
+		q.next++
+		return nil, types.Unknown{}
+	}
+	rec := q.queries[q.next]
+	q.next++
+	recorded, err := json.Marshal(rec.Request)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(recorded, replayed) {
+		q.divergences = append(q.divergences, Divergence{What: "query", Detail: fmt.Sprintf(
+			"query %d: recorded %s, replayed %s", q.next, recorded, replayed)})
+		return nil, types.Unknown{}
+	}
+	q.gasUsed += rec.Gas
+	switch {
+	case rec.Result.Err != nil:
+		return nil, *rec.Result.Err
+	case rec.Result.Ok != nil && rec.Result.Ok.Err != nil:
+		return nil, *rec.Result.Ok.Err
+	case rec.Result.Ok != nil:
+		return rec.Result.Ok.Ok, nil
+	default:
+		return nil, types.Unknown{}
+	}
+}
+
+func (q *replayQuerier) GasConsumed() uint64 {
+	return q.gasUsed
+}
@@ -0,0 +1,155 @@
+package replay
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CosmWasm/go-cosmwasm/types"
+)
+
+func recordedOps() []StoreOp {
+	return []StoreOp{
+		{Op: OpGet, Key: []byte("config"), Value: []byte(`{"owner":"bob"}`), Gas: 1045},
+		{Op: OpGet, Key: []byte("missing"), Gas: 1000},
+		{Op: OpSet, Key: []byte("count"), Value: []byte("1"), Gas: 2180},
+		{Op: OpIterator, Start: []byte("a"), End: []byte("b"), Gas: 0, Items: []StoreItem{
+			{Key: []byte("a1"), Value: []byte("x"), Gas: 39},
+			{Key: []byte("a2"), Value: []byte("y"), Gas: 39},
+		}},
+		{Op: OpDelete, Key: []byte("a1"), Gas: 1000},
+	}
+}
+
+func TestReplayStoreAnswersFromRecording(t *testing.T) {
+	store := newReplayStore(recordedOps())
+
+	assert.Equal(t, []byte(`{"owner":"bob"}`), store.Get([]byte("config")))
+	assert.Nil(t, store.Get([]byte("missing")))
+	store.Set([]byte("count"), []byte("1"))
+	it := store.Iterator([]byte("a"), []byte("b"))
+	var keys []string
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Close()
+	assert.Equal(t, []string{"a1", "a2"}, keys)
+	store.Delete([]byte("a1"))
+
+	assert.Empty(t, store.divergences)
+	assert.False(t, store.diverged)
+	assert.Equal(t, len(store.ops), store.next)
+	assert.Equal(t, uint64(1045+1000+2180+39+39+1000), store.meter.GasConsumed())
+}
+
+func TestReplayStoreReportsDivergence(t *testing.T) {
+	store := newReplayStore(recordedOps())
+
+	assert.Equal(t, []byte(`{"owner":"bob"}`), store.Get([]byte("config")))
+	// a different write than recorded
+	store.Set([]byte("count"), []byte("2"))
+	require.Len(t, store.divergences, 1)
+	assert.Equal(t, "store", store.divergences[0].What)
+	assert.Contains(t, store.divergences[0].Detail, "operation 2")
+	gas := store.meter.GasConsumed()
+	assert.Equal(t, uint64(1045), gas)
+
+	// from now on the store is served from the known state without gas
+	assert.Equal(t, []byte("2"), store.Get([]byte("count")))
+	assert.Equal(t, []byte("x"), store.Get([]byte("a1")))
+	it := store.Iterator([]byte("a"), []byte("b"))
+	var keys []string
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Close()
+	assert.Equal(t, []string{"a1", "a2"}, keys)
+	assert.Equal(t, gas, store.meter.GasConsumed())
+	assert.Len(t, store.divergences, 1)
+}
+
+func TestInitialState(t *testing.T) {
+	ops := []StoreOp{
+		{Op: OpSet, Key: []byte("k"), Value: []byte("new")},
+		// read after the write, so it is not the state before the call
+		{Op: OpGet, Key: []byte("k"), Value: []byte("new")},
+		{Op: OpGet, Key: []byte("other"), Value: []byte("old")},
+		{Op: OpReverseIterator, Items: []StoreItem{{Key: []byte("z"), Value: []byte("")}}},
+	}
+	state := initialState(ops)
+
+	value, err := state.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Nil(t, value)
+	value, err = state.Get([]byte("other"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), value)
+	has, err := state.Has([]byte("z"))
+	require.NoError(t, err)
+	assert.True(t, has)
+}
+
+func TestReplayQuerier(t *testing.T) {
+	balance := types.QueryRequest{Bank: &types.BankQuery{Balance: &types.BalanceQuery{Address: "bob", Denom: "uluna"}}}
+	missing := types.QueryRequest{Wasm: &types.WasmQuery{Raw: &types.RawQuery{ContractAddr: "nobody", Key: []byte("k")}}}
+	querier := &replayQuerier{queries: []QueryRecord{
+		{Request: balance, Result: types.ToQuerierResult([]byte(`{"amount":{"denom":"uluna","amount":"5"}}`), nil), Gas: 100},
+		{Request: missing, Result: types.ToQuerierResult(nil, types.NoSuchContract{Addr: "nobody"}), Gas: 50},
+	}}
+	// the recording survives a round trip through JSON
+	bz, err := json.Marshal(querier.queries)
+	require.NoError(t, err)
+	querier.queries = nil
+	require.NoError(t, json.Unmarshal(bz, &querier.queries))
+
+	res, err := querier.Query(balance, 1000)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"amount":{"denom":"uluna","amount":"5"}}`, string(res))
+	_, err = querier.Query(missing, 1000)
+	assert.Equal(t, types.ToSystemError(types.NoSuchContract{Addr: "nobody"}), types.ToSystemError(err))
+	assert.Equal(t, uint64(150), querier.GasConsumed())
+	assert.Empty(t, querier.divergences)
+
+	// nothing more was recorded
+	_, err = querier.Query(balance, 1000)
+	assert.Equal(t, types.Unknown{}, err)
+	require.Len(t, querier.divergences, 1)
+	assert.Equal(t, "query", querier.divergences[0].What)
+	assert.Equal(t, uint64(150), querier.GasConsumed())
+}
+
+func TestCompare(t *testing.T) {
+	recorded := Call{
+		Response: json.RawMessage(`{"data":null}`),
+		GasUsed:  1234,
+		Store: []StoreOp{
+			{Op: OpSet, Key: []byte("a"), Value: []byte("1")},
+			{Op: OpDelete, Key: []byte("b")},
+		},
+	}
+
+	report := &Report{}
+	compare(report, &recorded, &recorded)
+	assert.True(t, report.OK())
+
+	replayed := Call{
+		Response: json.RawMessage(`{"data":"AA=="}`),
+		GasUsed:  1235,
+		Store: []StoreOp{
+			{Op: OpSet, Key: []byte("a"), Value: []byte("2")},
+			{Op: OpSet, Key: []byte("c"), Value: []byte("3")},
+		},
+	}
+	report = &Report{}
+	compare(report, &recorded, &replayed)
+	var what []string
+	for _, d := range report.Divergences {
+		what = append(what, d.What)
+	}
+	assert.Equal(t, []string{"response", "gas", "writes", "writes", "writes"}, what)
+	assert.Equal(t, "writes: key 61: recorded set 31, replayed set 32", report.Divergences[2].String())
+	assert.Equal(t, "writes: key 62: recorded delete, replayed no write", report.Divergences[3].String())
+	assert.Equal(t, "writes: key 63: recorded no write, replayed set 33", report.Divergences[4].String())
+}
@@ -0,0 +1,133 @@
+package schema
+
+import (
+	"encoding/json"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// maxExampleDepth stops recursive schemas
+const maxExampleDepth = 16
+
+// Examples generates messages that conform to the schema, one per alternative of an enum message
+// (e.g. one per handle message variant). Only required fields are filled in, with placeholder values.
+func (s *Schema) Examples() []json.RawMessage {
+	root, err := s.resolve(s.root)
+	if err != nil {
+		return nil
+	}
+	alts := root.anyOf
+	if len(alts) == 0 {
+		alts = root.oneOf
+	}
+	if len(alts) == 0 {
+		return []json.RawMessage{encode(s.example(root, 0))}
+	}
+	examples := make([]json.RawMessage, len(alts))
+	for i, alt := range alts {
+		examples[i] = encode(s.example(alt, 0))
+	}
+	return examples
+}
+
+func (s *Schema) example(n *node, depth int) interface{} {
+	name := strings.TrimPrefix(n.ref, "#/definitions/")
+	n, err := s.resolve(n)
+	if err != nil || depth > maxExampleDepth {
+		return nil
+	}
+	switch {
+	case n.always != nil:
+		return nil
+	case n.hasConst:
+		return n.constValue
+	case len(n.enum) > 0:
+		return n.enum[0]
+	case len(n.anyOf) > 0:
+		return s.example(n.anyOf[0], depth+1)
+	case len(n.oneOf) > 0:
+		return s.example(n.oneOf[0], depth+1)
+	case len(n.allOf) > 0:
+		// merge the fields of objects, the first example otherwise
+		merged := make(map[string]interface{})
+		for _, sub := range n.allOf {
+			obj, ok := s.example(sub, depth+1).(map[string]interface{})
+			if !ok {
+				return s.example(n.allOf[0], depth+1)
+			}
+			for k, v := range obj {
+				merged[k] = v
+			}
+		}
+		return merged
+	}
+
+	var t string
+	if len(n.types) > 0 {
+		t = n.types[0]
+	} else if n.properties != nil {
+		t = "object"
+	}
+	switch t {
+	case "object":
+		obj := make(map[string]interface{})
+		required := append([]string(nil), n.required...)
+		sort.Strings(required)
+		for _, field := range required {
+			if prop, ok := n.properties[field]; ok {
+				obj[field] = s.example(prop, depth+1)
+			} else {
+				obj[field] = nil
+			}
+		}
+		return obj
+	case "array":
+		arr := []interface{}{}
+		count := 0
+		if n.minItems != nil {
+			count = *n.minItems
+		}
+		for i := 0; i < count; i++ {
+			switch {
+			case i < len(n.tupleItems):
+				arr = append(arr, s.example(n.tupleItems[i], depth+1))
+			case n.items != nil:
+				arr = append(arr, s.example(n.items, depth+1))
+			default:
+				arr = append(arr, nil)
+			}
+		}
+		return arr
+	case "string":
+		if name != "" {
+			// names a type like HumanAddr or Uint128
+			return exampleString(name)
+		}
+		return "string"
+	case "integer", "number":
+		if n.minimum != nil {
+			i, _ := n.minimum.Int(nil)
+			return json.Number(i.String())
+		}
+		if n.exclusiveMin != nil {
+			i, _ := n.exclusiveMin.Int(nil)
+			return json.Number(i.Add(i, big.NewInt(1)).String())
+		}
+		return json.Number("0")
+	case "boolean":
+		return false
+	}
+	return nil
+}
+
+// exampleString gives placeholder values for string types of cosmwasm that have a format
+func exampleString(name string) string {
+	switch name {
+	case "Uint128", "Uint64", "Decimal":
+		return "0"
+	case "Binary":
+		return ""
+	}
+	return name
+}
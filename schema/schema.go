@@ -0,0 +1,604 @@
+// Package schema validates contract messages against the JSON schemas contracts ship for them.
+//
+// It implements the part of JSON Schema draft 7 that schemars, the schema generator of cosmwasm contracts,
+// produces: types, properties, required, additionalProperties, items, enum, const, anyOf, oneOf, allOf, not,
+// local $refs, numeric and length limits, patterns and the integer formats (uint32, int64, ...).
+// Unknown keywords are ignored, like in any JSON Schema validator.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is a parsed JSON schema
+type Schema struct {
+	root *node
+	// definitions are the nodes a $ref can point to, indexed by the JSON pointer of the ref
+	refs map[string]*node
+}
+
+// node is a schema or a sub-schema. A boolean schema is a node that only has always set.
+type node struct {
+	always *bool
+
+	ref                  string
+	types                []string
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+	items                *node
+	tupleItems           []*node
+	minItems, maxItems   *int
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	anyOf, oneOf, allOf  []*node
+	not                  *node
+	minimum, maximum     *big.Float
+	exclusiveMin         *big.Float
+	exclusiveMax         *big.Float
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	format               string
+}
+
+// Parse reads a JSON schema
+func Parse(bz []byte) (*Schema, error) {
+	raw, err := decode(bz)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{refs: make(map[string]*node)}
+	root, err := s.parseNode(raw, "#")
+	if err != nil {
+		return nil, err
+	}
+	s.root = root
+	return s, nil
+}
+
+// decode reads JSON keeping numbers exact
+func decode(bz []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(bz))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+// parseNode parses the schema at pointer and registers it and its definitions for $refs
+func (s *Schema) parseNode(raw interface{}, pointer string) (*node, error) {
+	n := &node{}
+	s.refs[pointer] = n
+	switch v := raw.(type) {
+	case bool:
+		n.always = &v
+		return n, nil
+	case map[string]interface{}:
+		return n, s.parseObject(n, v, pointer)
+	default:
+		return nil, fmt.Errorf("%s: a schema must be an object or a boolean", pointer)
+	}
+}
+
+func (s *Schema) parseObject(n *node, obj map[string]interface{}, pointer string) error {
+	var err error
+	sub := func(key string) (*node, error) {
+		v, ok := obj[key]
+		if !ok {
+			return nil, nil
+		}
+		return s.parseNode(v, pointer+"/"+key)
+	}
+	list := func(key string) ([]*node, error) {
+		v, ok := obj[key]
+		if !ok {
+			return nil, nil
+		}
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: must be an array", pointer, key)
+		}
+		nodes := make([]*node, len(arr))
+		for i, item := range arr {
+			if nodes[i], err = s.parseNode(item, fmt.Sprintf("%s/%s/%d", pointer, key, i)); err != nil {
+				return nil, err
+			}
+		}
+		return nodes, nil
+	}
+
+	for _, key := range []string{"definitions", "$defs"} {
+		if defs, ok := obj[key].(map[string]interface{}); ok {
+			for name, def := range defs {
+				if _, err := s.parseNode(def, pointer+"/"+key+"/"+escapePointer(name)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if ref, ok := obj["$ref"].(string); ok {
+		n.ref = ref
+	}
+	switch t := obj["type"].(type) {
+	case string:
+		n.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%s/type: must be a string or an array of strings", pointer)
+			}
+			n.types = append(n.types, name)
+		}
+	}
+	if props, ok := obj["properties"].(map[string]interface{}); ok {
+		n.properties = make(map[string]*node, len(props))
+		for name, prop := range props {
+			if n.properties[name], err = s.parseNode(prop, pointer+"/properties/"+escapePointer(name)); err != nil {
+				return err
+			}
+		}
+	}
+	if req, ok := obj["required"].([]interface{}); ok {
+		for _, item := range req {
+			if name, ok := item.(string); ok {
+				n.required = append(n.required, name)
+			}
+		}
+	}
+	if n.additionalProperties, err = sub("additionalProperties"); err != nil {
+		return err
+	}
+	if _, isArray := obj["items"].([]interface{}); isArray {
+		if n.tupleItems, err = list("items"); err != nil {
+			return err
+		}
+	} else if n.items, err = sub("items"); err != nil {
+		return err
+	}
+	if n.anyOf, err = list("anyOf"); err != nil {
+		return err
+	}
+	if n.oneOf, err = list("oneOf"); err != nil {
+		return err
+	}
+	if n.allOf, err = list("allOf"); err != nil {
+		return err
+	}
+	if n.not, err = sub("not"); err != nil {
+		return err
+	}
+	if enum, ok := obj["enum"].([]interface{}); ok {
+		n.enum = enum
+	}
+	if c, ok := obj["const"]; ok {
+		n.constValue, n.hasConst = c, true
+	}
+	n.minItems, n.maxItems = intKeyword(obj, "minItems"), intKeyword(obj, "maxItems")
+	n.minLength, n.maxLength = intKeyword(obj, "minLength"), intKeyword(obj, "maxLength")
+	n.minimum, n.maximum = numberKeyword(obj, "minimum"), numberKeyword(obj, "maximum")
+	n.exclusiveMin, n.exclusiveMax = numberKeyword(obj, "exclusiveMinimum"), numberKeyword(obj, "exclusiveMaximum")
+	if pattern, ok := obj["pattern"].(string); ok {
+		if n.pattern, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%s/pattern: %v", pointer, err)
+		}
+	}
+	if format, ok := obj["format"].(string); ok {
+		n.format = format
+	}
+	return nil
+}
+
+func intKeyword(obj map[string]interface{}, key string) *int {
+	num, ok := obj[key].(json.Number)
+	if !ok {
+		return nil
+	}
+	i, err := strconv.Atoi(num.String())
+	if err != nil {
+		return nil
+	}
+	return &i
+}
+
+func numberKeyword(obj map[string]interface{}, key string) *big.Float {
+	num, ok := obj[key].(json.Number)
+	if !ok {
+		return nil
+	}
+	f, ok := new(big.Float).SetString(num.String())
+	if !ok {
+		return nil
+	}
+	return f
+}
+
+// escapePointer escapes a name for use in a JSON pointer
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+func (s *Schema) resolve(n *node) (*node, error) {
+	for seen := 0; n.ref != "" && seen < 64; seen++ {
+		target, ok := s.refs[n.ref]
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", n.ref)
+		}
+		// a node with a $ref ignores its other keywords in draft 7
+		n = target
+	}
+	if n.ref != "" {
+		return nil, errors.New("cyclic $ref")
+	}
+	return n, nil
+}
+
+// ValidationError is a violation of the schema at a place in the message
+type ValidationError struct {
+	// Path is the JSON pointer of the invalid value in the message, "" for the whole message
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors are all violations of the schema found in a message
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid message: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks a JSON message against the schema. It returns ValidationErrors if the message
+// does not conform, or the error of the JSON parser if it is not JSON at all.
+func (s *Schema) Validate(msg []byte) error {
+	value, err := decode(msg)
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	errs := s.validate(s.root, value, "")
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(n *node, value interface{}, path string) ValidationErrors {
+	n, err := s.resolve(n)
+	if err != nil {
+		return ValidationErrors{{path, err.Error()}}
+	}
+	if n.always != nil {
+		if *n.always {
+			return nil
+		}
+		return ValidationErrors{{path, "no value is allowed here"}}
+	}
+
+	if len(n.types) > 0 && !hasType(n.types, value, n.format) {
+		return ValidationErrors{{path, fmt.Sprintf("expected %s, got %s", strings.Join(n.types, " or "), typeName(value))}}
+	}
+	var errs ValidationErrors
+	if n.hasConst && !equal(n.constValue, value) {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected %s", encode(n.constValue))})
+	}
+	if n.enum != nil && !inEnum(n.enum, value) {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected one of %s", encodeList(n.enum))})
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		errs = append(errs, s.validateObject(n, v, path)...)
+	case []interface{}:
+		errs = append(errs, s.validateArray(n, v, path)...)
+	case string:
+		errs = append(errs, validateString(n, v, path)...)
+	case json.Number:
+		errs = append(errs, validateNumber(n, v, path)...)
+	}
+
+	for _, sub := range n.allOf {
+		errs = append(errs, s.validate(sub, value, path)...)
+	}
+	if len(n.anyOf) > 0 {
+		errs = append(errs, s.validateAlternatives(n.anyOf, value, path, false)...)
+	}
+	if len(n.oneOf) > 0 {
+		errs = append(errs, s.validateAlternatives(n.oneOf, value, path, true)...)
+	}
+	if n.not != nil && len(s.validate(n.not, value, path)) == 0 {
+		errs = append(errs, ValidationError{path, "matches a schema it must not match"})
+	}
+	return errs
+}
+
+func (s *Schema) validateObject(n *node, obj map[string]interface{}, path string) ValidationErrors {
+	var errs ValidationErrors
+	for _, name := range n.required {
+		if _, ok := obj[name]; !ok {
+			errs = append(errs, ValidationError{path, fmt.Sprintf("missing required field %q", name)})
+		}
+	}
+	for _, name := range sortedKeys(obj) {
+		childPath := path + "/" + escapePointer(name)
+		if prop, ok := n.properties[name]; ok {
+			errs = append(errs, s.validate(prop, obj[name], childPath)...)
+		} else if n.additionalProperties != nil {
+			add, err := s.resolve(n.additionalProperties)
+			if err == nil && add.always != nil && !*add.always {
+				errs = append(errs, ValidationError{path, fmt.Sprintf("unknown field %q%s", name, n.expectedFields())})
+				continue
+			}
+			errs = append(errs, s.validate(n.additionalProperties, obj[name], childPath)...)
+		}
+	}
+	return errs
+}
+
+// expectedFields lists the known properties for error messages
+func (n *node) expectedFields() string {
+	if len(n.properties) == 0 {
+		return ", expected no fields"
+	}
+	names := make([]string, 0, len(n.properties))
+	for name := range n.properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return ", expected " + strings.Join(names, ", ")
+}
+
+func (s *Schema) validateArray(n *node, arr []interface{}, path string) ValidationErrors {
+	var errs ValidationErrors
+	if n.minItems != nil && len(arr) < *n.minItems {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected at least %d items, got %d", *n.minItems, len(arr))})
+	}
+	if n.maxItems != nil && len(arr) > *n.maxItems {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected at most %d items, got %d", *n.maxItems, len(arr))})
+	}
+	for i, item := range arr {
+		itemPath := path + "/" + strconv.Itoa(i)
+		switch {
+		case n.tupleItems != nil && i < len(n.tupleItems):
+			errs = append(errs, s.validate(n.tupleItems[i], item, itemPath)...)
+		case n.items != nil:
+			errs = append(errs, s.validate(n.items, item, itemPath)...)
+		}
+	}
+	return errs
+}
+
+func validateString(n *node, str string, path string) ValidationErrors {
+	var errs ValidationErrors
+	length := len([]rune(str))
+	if n.minLength != nil && length < *n.minLength {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected at least %d characters", *n.minLength)})
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected at most %d characters", *n.maxLength)})
+	}
+	if n.pattern != nil && !n.pattern.MatchString(str) {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("does not match the pattern %s", n.pattern)})
+	}
+	return errs
+}
+
+// integer formats of schemars with their ranges
+var integerFormats = map[string][2]string{
+	"uint8":  {"0", "255"},
+	"uint16": {"0", "65535"},
+	"uint32": {"0", "4294967295"},
+	"uint64": {"0", "18446744073709551615"},
+	"uint":   {"0", "18446744073709551615"},
+	"int8":   {"-128", "127"},
+	"int16":  {"-32768", "32767"},
+	"int32":  {"-2147483648", "2147483647"},
+	"int64":  {"-9223372036854775808", "9223372036854775807"},
+	"int":    {"-9223372036854775808", "9223372036854775807"},
+}
+
+func validateNumber(n *node, num json.Number, path string) ValidationErrors {
+	f, ok := new(big.Float).SetString(num.String())
+	if !ok {
+		return ValidationErrors{{path, fmt.Sprintf("invalid number %s", num)}}
+	}
+	var errs ValidationErrors
+	if n.minimum != nil && f.Cmp(n.minimum) < 0 {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("must be at least %s", n.minimum.Text('g', -1))})
+	}
+	if n.maximum != nil && f.Cmp(n.maximum) > 0 {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("must be at most %s", n.maximum.Text('g', -1))})
+	}
+	if n.exclusiveMin != nil && f.Cmp(n.exclusiveMin) <= 0 {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("must be greater than %s", n.exclusiveMin.Text('g', -1))})
+	}
+	if n.exclusiveMax != nil && f.Cmp(n.exclusiveMax) >= 0 {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("must be less than %s", n.exclusiveMax.Text('g', -1))})
+	}
+	if limits, ok := integerFormats[n.format]; ok {
+		i, isInt := new(big.Int).SetString(num.String(), 10)
+		min, _ := new(big.Int).SetString(limits[0], 10)
+		max, _ := new(big.Int).SetString(limits[1], 10)
+		if !isInt {
+			errs = append(errs, ValidationError{path, fmt.Sprintf("expected an integer (%s), got %s", n.format, num)})
+		} else if i.Cmp(min) < 0 || i.Cmp(max) > 0 {
+			errs = append(errs, ValidationError{path, fmt.Sprintf("%s is out of range for %s", num, n.format)})
+		}
+	}
+	return errs
+}
+
+// validateAlternatives checks anyOf and oneOf. If no alternative matches, it reports the errors of the
+// alternative the value was most likely meant for, e.g. the variant of an enum message named by its key.
+func (s *Schema) validateAlternatives(alts []*node, value interface{}, path string, exactlyOne bool) ValidationErrors {
+	var matching int
+	results := make([]ValidationErrors, len(alts))
+	for i, alt := range alts {
+		results[i] = s.validate(alt, value, path)
+		if len(results[i]) == 0 {
+			matching++
+		}
+	}
+	if matching == 1 || (matching > 1 && !exactlyOne) {
+		return nil
+	}
+	if matching > 1 {
+		return ValidationErrors{{path, fmt.Sprintf("matches %d alternatives, expected exactly one", matching)}}
+	}
+
+	if obj, ok := value.(map[string]interface{}); ok {
+		var variants []string
+		for i, alt := range alts {
+			alt, err := s.resolve(alt)
+			if err != nil || len(alt.required) == 0 {
+				continue
+			}
+			variants = append(variants, strings.Join(alt.required, "+"))
+			if hasAll(obj, alt.required) {
+				// the message names this variant, so its errors are the interesting ones
+				return results[i]
+			}
+		}
+		if len(variants) == len(alts) {
+			return ValidationErrors{{path, fmt.Sprintf("unknown variant %s, expected one of %s",
+				describeKeys(obj), strings.Join(variants, ", "))}}
+		}
+	}
+	best := results[0]
+	for _, res := range results[1:] {
+		if len(res) < len(best) {
+			best = res
+		}
+	}
+	if len(alts) == 1 {
+		return best
+	}
+	return ValidationErrors{{path, fmt.Sprintf("does not match any of the %d alternatives, closest: %s", len(alts), best.Error())}}
+}
+
+func hasAll(obj map[string]interface{}, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := obj[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func describeKeys(obj map[string]interface{}) string {
+	keys := sortedKeys(obj)
+	if len(keys) == 0 {
+		return "{}"
+	}
+	return strings.Join(keys, "+")
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hasType(types []string, value interface{}, format string) bool {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if num, ok := value.(json.Number); ok {
+				if _, ok := new(big.Int).SetString(num.String(), 10); ok {
+					return true
+				}
+			}
+		case "number":
+			if _, ok := value.(json.Number); ok {
+				return true
+			}
+		default:
+			if typeName(value) == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if equal(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares decoded JSON values, numbers by value
+func equal(a, b interface{}) bool {
+	if na, ok := a.(json.Number); ok {
+		nb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, ok1 := new(big.Float).SetString(na.String())
+		fb, ok2 := new(big.Float).SetString(nb.String())
+		return ok1 && ok2 && fa.Cmp(fb) == 0
+	}
+	return bytes.Equal(encode(a), encode(b))
+}
+
+func encode(v interface{}) []byte {
+	bz, _ := json.Marshal(v)
+	return bz
+}
+
+func encodeList(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = string(encode(v))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,216 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadHackatom(t *testing.T) *Set {
+	set, err := LoadDir("testdata/hackatom")
+	require.NoError(t, err)
+	return set
+}
+
+func requireInvalid(t *testing.T, err error) ValidationErrors {
+	require.Error(t, err)
+	errs, ok := err.(ValidationErrors)
+	require.True(t, ok, "expected ValidationErrors, got %T: %v", err, err)
+	return errs
+}
+
+func TestLoadDir(t *testing.T) {
+	set := loadHackatom(t)
+	assert.NotNil(t, set.Schema(KindInit))
+	assert.NotNil(t, set.Schema(KindHandle))
+	assert.NotNil(t, set.Schema(KindQuery))
+	// no schema, so anything goes
+	assert.Nil(t, set.Schema(KindMigrate))
+	assert.NoError(t, set.ValidateMigrate([]byte(`{"anything":1}`)))
+
+	_, err := LoadDir("testdata/missing")
+	assert.Error(t, err)
+	_, err = LoadDir("testdata")
+	assert.Error(t, err)
+}
+
+func TestValidateValid(t *testing.T) {
+	set := loadHackatom(t)
+	assert.NoError(t, set.ValidateInit([]byte(`{"verifier":"fred","beneficiary":"bob"}`)))
+	assert.NoError(t, set.ValidateHandle([]byte(`{"release":{}}`)))
+	assert.NoError(t, set.ValidateHandle([]byte(`{"transfer":{"recipient":"bob","amount":[{"denom":"uatom","amount":"5"}],"memo":null}}`)))
+	assert.NoError(t, set.ValidateQuery([]byte(`{"recurse":{"depth":3,"work":4294967295}}`)))
+}
+
+func TestValidatePaths(t *testing.T) {
+	set := loadHackatom(t)
+
+	specs := map[string]struct {
+		kind string
+		msg  string
+		exp  []string
+	}{
+		"missing field": {
+			KindInit, `{"verifier":"fred"}`,
+			[]string{`missing required field "beneficiary"`},
+		},
+		"wrong type": {
+			KindInit, `{"verifier":"fred","beneficiary":17}`,
+			[]string{"/beneficiary: expected string, got number"},
+		},
+		"nested in enum variant": {
+			KindHandle, `{"transfer":{"recipient":"bob","amount":[{"denom":"uatom","amount":5}]}}`,
+			[]string{"/transfer/amount/0/amount: expected string, got number"},
+		},
+		"nullable": {
+			KindHandle, `{"transfer":{"recipient":"bob","amount":[],"memo":false}}`,
+			[]string{"/transfer/memo: expected string or null, got boolean"},
+		},
+		"unknown variant": {
+			KindQuery, `{"balance":{}}`,
+			[]string{"unknown variant balance, expected one of verifier, other_balance, recurse"},
+		},
+		"negative integer": {
+			KindQuery, `{"recurse":{"depth":-1,"work":1}}`,
+			[]string{"/recurse/depth: must be at least 0", "/recurse/depth: -1 is out of range for uint32"},
+		},
+		"integer format": {
+			KindQuery, `{"recurse":{"depth":4294967296,"work":1.5}}`,
+			[]string{"/recurse/depth: 4294967296 is out of range for uint32", "/recurse/work: expected integer, got number"},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			errs := requireInvalid(t, set.Validate(spec.kind, []byte(spec.msg)))
+			var msgs []string
+			for _, e := range errs {
+				msgs = append(msgs, e.Error())
+			}
+			assert.Equal(t, spec.exp, msgs)
+		})
+	}
+}
+
+func TestValidateNotJSON(t *testing.T) {
+	set := loadHackatom(t)
+	err := set.ValidateHandle([]byte(`{"release":`))
+	require.Error(t, err)
+	_, ok := err.(ValidationErrors)
+	assert.False(t, ok)
+	assert.Contains(t, err.Error(), "invalid JSON")
+}
+
+func TestValidateKeywords(t *testing.T) {
+	s, err := Parse([]byte(`{
+		"type": "object",
+		"additionalProperties": false,
+		"properties": {
+			"kind": {"enum": ["a", "b"]},
+			"version": {"const": 1},
+			"name": {"type": "string", "minLength": 2, "pattern": "^[a-z]+$"},
+			"pair": {"type": "array", "items": [{"type": "string"}, {"type": "integer"}], "maxItems": 2},
+			"any": true,
+			"never": false,
+			"either": {"oneOf": [{"type": "integer"}, {"type": "number", "maximum": 10}]}
+		}
+	}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Validate([]byte(`{"kind":"a","version":1.0,"name":"ab","pair":["x",1],"any":[{}],"either":11}`)))
+
+	errs := requireInvalid(t, s.Validate([]byte(`{"kind":"c","version":2,"name":"A","pair":["x","y",3],"never":1,"extra":1,"either":5}`)))
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	assert.Equal(t, []string{
+		"/either: matches 2 alternatives, expected exactly one",
+		`unknown field "extra", expected any, either, kind, name, never, pair, version`,
+		`/kind: expected one of "a", "b"`,
+		"/name: expected at least 2 characters",
+		"/name: does not match the pattern ^[a-z]+$",
+		"/never: no value is allowed here",
+		"/pair: expected at most 2 items, got 3",
+		"/pair/1: expected integer, got string",
+		"/version: expected 1",
+	}, msgs)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte(`[]`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"properties": {"a": 1}}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"pattern": "("}`))
+	assert.Error(t, err)
+
+	s, err := Parse([]byte(`{"$ref": "#/definitions/Missing"}`))
+	require.NoError(t, err)
+	errs := requireInvalid(t, s.Validate([]byte(`{}`)))
+	assert.Contains(t, errs[0].Message, "unresolvable $ref")
+}
+
+func TestRecursiveSchema(t *testing.T) {
+	s, err := Parse([]byte(`{
+		"$ref": "#/definitions/Tree",
+		"definitions": {
+			"Tree": {
+				"type": "object",
+				"required": ["value"],
+				"properties": {
+					"value": {"type": "integer"},
+					"children": {"type": "array", "items": {"$ref": "#/definitions/Tree"}}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+	assert.NoError(t, s.Validate([]byte(`{"value":1,"children":[{"value":2,"children":[{"value":3}]}]}`)))
+	errs := requireInvalid(t, s.Validate([]byte(`{"value":1,"children":[{"value":2,"children":[{"value":"3"}]}]}`)))
+	assert.Equal(t, "/children/0/children/0/value", errs[0].Path)
+
+	examples := s.Examples()
+	require.Len(t, examples, 1)
+	assert.JSONEq(t, `{"value":0}`, string(examples[0]))
+}
+
+func TestExamples(t *testing.T) {
+	set := loadHackatom(t)
+
+	examples := set.Schema(KindInit).Examples()
+	require.Len(t, examples, 1)
+	assert.JSONEq(t, `{"beneficiary":"HumanAddr","verifier":"HumanAddr"}`, string(examples[0]))
+
+	examples = set.Schema(KindQuery).Examples()
+	var got []string
+	for _, example := range examples {
+		got = append(got, string(example))
+		// every example passes validation
+		assert.NoError(t, set.ValidateQuery(example))
+	}
+	assert.Equal(t, []string{
+		`{"verifier":{}}`,
+		`{"other_balance":{"address":"HumanAddr"}}`,
+		`{"recurse":{"depth":0,"work":0}}`,
+	}, got)
+
+	for _, example := range set.Schema(KindHandle).Examples() {
+		assert.NoError(t, set.ValidateHandle(example))
+		var msg map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(example, &msg))
+		assert.Len(t, msg, 1)
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	kind, err := ParseKind("execute")
+	require.NoError(t, err)
+	assert.Equal(t, KindHandle, kind)
+	kind, err = ParseKind("Instantiate")
+	require.NoError(t, err)
+	assert.Equal(t, KindInit, kind)
+	_, err = ParseKind("sudo")
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Message kinds a contract has schemas for
+const (
+	KindInit    = "init"
+	KindHandle  = "handle"
+	KindQuery   = "query"
+	KindMigrate = "migrate"
+)
+
+// fileNames are the schema files of each kind written by cosmwasm-schema, the first one of
+// the contract API this package was written for and the others of later versions
+var fileNames = map[string][]string{
+	KindInit:    {"init_msg.json", "instantiate_msg.json"},
+	KindHandle:  {"handle_msg.json", "execute_msg.json"},
+	KindQuery:   {"query_msg.json"},
+	KindMigrate: {"migrate_msg.json"},
+}
+
+// Set are the message schemas of a contract. A kind without a schema accepts every message.
+type Set struct {
+	schemas map[string]*Schema
+}
+
+// LoadDir reads the message schemas in the schema directory of a contract
+func LoadDir(dir string) (*Set, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	set := &Set{schemas: make(map[string]*Schema)}
+	for kind, names := range fileNames {
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			bz, err := ioutil.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			s, err := Parse(bz)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			set.schemas[kind] = s
+			break
+		}
+	}
+	if len(set.schemas) == 0 {
+		return nil, fmt.Errorf("no message schemas in %s", dir)
+	}
+	return set, nil
+}
+
+// ParseKind accepts the kinds and the names later contract APIs use for them (instantiate, execute)
+func ParseKind(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case KindInit, "instantiate":
+		return KindInit, nil
+	case KindHandle, "execute":
+		return KindHandle, nil
+	case KindQuery:
+		return KindQuery, nil
+	case KindMigrate:
+		return KindMigrate, nil
+	}
+	return "", fmt.Errorf("unknown message kind %q, expected init, handle, query or migrate", name)
+}
+
+// Schema returns the schema of a kind, nil if the contract has none
+func (s *Set) Schema(kind string) *Schema {
+	return s.schemas[kind]
+}
+
+// Validate checks a message of the given kind, see Schema.Validate
+func (s *Set) Validate(kind string, msg []byte) error {
+	schema := s.schemas[kind]
+	if schema == nil {
+		return nil
+	}
+	return schema.Validate(msg)
+}
+
+// ValidateInit checks an init message
+func (s *Set) ValidateInit(msg []byte) error {
+	return s.Validate(KindInit, msg)
+}
+
+// ValidateHandle checks a handle message
+func (s *Set) ValidateHandle(msg []byte) error {
+	return s.Validate(KindHandle, msg)
+}
+
+// ValidateQuery checks a query message
+func (s *Set) ValidateQuery(msg []byte) error {
+	return s.Validate(KindQuery, msg)
+}
+
+// ValidateMigrate checks a migrate message
+func (s *Set) ValidateMigrate(msg []byte) error {
+	return s.Validate(KindMigrate, msg)
+}
@@ -2,7 +2,7 @@ use cosmwasm_vm::{FfiResult, GasInfo, Storage, StorageIterator};
 
 use crate::error::GoResult;
 use crate::gas_meter::gas_meter_t;
-use crate::iterator::GoIter;
+use crate::iterator::{GoIter, PrefetchIter};
 use crate::memory::Buffer;
 
 // this represents something passed in from the caller side of FFI
@@ -27,8 +27,8 @@ pub struct DB_vtable {
         extern "C" fn(*mut db_t, *mut gas_meter_t, *mut u64, Buffer, Buffer, *mut Buffer) -> i32,
     pub remove_db: extern "C" fn(*mut db_t, *mut gas_meter_t, *mut u64, Buffer, *mut Buffer) -> i32,
     // order -> Ascending = 1, Descending = 2
-    // Note: we cannot set gas_meter on the returned GoIter due to cgo memory safety.
-    // Since we have the pointer in rust already, we must set that manually
+    // Note: we cannot set gas_meter and db on the returned GoIter due to cgo memory safety.
+    // Since we have the pointers in rust already, we must set them manually
     pub scan_db: extern "C" fn(
         *mut db_t,
         *mut gas_meter_t,
@@ -108,7 +108,7 @@ impl Storage for DB {
             .map(|e| Buffer::from_vec(e.to_vec()))
             .unwrap_or_default();
         let mut err = Buffer::default();
-        let mut iter = GoIter::new(self.gas_meter);
+        let mut iter = GoIter::new(self.gas_meter, self.state);
         let mut used_gas = 0_u64;
         let go_result: GoResult = (self.vtable.scan_db)(
             self.state,
@@ -138,7 +138,7 @@ impl Storage for DB {
                 return (Err(err), gas_info);
             }
         }
-        (Ok(Box::new(iter)), gas_info)
+        (Ok(Box::new(PrefetchIter::new(iter))), gas_info)
     }
 
     fn set(&mut self, key: &[u8], value: &[u8]) -> FfiResult<()> {
@@ -1,4 +1,5 @@
 use cosmwasm_vm::FfiError;
+use std::cell::RefCell;
 use std::fmt;
 
 use crate::Buffer;
@@ -27,6 +28,20 @@ pub enum GoResult {
     Other = 4,
     /// An error happened during normal operation of a Go callback, which should be fed back to the contract
     User = 5,
+    /// The contract tried to write to a read-only store (e.g. during a query), which aborts the contract
+    ReadOnly = 6,
+}
+
+thread_local! {
+    /// Details about the last callback that ran out of gas on this thread (as JSON from Go).
+    /// Go calls into Rust and Rust calls back into Go on the same thread, so this cannot mix up contracts
+    /// running in parallel.
+    static OUT_OF_GAS_DETAILS: RefCell<Option<String>> = RefCell::new(None);
+}
+
+/// Returns and clears the out of gas details stored by `GoResult::into_ffi_result`
+pub fn take_out_of_gas_details() -> Option<String> {
+    OUT_OF_GAS_DETAILS.with(|d| d.borrow_mut().take())
 }
 
 impl From<i32> for GoResult {
@@ -39,6 +54,7 @@ impl From<i32> for GoResult {
             2 => BadArgument,
             3 => OutOfGas,
             5 => User,
+            6 => ReadOnly,
             _ => Other,
         }
     }
@@ -53,6 +69,7 @@ impl fmt::Display for GoResult {
             GoResult::OutOfGas => write!(f, "OutOfGas"),
             GoResult::Other => write!(f, "Other Error"),
             GoResult::User => write!(f, "User Error"),
+            GoResult::ReadOnly => write!(f, "Write to read-only store"),
         }
     }
 }
@@ -82,9 +99,18 @@ impl GoResult {
             GoResult::Ok => Ok(()),
             GoResult::Panic => Err(FfiError::foreign_panic()),
             GoResult::BadArgument => Err(FfiError::bad_argument()),
-            GoResult::OutOfGas => Err(FfiError::out_of_gas()),
+            GoResult::OutOfGas => {
+                // FfiError::OutOfGas cannot carry a message, so we keep the details Go sent
+                // until the VM returned and the error of the contract call is set
+                if !error_msg.ptr.is_null() {
+                    let details: String = String::from_utf8_lossy(&error_msg.consume()).into();
+                    OUT_OF_GAS_DETAILS.with(|d| *d.borrow_mut() = Some(details));
+                }
+                Err(FfiError::out_of_gas())
+            }
             GoResult::Other => Err(FfiError::unknown(read_error_msg())),
             GoResult::User => Err(FfiError::user_err(read_error_msg())),
+            GoResult::ReadOnly => Err(FfiError::unknown(read_error_msg())),
         }
     }
 }
@@ -1,5 +1,5 @@
 mod go;
 mod rust;
 
-pub use go::GoResult;
+pub use go::{take_out_of_gas_details, GoResult};
 pub use rust::{clear_error, handle_c_error, set_error, Error};
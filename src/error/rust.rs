@@ -3,6 +3,7 @@ use errno::{set_errno, Errno};
 use cosmwasm_vm::VmError;
 use snafu::Snafu;
 
+use super::go::take_out_of_gas_details;
 use crate::memory::Buffer;
 
 #[derive(Debug, Snafu)]
@@ -21,6 +22,8 @@ pub enum Error {
     },
     #[snafu(display("Ran out of gas"))]
     OutOfGas {
+        /// Set if the gas ran out in a Go callback. This is sent back to Go instead of the display message.
+        details: Option<String>,
         #[cfg(feature = "backtraces")]
         backtrace: snafu::Backtrace,
     },
@@ -60,15 +63,15 @@ impl Error {
         .build()
     }
 
-    pub fn out_of_gas() -> Self {
-        OutOfGas {}.build()
+    pub fn out_of_gas(details: Option<String>) -> Self {
+        OutOfGas { details }.build()
     }
 }
 
 impl From<VmError> for Error {
     fn from(source: VmError) -> Self {
         match source {
-            VmError::GasDepletion => Error::out_of_gas(),
+            VmError::GasDepletion => Error::out_of_gas(take_out_of_gas_details()),
             _ => Error::vm_err(source),
         }
     }
@@ -95,11 +98,22 @@ enum ErrnoValue {
 }
 
 pub fn clear_error() {
+    // don't let details of a callback leak into a later call
+    take_out_of_gas_details();
     set_errno(Errno(ErrnoValue::Success as i32));
 }
 
 pub fn set_error(err: Error, errout: Option<&mut Buffer>) {
-    let msg = err.to_string();
+    let msg = match &err {
+        Error::OutOfGas {
+            details: Some(details),
+            ..
+        } => details.clone(),
+        _ => {
+            take_out_of_gas_details();
+            err.to_string()
+        }
+    };
     if let Some(mb) = errout {
         *mb = Buffer::from_vec(msg.into_bytes());
     }
@@ -177,6 +191,33 @@ mod tests {
         }
     }
 
+    #[test]
+    fn out_of_gas_works() {
+        let error = Error::out_of_gas(Some("details".to_string()));
+        match error {
+            Error::OutOfGas { details, .. } => {
+                assert_eq!(details, Some("details".to_string()));
+            }
+            _ => panic!("expect different error"),
+        }
+    }
+
+    #[test]
+    fn set_error_sends_out_of_gas_details() {
+        let mut errout = Buffer::default();
+        set_error(
+            Error::out_of_gas(Some(r#"{"call_site":"db_write"}"#.to_string())),
+            Some(&mut errout),
+        );
+        let msg = unsafe { errout.consume() };
+        assert_eq!(msg, br#"{"call_site":"db_write"}"#.to_vec());
+
+        let mut errout = Buffer::default();
+        set_error(Error::out_of_gas(None), Some(&mut errout));
+        let msg = unsafe { errout.consume() };
+        assert_eq!(msg, b"Ran out of gas".to_vec());
+    }
+
     #[test]
     fn vm_err_works_for_strings() {
         let error = Error::vm_err("my text");
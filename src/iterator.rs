@@ -1,15 +1,18 @@
+use std::collections::VecDeque;
+use std::convert::TryInto;
+
 use cosmwasm_std::KV;
 use cosmwasm_vm::{FfiError, FfiResult, GasInfo, StorageIterator};
 
+use crate::db::db_t;
 use crate::error::GoResult;
 use crate::gas_meter::gas_meter_t;
 use crate::memory::Buffer;
 
-// Iterator maintains integer references to some tables on the Go side
+// Iterator maintains an integer reference to the list of iterators owned by the db state on the Go side
 #[repr(C)]
 #[derive(Default, Copy, Clone)]
 pub struct iterator_t {
-    pub db_counter: u64,
     pub iterator_index: u64,
 }
 
@@ -20,6 +23,7 @@ pub struct iterator_t {
 pub struct Iterator_vtable {
     pub next_db: Option<
         extern "C" fn(
+            *mut db_t,
             iterator_t,
             *mut gas_meter_t,
             *mut u64,
@@ -28,21 +32,39 @@ pub struct Iterator_vtable {
             *mut Buffer,
         ) -> i32,
     >,
+    // reads up to the given number of items into one buffer (see decode_batch), optional
+    pub next_batch_db: Option<NextBatchFn>,
 }
 
+type NextBatchFn = extern "C" fn(
+    *mut db_t,
+    iterator_t,
+    *mut gas_meter_t,
+    *mut u64,
+    u64,
+    *mut Buffer,
+    *mut Buffer,
+) -> i32;
+
 #[repr(C)]
 pub struct GoIter {
     pub gas_meter: *mut gas_meter_t,
+    // the db state owning this iterator, set on the Rust side like gas_meter
+    pub db: *mut db_t,
     pub state: iterator_t,
     pub vtable: Iterator_vtable,
+    // the number of items to read with next_batch_db at once, set on the Go side with the vtable
+    pub batch_size: u64,
 }
 
 impl GoIter {
-    pub fn new(gas_meter: *mut gas_meter_t) -> Self {
+    pub fn new(gas_meter: *mut gas_meter_t, db: *mut db_t) -> Self {
         GoIter {
             gas_meter,
+            db,
             state: iterator_t::default(),
             vtable: Iterator_vtable::default(),
+            batch_size: 0,
         }
     }
 }
@@ -62,6 +84,7 @@ impl StorageIterator for GoIter {
         let mut err = Buffer::default();
         let mut used_gas = 0_u64;
         let go_result: GoResult = (next_db)(
+            self.db,
             self.state,
             self.gas_meter,
             &mut used_gas as *mut u64,
@@ -96,3 +119,163 @@ impl StorageIterator for GoIter {
         (result, gas_info)
     }
 }
+
+/// PrefetchIter reads the items of a GoIter in batches of its batch_size, which saves
+/// a cgo round-trip and two allocations per item. If Go does not provide `next_batch_db`
+/// or the batch size is 0, it reads every item with `next_db`.
+///
+/// Go reports the gas of every item in the batch, and each item is charged when it is handed
+/// out to the contract, so the gas charged for an item is the same as with `next_db`.
+pub struct PrefetchIter {
+    iter: GoIter,
+    prefetched: VecDeque<(u64, KV)>,
+    // gas Go used for a batch beyond its items, charged with the next item handed out
+    pending_gas: u64,
+    exhausted: bool,
+}
+
+impl PrefetchIter {
+    pub fn new(iter: GoIter) -> Self {
+        PrefetchIter {
+            iter,
+            prefetched: VecDeque::new(),
+            pending_gas: 0,
+            exhausted: false,
+        }
+    }
+
+    fn fetch_batch(&mut self, next_batch_db: NextBatchFn, batch_size: u64) -> FfiResult<()> {
+        let mut batch_buf = Buffer::default();
+        let mut err = Buffer::default();
+        let mut used_gas = 0_u64;
+        let go_result: GoResult = (next_batch_db)(
+            self.iter.db,
+            self.iter.state,
+            self.iter.gas_meter,
+            &mut used_gas as *mut u64,
+            batch_size,
+            &mut batch_buf as *mut Buffer,
+            &mut err as *mut Buffer,
+        )
+        .into();
+
+        // on errors, used_gas is the gas of everything Go read, as the items are dropped
+        let default = || "Failed to fetch next items from iterator".to_string();
+        unsafe {
+            if let Err(err) = go_result.into_ffi_result(err, default) {
+                return (Err(err), GasInfo::with_externally_used(used_gas));
+            }
+        }
+
+        let items = if batch_buf.ptr.is_null() {
+            Vec::new()
+        } else {
+            let data = unsafe { batch_buf.consume() };
+            match decode_batch(&data) {
+                Ok(items) => items,
+                Err(err) => return (Err(err), GasInfo::with_externally_used(used_gas)),
+            }
+        };
+        if (items.len() as u64) < batch_size {
+            self.exhausted = true;
+        }
+        self.prefetched.extend(items);
+        self.pending_gas += used_gas;
+        (Ok(()), GasInfo::free())
+    }
+}
+
+impl StorageIterator for PrefetchIter {
+    fn next(&mut self) -> FfiResult<Option<KV>> {
+        let next_batch_db = match self.iter.vtable.next_batch_db {
+            Some(f) if self.iter.batch_size > 0 => f,
+            _ => return self.iter.next(),
+        };
+        if self.prefetched.is_empty() && !self.exhausted {
+            let (result, gas_info) = self.fetch_batch(next_batch_db, self.iter.batch_size);
+            if let Err(err) = result {
+                return (Err(err), gas_info);
+            }
+        }
+        let pending_gas = std::mem::take(&mut self.pending_gas);
+        match self.prefetched.pop_front() {
+            Some((gas, item)) => (
+                Ok(Some(item)),
+                GasInfo::with_externally_used(gas + pending_gas),
+            ),
+            None => (Ok(None), GasInfo::with_externally_used(pending_gas)),
+        }
+    }
+}
+
+/// Decodes the items of a batch with their gas, which are encoded as
+/// gas (8 bytes, big endian) | key length (4 bytes, big endian) | key | value length (4 bytes, big endian) | value
+fn decode_batch(mut data: &[u8]) -> Result<Vec<(u64, KV)>, FfiError> {
+    let mut items = Vec::new();
+    while !data.is_empty() {
+        let gas = split_gas(&mut data)?;
+        let key = split_chunk(&mut data)?;
+        let value = split_chunk(&mut data)?;
+        items.push((gas, (key, value)));
+    }
+    Ok(items)
+}
+
+/// Splits off the gas of an item from the start of data
+fn split_gas<'a>(data: &mut &'a [u8]) -> Result<u64, FfiError> {
+    let invalid = || FfiError::unknown("Invalid iterator batch received from Go");
+    let current: &'a [u8] = *data;
+    if current.len() < 8 {
+        return Err(invalid());
+    }
+    let (gas, rest) = current.split_at(8);
+    let gas = u64::from_be_bytes(gas.try_into().map_err(|_| invalid())?);
+    *data = rest;
+    Ok(gas)
+}
+
+/// Splits off one length prefixed chunk from the start of data
+fn split_chunk<'a>(data: &mut &'a [u8]) -> Result<Vec<u8>, FfiError> {
+    let invalid = || FfiError::unknown("Invalid iterator batch received from Go");
+    let current: &'a [u8] = *data;
+    if current.len() < 4 {
+        return Err(invalid());
+    }
+    let (length, rest) = current.split_at(4);
+    let length = u32::from_be_bytes(length.try_into().map_err(|_| invalid())?) as usize;
+    if rest.len() < length {
+        return Err(invalid());
+    }
+    let (chunk, rest) = rest.split_at(length);
+    *data = rest;
+    Ok(chunk.to_vec())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn decode_batch_works() {
+        assert_eq!(decode_batch(b"").unwrap(), Vec::<(u64, KV)>::new());
+
+        let data = b"\x00\x00\x00\x00\x00\x00\x00\x07\x00\x00\x00\x03foo\x00\x00\x00\x03bar\
+            \x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x01a\x00\x00\x00\x00";
+        let items = decode_batch(data).unwrap();
+        assert_eq!(
+            items,
+            vec![
+                (7, (b"foo".to_vec(), b"bar".to_vec())),
+                (256, (b"a".to_vec(), b"".to_vec()))
+            ]
+        );
+    }
+
+    #[test]
+    fn decode_batch_fails_for_truncated_data() {
+        decode_batch(b"\x00\x00\x00\x00").unwrap_err();
+        decode_batch(b"\x00\x00\x00\x00\x00\x00\x00\x07\x00\x00\x00\x03fo").unwrap_err();
+        decode_batch(b"\x00\x00\x00\x00\x00\x00\x00\x07\x00\x00\x00\x03foo").unwrap_err();
+        decode_batch(b"\x00\x00\x00\x00\x00\x00\x00\x07\x00\x00\x00\x03foo\x00\x00").unwrap_err();
+    }
+}
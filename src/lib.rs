@@ -66,6 +66,9 @@ pub extern "C" fn init_cache(
     }
 }
 
+// Note: all Buffer arguments of the exported functions may be views of Go memory (see makeView in memory.go).
+// They must only be read during the call, never kept or freed.
+
 // store some common string for argument names
 static DATA_DIR_ARG: &str = "data_dir";
 static FEATURES_ARG: &str = "supported_features";
@@ -3,11 +3,13 @@
 use serde::{Deserialize, Serialize};
 use tempfile::TempDir;
 
-use cosmwasm_std::{coins, HumanAddr};
+use cosmwasm_std::{coins, Env, HumanAddr};
 use cosmwasm_vm::testing::{mock_dependencies, mock_env, mock_instance_with_gas_limit};
 use cosmwasm_vm::{call_handle_raw, call_init_raw, features_from_csv, to_vec, CosmCache};
 
 static CONTRACT: &[u8] = include_bytes!("../api/testdata/hackatom.wasm");
+// produced by types.CanonicalJSONMarshal on the Go side
+static CANONICAL_ENV: &[u8] = include_bytes!("../types/testdata/canonical_env.json");
 
 #[derive(Serialize, Deserialize, Clone, Debug, PartialEq)]
 pub struct InitMsg {
@@ -86,3 +88,16 @@ fn handle_cpu_loop_no_cache() {
     assert!(res.is_err());
     assert_eq!(instance.get_gas_left(), 0);
 }
+
+#[test]
+fn canonical_json_matches_serde_json() {
+    // serde_json writes a Value with sorted keys, this must reproduce the Go encoding byte by byte
+    let value: serde_json::Value = serde_json::from_slice(CANONICAL_ENV).unwrap();
+    assert_eq!(serde_json::to_vec(&value).unwrap(), CANONICAL_ENV);
+
+    // and it must be a valid Env for the contract
+    let env: Env = serde_json::from_slice(CANONICAL_ENV).unwrap();
+    assert_eq!(env.block.height, 12345);
+    assert_eq!(env.block.chain_id, "test<net>&co\u{2028}");
+    assert_eq!(env.message.sent_funds.len(), 2);
+}
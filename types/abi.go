@@ -0,0 +1,166 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//---------- Interface Versions ---------
+
+// InterfaceVersion is the version of the contract <-> VM interface a contract
+// was compiled against, as marked by its `cosmwasm_vm_version_*` (or later `interface_version_*`) export.
+// It determines the JSON shape of the results returned by the contract.
+type InterfaceVersion int
+
+const (
+	// InterfaceVersionUnknown means the contract has no version marker
+	InterfaceVersionUnknown InterfaceVersion = 0
+	// InterfaceVersion3 is cosmwasm 0.10 and below: {"Ok":...} / {"Err":StdError} results
+	InterfaceVersion3 InterfaceVersion = 3
+	// InterfaceVersion4 is cosmwasm 0.11 - 0.13: {"ok":...} / {"error":"..."} results, "attributes" instead of "log"
+	InterfaceVersion4 InterfaceVersion = 4
+	// InterfaceVersion5 is cosmwasm 0.14: like 4, but with the unified Response and submessages
+	InterfaceVersion5 InterfaceVersion = 5
+)
+
+var versionExportPrefixes = []string{"cosmwasm_vm_version_", "interface_version_"}
+
+// DetectInterfaceVersion finds the interface version marker in the given export names.
+// Returns an error if there is none or more than one.
+func DetectInterfaceVersion(exports []string) (InterfaceVersion, error) {
+	found := InterfaceVersionUnknown
+	for _, export := range exports {
+		for _, prefix := range versionExportPrefixes {
+			if !strings.HasPrefix(export, prefix) {
+				continue
+			}
+			v, err := strconv.Atoi(strings.TrimPrefix(export, prefix))
+			if err != nil || v <= 0 {
+				return InterfaceVersionUnknown, fmt.Errorf("invalid interface version export %q", export)
+			}
+			if found != InterfaceVersionUnknown {
+				return InterfaceVersionUnknown, fmt.Errorf("multiple interface version exports")
+			}
+			found = InterfaceVersion(v)
+		}
+	}
+	if found == InterfaceVersionUnknown {
+		return InterfaceVersionUnknown, fmt.Errorf("missing interface version export")
+	}
+	return found, nil
+}
+
+// IsLegacy returns true for the interface versions using the {"Ok":...} / {"Err":...} result encoding
+func (v InterfaceVersion) IsLegacy() bool {
+	return v <= InterfaceVersion3
+}
+
+func (v InterfaceVersion) String() string {
+	if v == InterfaceVersionUnknown {
+		return "unknown"
+	}
+	return strconv.Itoa(int(v))
+}
+
+//---------- Result Adapters ---------
+
+// contractResult is the generic result encoding since interface version 4
+type contractResult struct {
+	Ok    json.RawMessage `json:"ok,omitempty"`
+	Error *string         `json:"error,omitempty"`
+}
+
+// response is the success value since interface version 4. The fields are a superset
+// of the 0.11 InitResponse/HandleResponse/MigrateResponse and the 0.14 Response.
+type response struct {
+	Submessages []json.RawMessage `json:"submessages,omitempty"`
+	Messages    []CosmosMsg       `json:"messages"`
+	Attributes  []LogAttribute    `json:"attributes"`
+	Events      []Event           `json:"events"`
+	Data        []byte            `json:"data"`
+}
+
+// legacyResult is the result of init, handle and migrate up to interface version 3.
+// Their responses only differ in init having no data.
+type legacyResult struct {
+	Ok  *Response `json:"Ok,omitempty"`
+	Err *StdError `json:"Err,omitempty"`
+}
+
+// parseContractResult decodes a version 4+ result, returning the raw Ok value,
+// or the error message of the contract wrapped in a GenericErr
+func parseContractResult(data []byte) (json.RawMessage, error) {
+	var res contractResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, StdError{GenericErr: &GenericErr{Msg: *res.Error}}
+	}
+	if res.Ok == nil {
+		return nil, fmt.Errorf("contract result has neither ok nor error set")
+	}
+	return res.Ok, nil
+}
+
+// ParseResponse decodes the raw result of an init, handle or migrate call for the given interface version.
+// A contract error is returned as error (StdError).
+func ParseResponse(version InterfaceVersion, data []byte) (*Response, error) {
+	if version.IsLegacy() {
+		var res legacyResult
+		if err := json.Unmarshal(data, &res); err != nil {
+			return nil, err
+		}
+		if res.Err != nil {
+			return nil, *res.Err
+		}
+		if res.Ok == nil {
+			return nil, fmt.Errorf("contract result has neither Ok nor Err set")
+		}
+		return res.Ok, nil
+	}
+	raw, err := parseContractResult(data)
+	if err != nil {
+		return nil, err
+	}
+	var resp response
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Submessages) != 0 {
+		return nil, fmt.Errorf("submessages are not supported")
+	}
+	return &Response{
+		Messages: resp.Messages,
+		Data:     resp.Data,
+		Log:      resp.Attributes,
+		Events:   resp.Events,
+	}, nil
+}
+
+// ParseQueryResult decodes the raw result of a query call for the given interface version.
+// A contract error is returned as error (StdError).
+func ParseQueryResult(version InterfaceVersion, data []byte) ([]byte, error) {
+	if version.IsLegacy() {
+		var resp QueryResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Err != nil {
+			return nil, *resp.Err
+		}
+		return resp.Ok, nil
+	}
+	raw, err := parseContractResult(data)
+	if err != nil {
+		return nil, err
+	}
+	// the query result is base64 encoded Binary
+	var bz []byte
+	if err := json.Unmarshal(raw, &bz); err != nil {
+		return nil, err
+	}
+	return bz, nil
+}
@@ -0,0 +1,127 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectInterfaceVersion(t *testing.T) {
+	version, err := DetectInterfaceVersion([]string{"init", "handle", "cosmwasm_vm_version_3"})
+	require.NoError(t, err)
+	assert.Equal(t, InterfaceVersion3, version)
+	assert.True(t, version.IsLegacy())
+
+	version, err = DetectInterfaceVersion([]string{"cosmwasm_vm_version_4", "instantiate"})
+	require.NoError(t, err)
+	assert.Equal(t, InterfaceVersion4, version)
+	assert.False(t, version.IsLegacy())
+
+	version, err = DetectInterfaceVersion([]string{"interface_version_5"})
+	require.NoError(t, err)
+	assert.Equal(t, InterfaceVersion5, version)
+
+	_, err = DetectInterfaceVersion([]string{"init", "handle"})
+	require.Error(t, err)
+	_, err = DetectInterfaceVersion([]string{"cosmwasm_vm_version_3", "cosmwasm_vm_version_4"})
+	require.Error(t, err)
+	_, err = DetectInterfaceVersion([]string{"cosmwasm_vm_version_x"})
+	require.Error(t, err)
+}
+
+func TestParseResponseNormalizesVersions(t *testing.T) {
+	expected := &Response{
+		Messages: []CosmosMsg{{
+			Bank: &BankMsg{Send: &SendMsg{FromAddress: "contract", ToAddress: "bob", Amount: Coins{NewCoin(250, "ATOM")}}},
+		}},
+		Data: []byte{0xF0, 0x0B, 0xAA},
+		Log:  []LogAttribute{{Key: "action", Value: "release"}},
+	}
+	msgs := `[{"bank":{"send":{"from_address":"contract","to_address":"bob","amount":[{"denom":"ATOM","amount":"250"}]}}}]`
+
+	legacy := []byte(`{"Ok":{"messages":` + msgs + `,"data":"8Auq","log":[{"key":"action","value":"release"}]}}`)
+	resp, err := ParseResponse(InterfaceVersion3, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, expected, resp)
+
+	v4 := []byte(`{"ok":{"messages":` + msgs + `,"data":"8Auq","attributes":[{"key":"action","value":"release"}]}}`)
+	resp, err = ParseResponse(InterfaceVersion4, v4)
+	require.NoError(t, err)
+	assert.Equal(t, expected, resp)
+
+	v5 := []byte(`{"ok":{"submessages":[],"messages":` + msgs + `,"data":"8Auq","attributes":[{"key":"action","value":"release"}],"events":[]}}`)
+	resp, err = ParseResponse(InterfaceVersion5, v5)
+	require.NoError(t, err)
+	assert.Equal(t, []Event{}, resp.Events)
+	resp.Events = nil
+	assert.Equal(t, expected, resp)
+
+	// we cannot represent submessages
+	v5Sub := []byte(`{"ok":{"submessages":[{"id":1}],"messages":[],"data":null,"attributes":[]}}`)
+	_, err = ParseResponse(InterfaceVersion5, v5Sub)
+	require.Error(t, err)
+}
+
+func TestParseResponseKeepsEventsAndData(t *testing.T) {
+	cases := map[string]struct {
+		version  InterfaceVersion
+		data     string
+		expected *Response
+	}{
+		"legacy init without data": {
+			version:  InterfaceVersion3,
+			data:     `{"Ok":{"messages":[],"log":[{"key":"action","value":"init"}]}}`,
+			expected: &Response{Messages: []CosmosMsg{}, Log: []LogAttribute{{Key: "action", Value: "init"}}},
+		},
+		"v4 init with data": {
+			version:  InterfaceVersion4,
+			data:     `{"ok":{"messages":[],"attributes":[],"data":"AQI="}}`,
+			expected: &Response{Messages: []CosmosMsg{}, Log: []LogAttribute{}, Data: []byte{1, 2}},
+		},
+		"v5 events": {
+			version: InterfaceVersion5,
+			data:    `{"ok":{"messages":[],"attributes":[],"events":[{"type":"transfer","attributes":[{"key":"amount","value":"5uatom"}]}]}}`,
+			expected: &Response{
+				Messages: []CosmosMsg{},
+				Log:      []LogAttribute{},
+				Events:   []Event{{Type: "transfer", Attributes: []LogAttribute{{Key: "amount", Value: "5uatom"}}}},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := ParseResponse(tc.version, []byte(tc.data))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resp)
+		})
+	}
+}
+
+func TestParseResultErrors(t *testing.T) {
+	_, err := ParseResponse(InterfaceVersion3, []byte(`{"Err":{"unauthorized":{}}}`))
+	require.Error(t, err)
+	assert.Equal(t, StdError{Unauthorized: &Unauthorized{}}, err)
+
+	_, err = ParseResponse(InterfaceVersion4, []byte(`{"error":"Unauthorized"}`))
+	require.Error(t, err)
+	assert.Equal(t, StdError{GenericErr: &GenericErr{Msg: "Unauthorized"}}, err)
+
+	_, err = ParseResponse(InterfaceVersion4, []byte(`{}`))
+	require.Error(t, err)
+	_, err = ParseResponse(InterfaceVersion3, []byte(`{}`))
+	require.Error(t, err)
+}
+
+func TestParseQueryResult(t *testing.T) {
+	bz, err := ParseQueryResult(InterfaceVersion3, []byte(`{"Ok":"eyJ2ZXJpZmllciI6ImZyZWQifQ=="}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"verifier":"fred"}`, string(bz))
+
+	bz, err = ParseQueryResult(InterfaceVersion5, []byte(`{"ok":"eyJ2ZXJpZmllciI6ImZyZWQifQ=="}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"verifier":"fred"}`, string(bz))
+
+	_, err = ParseQueryResult(InterfaceVersion4, []byte(`{"error":"not found"}`))
+	assert.Equal(t, StdError{GenericErr: &GenericErr{Msg: "not found"}}, err)
+}
@@ -0,0 +1,89 @@
+package types
+
+// CallStack lists the contracts in a chain of nested calls, starting with the outermost one.
+// A contract is added when it is called from a transaction (instantiate, execute, migrate)
+// or as the target of a smart query.
+type CallStack []HumanAddress
+
+// Depth is the number of nested contract calls
+func (s CallStack) Depth() int {
+	return len(s)
+}
+
+// Push returns a new stack with contract added on top. It does not modify s.
+func (s CallStack) Push(contract HumanAddress) CallStack {
+	res := make(CallStack, len(s), len(s)+1)
+	copy(res, s)
+	return append(res, contract)
+}
+
+// Contains returns true if contract is on the stack, which means the contract is queried re-entrantly
+func (s CallStack) Contains(contract HumanAddress) bool {
+	for _, c := range s {
+		if c == contract {
+			return true
+		}
+	}
+	return false
+}
+
+// CallStackQuerier is an optional extension of Querier, which lets the Wasmer bound the depth of nested
+// smart queries. Without it, every Wasmer call starts a new stack and the depth cannot be limited.
+//
+// CallStack returns the stack of the call the querier is passed to, which is empty for calls from a transaction.
+// QueryWithCallStack is used instead of Query and gets the stack of the query, which ends with the queried
+// contract for smart queries. Hosts must pass a querier returning this stack to the nested Wasmer call.
+type CallStackQuerier interface {
+	Querier
+	CallStack() CallStack
+	QueryWithCallStack(request QueryRequest, gasLimit uint64, stack CallStack) ([]byte, error)
+}
+
+// CallStackOf returns the stack of the call querier is passed to, if it is a CallStackQuerier
+func CallStackOf(querier Querier) CallStack {
+	if sq, ok := querier.(CallStackQuerier); ok {
+		return sq.CallStack()
+	}
+	return nil
+}
+
+// WithCallStack wraps the querier of a contract call with the given stack. Smart queries that would make the
+// stack deeper than maxDepth are rejected with ExceededRecursionLimit. All other queries are passed on,
+// with their stack if querier is a CallStackQuerier. The Wasmer does this for every contract call.
+func WithCallStack(querier Querier, stack CallStack, maxDepth int) Querier {
+	return callStackQuerier{
+		Querier:  querier,
+		stack:    stack,
+		maxDepth: maxDepth,
+	}
+}
+
+type callStackQuerier struct {
+	Querier
+	stack    CallStack
+	maxDepth int
+}
+
+var _ CallStackQuerier = callStackQuerier{}
+
+func (q callStackQuerier) CallStack() CallStack {
+	return q.stack
+}
+
+func (q callStackQuerier) Query(request QueryRequest, gasLimit uint64) ([]byte, error) {
+	stack := q.stack
+	if request.Wasm != nil && request.Wasm.Smart != nil {
+		if stack.Depth() >= q.maxDepth {
+			return nil, ExceededRecursionLimit{Limit: q.maxDepth}
+		}
+		stack = stack.Push(request.Wasm.Smart.ContractAddr)
+	}
+	return q.QueryWithCallStack(request, gasLimit, stack)
+}
+
+func (q callStackQuerier) QueryWithCallStack(request QueryRequest, gasLimit uint64, stack CallStack) ([]byte, error) {
+	if sq, ok := q.Querier.(CallStackQuerier); ok {
+		return sq.QueryWithCallStack(request, gasLimit, stack)
+	}
+	return q.Querier.Query(request, gasLimit)
+}
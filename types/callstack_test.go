@@ -0,0 +1,102 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallStackPush(t *testing.T) {
+	var empty CallStack
+	one := empty.Push("a")
+	two := one.Push("b")
+	other := one.Push("c")
+
+	assert.Equal(t, 0, empty.Depth())
+	assert.Equal(t, CallStack{"a"}, one)
+	assert.Equal(t, CallStack{"a", "b"}, two)
+	// pushing never modifies the original
+	assert.Equal(t, CallStack{"a", "c"}, other)
+	assert.True(t, two.Contains("a"))
+	assert.False(t, two.Contains("c"))
+}
+
+// stackRecorder is a host querier that records the stacks it gets
+type stackRecorder struct {
+	stack  CallStack
+	stacks []CallStack
+}
+
+var _ CallStackQuerier = (*stackRecorder)(nil)
+
+func (r *stackRecorder) Query(request QueryRequest, gasLimit uint64) ([]byte, error) {
+	return r.QueryWithCallStack(request, gasLimit, nil)
+}
+
+func (r *stackRecorder) QueryWithCallStack(request QueryRequest, gasLimit uint64, stack CallStack) ([]byte, error) {
+	r.stacks = append(r.stacks, stack)
+	return []byte("{}"), nil
+}
+
+func (r *stackRecorder) GasConsumed() uint64 {
+	return 0
+}
+
+func (r *stackRecorder) CallStack() CallStack {
+	return r.stack
+}
+
+func smartQuery(contract HumanAddress) QueryRequest {
+	return QueryRequest{Wasm: &WasmQuery{Smart: &SmartQuery{ContractAddr: contract, Msg: []byte("{}")}}}
+}
+
+func TestWithCallStack(t *testing.T) {
+	host := &stackRecorder{stack: CallStack{"a"}}
+	assert.Equal(t, CallStack{"a"}, CallStackOf(host))
+	assert.Nil(t, CallStackOf(stackless{}))
+
+	querier := WithCallStack(host, CallStack{"a", "b"}, 3)
+	assert.Equal(t, CallStack{"a", "b"}, CallStackOf(querier))
+
+	// a smart query pushes its target
+	_, err := querier.Query(smartQuery("c"), 1000)
+	require.NoError(t, err)
+	// other queries get the stack of the call
+	_, err = querier.Query(QueryRequest{Bank: &BankQuery{}}, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []CallStack{{"a", "b", "c"}, {"a", "b"}}, host.stacks)
+
+	// the next level is too deep
+	deep := WithCallStack(host, CallStack{"a", "b", "c"}, 3)
+	_, err = deep.Query(smartQuery("d"), 1000)
+	assert.Equal(t, ExceededRecursionLimit{Limit: 3}, err)
+	assert.Len(t, host.stacks, 2)
+	// which the contract gets as a SystemError
+	res := ToQuerierResult(nil, err)
+	require.NotNil(t, res.Err)
+	assert.Equal(t, &ExceededRecursionLimit{Limit: 3}, res.Err.ExceededRecursionLimit)
+
+	// but non-smart queries still work
+	_, err = deep.Query(QueryRequest{Bank: &BankQuery{}}, 1000)
+	require.NoError(t, err)
+}
+
+// stackless is a querier that does not know about call stacks
+type stackless struct{}
+
+func (stackless) Query(request QueryRequest, gasLimit uint64) ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+func (stackless) GasConsumed() uint64 {
+	return 0
+}
+
+func TestWithCallStackForPlainQuerier(t *testing.T) {
+	querier := WithCallStack(stackless{}, CallStack{"a"}, 1)
+	_, err := querier.Query(smartQuery("b"), 1000)
+	assert.Equal(t, ExceededRecursionLimit{Limit: 1}, err)
+	_, err = querier.Query(QueryRequest{Bank: &BankQuery{}}, 1000)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+//---------- Canonical JSON ---------
+
+// CanonicalJSONMarshal encodes v to JSON that is byte-for-byte identical to the output of serde_json
+// serializing the same data as a `serde_json::Value` on the Rust side. That is:
+//
+//   - object keys are sorted (by their UTF-8 bytes)
+//   - no insignificant whitespace
+//   - no HTML escaping of <, > and & (and no escaping of U+2028 / U+2029)
+//   - control characters are escaped as \b, \t, \n, \f, \r or \u00xx (lowercase hex)
+//
+// Use this for every consensus critical data we send into the VM (like Env), so the bytes do not depend on
+// the Go struct field order or the escaping rules of encoding/json.
+//
+// v is first encoded with encoding/json, so all `json` tags and custom MarshalJSON methods are respected.
+// Only integer numbers are supported, as float formatting differs between Go and Rust.
+func CanonicalJSONMarshal(v interface{}) ([]byte, error) {
+	return AppendCanonicalJSON(nil, v)
+}
+
+// AppendCanonicalJSON appends the canonical JSON encoding of v (see CanonicalJSONMarshal) to dst,
+// so callers can reuse a buffer
+func AppendCanonicalJSON(dst []byte, v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendCanonicalJSON(dst, raw)
+}
+
+// CanonicalizeJSON re-encodes the given JSON document in the canonical form described in CanonicalJSONMarshal
+func CanonicalizeJSON(raw []byte) ([]byte, error) {
+	return appendCanonicalJSON(nil, raw)
+}
+
+func appendCanonicalJSON(dst []byte, raw []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after top-level JSON value")
+	}
+	buf := bytes.NewBuffer(dst)
+	if err := writeCanonical(buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var canonicalInteger = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+
+func writeCanonical(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case json.Number:
+		if !canonicalInteger.MatchString(string(v)) {
+			return fmt.Errorf("non-integer number %s cannot be canonically encoded", v)
+		}
+		buf.WriteString(string(v))
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", value)
+	}
+	return nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// writeCanonicalString follows the escape table of serde_json (ser.rs, ESCAPE)
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			buf.WriteString(`\"`)
+		case c == '\\':
+			buf.WriteString(`\\`)
+		case c == '\b':
+			buf.WriteString(`\b`)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c == '\f':
+			buf.WriteString(`\f`)
+		case c == '\r':
+			buf.WriteString(`\r`)
+		case c < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hexDigits[c>>4])
+			buf.WriteByte(hexDigits[c&0xf])
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+}
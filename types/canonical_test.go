@@ -0,0 +1,88 @@
+package types
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// canonicalEnv is the Env encoded in testdata/canonical_env.json.
+// The same file is checked against serde_json in src/tests.rs, which proves byte equality with the Rust side.
+func canonicalEnv() Env {
+	return Env{
+		Block: BlockInfo{
+			Height:  12345,
+			Time:    1578939743,
+			ChainID: "test<net>&co\u2028",
+		},
+		Message: MessageInfo{
+			Sender:    "terra1\"quoted\"\\slash/",
+			SentFunds: Coins{NewCoin(100, "uluna"), NewCoin(7, "ukrw")},
+		},
+		Contract: ContractInfo{
+			Address: "contract\x01\x1f\x7f\t\n\r\b\fé",
+		},
+	}
+}
+
+func TestCanonicalJSONMatchesSerde(t *testing.T) {
+	expected, err := ioutil.ReadFile("testdata/canonical_env.json")
+	require.NoError(t, err)
+
+	bz, err := CanonicalJSONMarshal(canonicalEnv())
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(bz))
+
+	// encoding/json would produce different bytes
+	std, err := json.Marshal(canonicalEnv())
+	require.NoError(t, err)
+	assert.NotEqual(t, string(expected), string(std))
+
+	// but both decode to the same value
+	var recover Env
+	err = json.Unmarshal(bz, &recover)
+	require.NoError(t, err)
+	assert.Equal(t, canonicalEnv(), recover)
+}
+
+func TestCanonicalJSONIsIdempotent(t *testing.T) {
+	expected, err := ioutil.ReadFile("testdata/canonical_env.json")
+	require.NoError(t, err)
+	bz, err := CanonicalizeJSON(expected)
+	require.NoError(t, err)
+	assert.Equal(t, expected, bz)
+}
+
+func TestCanonicalJSONSortsKeys(t *testing.T) {
+	bz, err := CanonicalizeJSON([]byte(` { "b": 1, "a": {"z": [true, null], "B": "x"}, "A": -7 } `))
+	require.NoError(t, err)
+	assert.Equal(t, `{"A":-7,"a":{"B":"x","z":[true,null]},"b":1}`, string(bz))
+}
+
+func TestCanonicalJSONEscaping(t *testing.T) {
+	bz, err := CanonicalJSONMarshal("<a href=\"x\">&amp;</a>\u2029\x00")
+	require.NoError(t, err)
+	assert.Equal(t, `"<a href=\"x\">&amp;</a>`+"\u2029"+`\u0000"`, string(bz))
+}
+
+func TestCanonicalJSONRejectsFloats(t *testing.T) {
+	_, err := CanonicalJSONMarshal(map[string]float64{"a": 1.5})
+	require.Error(t, err)
+	_, err = CanonicalizeJSON([]byte(`{"a":1e3}`))
+	require.Error(t, err)
+	_, err = CanonicalizeJSON([]byte(`{"a":1} {}`))
+	require.Error(t, err)
+}
+
+func TestAppendCanonicalJSON(t *testing.T) {
+	dst := make([]byte, 0, 64)
+	dst = append(dst, "prefix:"...)
+	res, err := AppendCanonicalJSON(dst, map[string]int{"b": 1, "a": 2})
+	require.NoError(t, err)
+	assert.Equal(t, `prefix:{"a":2,"b":1}`, string(res))
+	// the result is built in the buffer of dst
+	assert.Equal(t, &dst[:1][0], &res[0])
+}
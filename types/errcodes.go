@@ -0,0 +1,176 @@
+package types
+
+import "errors"
+
+// Codespace is the ABCI codespace of all errors defined in this package
+const Codespace = "cosmwasm"
+
+// Registered ABCI codes. These are part of the public API and must never be changed or reused.
+// StdError variants are in the 1xx range, SystemError variants in the 2xx range.
+const (
+	CodeGenericErr    uint32 = 101
+	CodeInvalidBase64 uint32 = 102
+	CodeInvalidUtf8   uint32 = 103
+	CodeNotFound      uint32 = 104
+	CodeParseErr      uint32 = 105
+	CodeSerializeErr  uint32 = 106
+	CodeUnauthorized  uint32 = 107
+	CodeUnderflow     uint32 = 108
+
+	CodeInvalidRequest         uint32 = 201
+	CodeInvalidResponse        uint32 = 202
+	CodeNoSuchContract         uint32 = 203
+	CodeUnknown                uint32 = 204
+	CodeUnsupportedRequest     uint32 = 205
+	CodeExceededRecursionLimit uint32 = 206
+)
+
+// CodedError is implemented by all errors that have a registered ABCI code
+type CodedError interface {
+	error
+	Codespace() string
+	ABCICode() uint32
+}
+
+var (
+	_ CodedError = StdError{}
+	_ CodedError = GenericErr{}
+	_ CodedError = InvalidBase64{}
+	_ CodedError = InvalidUtf8{}
+	_ CodedError = NotFound{}
+	_ CodedError = ParseErr{}
+	_ CodedError = SerializeErr{}
+	_ CodedError = Unauthorized{}
+	_ CodedError = Underflow{}
+
+	_ CodedError = SystemError{}
+	_ CodedError = InvalidRequest{}
+	_ CodedError = InvalidResponse{}
+	_ CodedError = NoSuchContract{}
+	_ CodedError = Unknown{}
+	_ CodedError = UnsupportedRequest{}
+	_ CodedError = ExceededRecursionLimit{}
+)
+
+// registeredErrors maps every registered code to a constructor of an empty error of that variant
+var registeredErrors = map[uint32]func() CodedError{
+	CodeGenericErr:    func() CodedError { return GenericErr{} },
+	CodeInvalidBase64: func() CodedError { return InvalidBase64{} },
+	CodeInvalidUtf8:   func() CodedError { return InvalidUtf8{} },
+	CodeNotFound:      func() CodedError { return NotFound{} },
+	CodeParseErr:      func() CodedError { return ParseErr{} },
+	CodeSerializeErr:  func() CodedError { return SerializeErr{} },
+	CodeUnauthorized:  func() CodedError { return Unauthorized{} },
+	CodeUnderflow:     func() CodedError { return Underflow{} },
+
+	CodeInvalidRequest:         func() CodedError { return InvalidRequest{} },
+	CodeInvalidResponse:        func() CodedError { return InvalidResponse{} },
+	CodeNoSuchContract:         func() CodedError { return NoSuchContract{} },
+	CodeUnknown:                func() CodedError { return Unknown{} },
+	CodeUnsupportedRequest:     func() CodedError { return UnsupportedRequest{} },
+	CodeExceededRecursionLimit: func() CodedError { return ExceededRecursionLimit{} },
+}
+
+// ErrorForCode is the reverse lookup of ABCICode. Given a codespace and code from an ABCI response
+// it returns an empty error of the matching variant, so clients can switch on its type.
+// Returns false if the code is not registered in our codespace.
+func ErrorForCode(codespace string, code uint32) (CodedError, bool) {
+	if codespace != Codespace {
+		return nil, false
+	}
+	constructor, ok := registeredErrors[code]
+	if !ok {
+		return nil, false
+	}
+	return constructor(), true
+}
+
+// ABCIInfo returns the codespace and code of the first CodedError in the chain of err.
+// Returns false if there is none, in which case the embedding chain should use its own internal error code.
+func ABCIInfo(err error) (string, uint32, bool) {
+	var coded CodedError
+	if !errors.As(err, &coded) {
+		return "", 0, false
+	}
+	return coded.Codespace(), coded.ABCICode(), true
+}
+
+// ABCICode returns the registered code of the variant that is set.
+// If none is set, it returns CodeGenericErr.
+func (a StdError) ABCICode() uint32 {
+	switch {
+	case a.GenericErr != nil:
+		return a.GenericErr.ABCICode()
+	case a.InvalidBase64 != nil:
+		return a.InvalidBase64.ABCICode()
+	case a.InvalidUtf8 != nil:
+		return a.InvalidUtf8.ABCICode()
+	case a.NotFound != nil:
+		return a.NotFound.ABCICode()
+	case a.ParseErr != nil:
+		return a.ParseErr.ABCICode()
+	case a.SerializeErr != nil:
+		return a.SerializeErr.ABCICode()
+	case a.Unauthorized != nil:
+		return a.Unauthorized.ABCICode()
+	case a.Underflow != nil:
+		return a.Underflow.ABCICode()
+	default:
+		return CodeGenericErr
+	}
+}
+
+func (a StdError) Codespace() string { return Codespace }
+
+func (e GenericErr) ABCICode() uint32     { return CodeGenericErr }
+func (e GenericErr) Codespace() string    { return Codespace }
+func (e InvalidBase64) ABCICode() uint32  { return CodeInvalidBase64 }
+func (e InvalidBase64) Codespace() string { return Codespace }
+func (e InvalidUtf8) ABCICode() uint32    { return CodeInvalidUtf8 }
+func (e InvalidUtf8) Codespace() string   { return Codespace }
+func (e NotFound) ABCICode() uint32       { return CodeNotFound }
+func (e NotFound) Codespace() string      { return Codespace }
+func (e ParseErr) ABCICode() uint32       { return CodeParseErr }
+func (e ParseErr) Codespace() string      { return Codespace }
+func (e SerializeErr) ABCICode() uint32   { return CodeSerializeErr }
+func (e SerializeErr) Codespace() string  { return Codespace }
+func (e Unauthorized) ABCICode() uint32   { return CodeUnauthorized }
+func (e Unauthorized) Codespace() string  { return Codespace }
+func (e Underflow) ABCICode() uint32      { return CodeUnderflow }
+func (e Underflow) Codespace() string     { return Codespace }
+
+// ABCICode returns the registered code of the variant that is set.
+// If none is set, it returns CodeUnknown.
+func (a SystemError) ABCICode() uint32 {
+	switch {
+	case a.InvalidRequest != nil:
+		return a.InvalidRequest.ABCICode()
+	case a.InvalidResponse != nil:
+		return a.InvalidResponse.ABCICode()
+	case a.NoSuchContract != nil:
+		return a.NoSuchContract.ABCICode()
+	case a.Unknown != nil:
+		return a.Unknown.ABCICode()
+	case a.UnsupportedRequest != nil:
+		return a.UnsupportedRequest.ABCICode()
+	case a.ExceededRecursionLimit != nil:
+		return a.ExceededRecursionLimit.ABCICode()
+	default:
+		return CodeUnknown
+	}
+}
+
+func (a SystemError) Codespace() string { return Codespace }
+
+func (e InvalidRequest) ABCICode() uint32          { return CodeInvalidRequest }
+func (e InvalidRequest) Codespace() string         { return Codespace }
+func (e InvalidResponse) ABCICode() uint32         { return CodeInvalidResponse }
+func (e InvalidResponse) Codespace() string        { return Codespace }
+func (e NoSuchContract) ABCICode() uint32          { return CodeNoSuchContract }
+func (e NoSuchContract) Codespace() string         { return Codespace }
+func (e Unknown) ABCICode() uint32                 { return CodeUnknown }
+func (e Unknown) Codespace() string                { return Codespace }
+func (e UnsupportedRequest) ABCICode() uint32      { return CodeUnsupportedRequest }
+func (e UnsupportedRequest) Codespace() string     { return Codespace }
+func (e ExceededRecursionLimit) ABCICode() uint32  { return CodeExceededRecursionLimit }
+func (e ExceededRecursionLimit) Codespace() string { return Codespace }
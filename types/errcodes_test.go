@@ -0,0 +1,62 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdErrorCodes(t *testing.T) {
+	err := ToStdError(NotFound{Kind: "State"})
+	assert.Equal(t, CodeNotFound, err.ABCICode())
+	assert.Equal(t, Codespace, err.Codespace())
+
+	err = ToStdError(fmt.Errorf("some random error"))
+	assert.Equal(t, CodeGenericErr, err.ABCICode())
+
+	assert.Equal(t, CodeUnderflow, StdError{Underflow: &Underflow{}}.ABCICode())
+	assert.Equal(t, CodeUnauthorized, Unauthorized{}.ABCICode())
+}
+
+func TestSystemErrorCodes(t *testing.T) {
+	err := ToSystemError(NoSuchContract{Addr: "foobar"})
+	assert.Equal(t, CodeNoSuchContract, err.ABCICode())
+	assert.Equal(t, Codespace, err.Codespace())
+
+	assert.Equal(t, CodeInvalidRequest, SystemError{InvalidRequest: &InvalidRequest{}}.ABCICode())
+	assert.Equal(t, CodeUnknown, SystemError{}.ABCICode())
+}
+
+func TestErrorForCodeRoundTrip(t *testing.T) {
+	seen := make(map[uint32]bool)
+	for code := range registeredErrors {
+		err, ok := ErrorForCode(Codespace, code)
+		require.True(t, ok)
+		assert.Equal(t, code, err.ABCICode())
+		seen[code] = true
+	}
+	// codes are unique per variant
+	assert.Equal(t, 14, len(seen))
+
+	err, ok := ErrorForCode(Codespace, CodeUnsupportedRequest)
+	require.True(t, ok)
+	assert.IsType(t, UnsupportedRequest{}, err)
+
+	_, ok = ErrorForCode(Codespace, 999)
+	assert.False(t, ok)
+	_, ok = ErrorForCode("sdk", CodeGenericErr)
+	assert.False(t, ok)
+}
+
+func TestABCIInfo(t *testing.T) {
+	wrapped := fmt.Errorf("executing contract: %w", StdError{ParseErr: &ParseErr{Target: "QueryMsg"}})
+	codespace, code, ok := ABCIInfo(wrapped)
+	require.True(t, ok)
+	assert.Equal(t, Codespace, codespace)
+	assert.Equal(t, CodeParseErr, code)
+
+	_, _, ok = ABCIInfo(fmt.Errorf("plain"))
+	assert.False(t, ok)
+}
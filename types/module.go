@@ -0,0 +1,312 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//---------- Wasm Module ---------
+
+// wasmMagic and wasmVersion form the 8 byte preamble of every wasm binary
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d}
+var wasmVersion = []byte{0x01, 0x00, 0x00, 0x00}
+
+// section ids as defined in the wasm binary spec
+// https://webassembly.github.io/spec/core/binary/modules.html#sections
+const (
+	sectionImport byte = 2
+	sectionMemory byte = 5
+	sectionExport byte = 7
+)
+
+// extern kinds of imports and exports
+const (
+	externFunc   byte = 0
+	externTable  byte = 1
+	externMemory byte = 2
+	externGlobal byte = 3
+)
+
+// requiresPrefix marks exports that declare a required feature, e.g. "requires_staking"
+const requiresPrefix = "requires_"
+
+// ModuleInfo contains the statically known information about a wasm blob,
+// that can be extracted without compiling it
+type ModuleInfo struct {
+	// Exports lists the names of all exported items (functions, memories, ...)
+	Exports []string
+	// ExportedFunctions lists the names of the exported functions only
+	ExportedFunctions []string
+	// Imports lists everything the module expects from the host
+	Imports []Import
+	// Memories lists the defined and imported memories
+	Memories []MemoryLimits
+}
+
+// Import is an item the module imports from the host
+type Import struct {
+	Module string
+	Name   string
+	// Kind is one of "func", "table", "memory" or "global"
+	Kind string
+}
+
+// String returns the import as "module.name"
+func (i Import) String() string {
+	return i.Module + "." + i.Name
+}
+
+// MemoryLimits are the limits of a memory in pages of 64 KiB
+type MemoryLimits struct {
+	Min uint32
+	// Max is nil if the memory has no upper limit
+	Max      *uint32
+	Imported bool
+}
+
+// ParseModule reads the sections of a wasm binary that we care about.
+// It does not validate the code, this is left to the VM.
+func ParseModule(code []byte) (*ModuleInfo, error) {
+	if len(code) < 8 || !bytes.Equal(code[:4], wasmMagic) {
+		return nil, errors.New("not a wasm binary: missing magic header")
+	}
+	if !bytes.Equal(code[4:8], wasmVersion) {
+		return nil, fmt.Errorf("unsupported wasm binary version %x", code[4:8])
+	}
+
+	info := ModuleInfo{}
+	r := wasmReader{data: code, pos: 8}
+	for !r.done() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		body, err := r.bytes(int(size))
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %v", id, err)
+		}
+		section := wasmReader{data: body}
+		switch id {
+		case sectionImport:
+			err = info.readImports(&section)
+		case sectionMemory:
+			err = info.readMemories(&section)
+		case sectionExport:
+			err = info.readExports(&section)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %v", id, err)
+		}
+	}
+	return &info, nil
+}
+
+func (m *ModuleInfo) readExports(r *wasmReader) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if _, err := r.u32(); err != nil {
+			return err
+		}
+		m.Exports = append(m.Exports, name)
+		if kind == externFunc {
+			m.ExportedFunctions = append(m.ExportedFunctions, name)
+		}
+	}
+	return nil
+}
+
+func (m *ModuleInfo) readImports(r *wasmReader) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		module, err := r.name()
+		if err != nil {
+			return err
+		}
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		imp := Import{Module: module, Name: name}
+		switch kind {
+		case externFunc:
+			imp.Kind = "func"
+			_, err = r.u32()
+		case externTable:
+			imp.Kind = "table"
+			if _, err = r.byte(); err == nil {
+				_, err = r.limits()
+			}
+		case externMemory:
+			imp.Kind = "memory"
+			var limits MemoryLimits
+			if limits, err = r.limits(); err == nil {
+				limits.Imported = true
+				m.Memories = append(m.Memories, limits)
+			}
+		case externGlobal:
+			imp.Kind = "global"
+			_, err = r.bytes(2)
+		default:
+			err = fmt.Errorf("unknown import kind %d", kind)
+		}
+		if err != nil {
+			return err
+		}
+		m.Imports = append(m.Imports, imp)
+	}
+	return nil
+}
+
+func (m *ModuleInfo) readMemories(r *wasmReader) error {
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		limits, err := r.limits()
+		if err != nil {
+			return err
+		}
+		m.Memories = append(m.Memories, limits)
+	}
+	return nil
+}
+
+// ImportedFunctions returns the imported host functions as "module.name"
+func (m ModuleInfo) ImportedFunctions() []string {
+	var funcs []string
+	for _, imp := range m.Imports {
+		if imp.Kind == "func" {
+			funcs = append(funcs, imp.String())
+		}
+	}
+	return funcs
+}
+
+// RequiredFeatures returns the features the contract declares with "requires_*" exports
+func (m ModuleInfo) RequiredFeatures() []string {
+	var features []string
+	for _, e := range m.Exports {
+		if strings.HasPrefix(e, requiresPrefix) && len(e) > len(requiresPrefix) {
+			features = append(features, e[len(requiresPrefix):])
+		}
+	}
+	return features
+}
+
+// HasExport returns true if the module exports an item with the given name
+func (m ModuleInfo) HasExport(name string) bool {
+	for _, e := range m.Exports {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+// wasmReader is a minimal cursor over the wasm binary format
+type wasmReader struct {
+	data []byte
+	pos  int
+}
+
+var errUnexpectedEnd = errors.New("unexpected end of wasm binary")
+
+func (r *wasmReader) done() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *wasmReader) byte() (byte, error) {
+	if r.done() {
+		return 0, errUnexpectedEnd
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *wasmReader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errUnexpectedEnd
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// u32 reads an unsigned LEB128 encoded integer of at most 32 bits
+func (r *wasmReader) u32() (uint32, error) {
+	var result uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+	return 0, errors.New("invalid LEB128 encoding of u32")
+}
+
+// limits reads the limits of a memory or table
+func (r *wasmReader) limits() (MemoryLimits, error) {
+	flag, err := r.byte()
+	if err != nil {
+		return MemoryLimits{}, err
+	}
+	min, err := r.u32()
+	if err != nil {
+		return MemoryLimits{}, err
+	}
+	limits := MemoryLimits{Min: min}
+	switch flag {
+	case 0x00:
+	case 0x01:
+		max, err := r.u32()
+		if err != nil {
+			return MemoryLimits{}, err
+		}
+		limits.Max = &max
+	default:
+		return MemoryLimits{}, fmt.Errorf("invalid limits flag %d", flag)
+	}
+	return limits, nil
+}
+
+func (r *wasmReader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(int(n))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModuleExports(t *testing.T) {
+	wasm, err := ioutil.ReadFile("../api/testdata/hackatom.wasm")
+	require.NoError(t, err)
+
+	module, err := ParseModule(wasm)
+	require.NoError(t, err)
+	for _, name := range []string{"init", "handle", "query", "migrate", "allocate", "deallocate", "cosmwasm_vm_version_3"} {
+		assert.Contains(t, module.ExportedFunctions, name)
+	}
+	assert.True(t, module.HasExport("memory"))
+	assert.NotContains(t, module.ExportedFunctions, "memory")
+}
+
+func TestParseModuleRejectsInvalidData(t *testing.T) {
+	_, err := ParseModule([]byte("some invalid data"))
+	require.Error(t, err)
+
+	// valid header, truncated section
+	_, err = ParseModule([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x07, 0x10, 0x01})
+	require.Error(t, err)
+
+	// the empty module is fine
+	module, err := ParseModule([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})
+	require.NoError(t, err)
+	assert.Empty(t, module.Exports)
+}
+
+func TestParseModuleImportsAndMemory(t *testing.T) {
+	wasm, err := ioutil.ReadFile("../api/testdata/hackatom.wasm")
+	require.NoError(t, err)
+
+	module, err := ParseModule(wasm)
+	require.NoError(t, err)
+	funcs := module.ImportedFunctions()
+	for _, name := range []string{"env.db_read", "env.db_write", "env.canonicalize_address", "env.humanize_address"} {
+		assert.Contains(t, funcs, name)
+	}
+	require.Len(t, module.Memories, 1)
+	assert.False(t, module.Memories[0].Imported)
+	assert.True(t, module.Memories[0].Min > 0)
+	assert.Empty(t, module.RequiredFeatures())
+}
+
+func TestParseModuleLimitsAndFeatures(t *testing.T) {
+	module, err := ParseModule([]byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		// import section: (import "env" "mem" (memory 1 2))
+		0x02, 0x0d, 0x01, 0x03, 'e', 'n', 'v', 0x03, 'm', 'e', 'm', 0x02, 0x01, 0x01, 0x02,
+		// memory section: (memory 17)
+		0x05, 0x03, 0x01, 0x00, 0x11,
+		// export section: (export "requires_staking" (func 0))
+		0x07, 0x14, 0x01, 0x10, 'r', 'e', 'q', 'u', 'i', 'r', 'e', 's', '_', 's', 't', 'a', 'k', 'i', 'n', 'g', 0x00, 0x00,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Import{{Module: "env", Name: "mem", Kind: "memory"}}, module.Imports)
+	assert.Empty(t, module.ImportedFunctions())
+	require.Len(t, module.Memories, 2)
+	assert.True(t, module.Memories[0].Imported)
+	assert.Equal(t, uint32(1), module.Memories[0].Min)
+	require.NotNil(t, module.Memories[0].Max)
+	assert.Equal(t, uint32(2), *module.Memories[0].Max)
+	assert.Equal(t, uint32(17), module.Memories[1].Min)
+	assert.Nil(t, module.Memories[1].Max)
+	assert.Equal(t, []string{"staking"}, module.RequiredFeatures())
+}
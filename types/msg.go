@@ -52,6 +52,25 @@ type MigrateResponse struct {
 	Log []LogAttribute `json:"log"`
 }
 
+// Response is the return value of a successful init, handle or migrate, the same for every interface version.
+// Fields the interface version of the contract does not know are empty.
+type Response struct {
+	// Messages comes directly from the contract and is it's request for action
+	Messages []CosmosMsg `json:"messages"`
+	// base64-encoded bytes to return as ABCI.Data field, init only returns data since interface version 4
+	Data []byte `json:"data"`
+	// log message to return over abci interface, the attributes since interface version 4
+	Log []LogAttribute `json:"log"`
+	// Events are the custom events of the contract, since interface version 5
+	Events []Event `json:"events,omitempty"`
+}
+
+// Event is a custom event emitted by a contract, or by the handler of one of its messages
+type Event struct {
+	Type       string         `json:"type"`
+	Attributes []LogAttribute `json:"attributes"`
+}
+
 // LogAttribute
 type LogAttribute struct {
 	Key   string `json:"key"`
@@ -12,6 +12,9 @@ type SystemError struct {
 	NoSuchContract     *NoSuchContract     `json:"no_such_contract,omitempty"`
 	Unknown            *Unknown            `json:"unknown,omitempty"`
 	UnsupportedRequest *UnsupportedRequest `json:"unsupported_request,omitempty"`
+	// ExceededRecursionLimit is only produced by the Go side. The VM does not know this variant yet,
+	// so contracts receive it as InvalidResponse (which still fails the query).
+	ExceededRecursionLimit *ExceededRecursionLimit `json:"exceeded_recursion_limit,omitempty"`
 }
 
 var (
@@ -21,6 +24,7 @@ var (
 	_ error = NoSuchContract{}
 	_ error = Unknown{}
 	_ error = UnsupportedRequest{}
+	_ error = ExceededRecursionLimit{}
 )
 
 func (a SystemError) Error() string {
@@ -35,6 +39,8 @@ func (a SystemError) Error() string {
 		return a.Unknown.Error()
 	case a.UnsupportedRequest != nil:
 		return a.UnsupportedRequest.Error()
+	case a.ExceededRecursionLimit != nil:
+		return a.ExceededRecursionLimit.Error()
 	default:
 		panic("unknown error variant")
 	}
@@ -80,6 +86,15 @@ func (e UnsupportedRequest) Error() string {
 	return fmt.Sprintf("unsupported request: %s", e.Kind)
 }
 
+// ExceededRecursionLimit is returned for a smart query that would exceed the maximum depth of nested contract calls
+type ExceededRecursionLimit struct {
+	Limit int `json:"limit"`
+}
+
+func (e ExceededRecursionLimit) Error() string {
+	return fmt.Sprintf("exceeded recursion limit of %d nested contract calls", e.Limit)
+}
+
 // ToSystemError will try to convert the given error to an SystemError.
 // This is important to returning any Go error back to Rust.
 //
@@ -118,6 +133,10 @@ func ToSystemError(err error) *SystemError {
 		return &SystemError{UnsupportedRequest: &t}
 	case *UnsupportedRequest:
 		return &SystemError{UnsupportedRequest: t}
+	case ExceededRecursionLimit:
+		return &SystemError{ExceededRecursionLimit: &t}
+	case *ExceededRecursionLimit:
+		return &SystemError{ExceededRecursionLimit: t}
 	default:
 		return nil
 	}
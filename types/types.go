@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"fmt"
 	"strconv"
 )
 
@@ -50,10 +51,87 @@ func (c *Coins) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-type OutOfGasError struct{}
+// OutOfGasError is returned when a contract call runs out of gas, either in wasm execution
+// or in a callback into the sdk (like a storage write or a nested query).
+type OutOfGasError struct {
+	// Descriptor is the descriptor of the sdk gas meter panic (e.g. "WriteFlat").
+	// It is empty if the wasm gas limit was exceeded.
+	Descriptor string
+	// CallSite is the name of the callback in which the gas ran out (e.g. "db_write").
+	// It is empty if the gas ran out in wasm execution.
+	CallSite string
+	// Overflow is set if the sdk gas meter overflowed (ErrorGasOverflow) rather than reaching its limit
+	Overflow bool
+	// GasLimit and GasUsed are the wasm gas numbers of the failed call
+	GasLimit uint64
+	GasUsed  uint64
+}
 
 var _ error = OutOfGasError{}
 
 func (o OutOfGasError) Error() string {
-	return "Out of gas"
+	msg := "Out of gas"
+	if o.Overflow {
+		msg = "Gas overflow"
+	}
+	if o.CallSite != "" {
+		msg += " in " + o.CallSite
+	}
+	if o.Descriptor != "" {
+		msg += fmt.Sprintf(" (%s)", o.Descriptor)
+	}
+	if o.GasLimit != 0 {
+		msg += fmt.Sprintf(": used %d of %d gas", o.GasUsed, o.GasLimit)
+	}
+	return msg
+}
+
+// StorageBackendError is returned when the KVStore of the host fails while the contract uses it,
+// e.g. an iterator over a corrupted or closed database. The contract execution is aborted
+// and its result must be discarded.
+type StorageBackendError struct {
+	// Op is the storage operation that failed ("scan" or "next")
+	Op  string
+	Err error
+}
+
+var _ error = StorageBackendError{}
+
+func (e StorageBackendError) Error() string {
+	return fmt.Sprintf("storage backend error in %s: %v", e.Op, e.Err)
+}
+
+func (e StorageBackendError) Unwrap() error {
+	return e.Err
+}
+
+// WriteInQueryError is returned when a contract tries to modify its storage during a query.
+// Queries only get read access to the store, so the contract execution is aborted.
+type WriteInQueryError struct {
+	// Op is the rejected storage operation ("set" or "delete")
+	Op  string
+	Key []byte
+}
+
+var _ error = WriteInQueryError{}
+
+func (e WriteInQueryError) Error() string {
+	return fmt.Sprintf("contract tried to %s key %X in a read-only query", e.Op, e.Key)
+}
+
+// CallbackPanicError is returned when a Go callback (storage, api or querier) panicked during a contract call.
+// This is a bug in the host, not in the contract. The contract execution is aborted and its result must be discarded.
+type CallbackPanicError struct {
+	// CallSite is the name of the callback that panicked (e.g. "query_external")
+	CallSite string
+	// Value is the value passed to panic
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine, as returned by runtime/debug.Stack
+	Stack []byte
+}
+
+var _ error = CallbackPanicError{}
+
+func (e CallbackPanicError) Error() string {
+	return fmt.Sprintf("panic in Go callback %s: %v", e.CallSite, e.Value)
 }
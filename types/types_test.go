@@ -0,0 +1,36 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutOfGasErrorMessage(t *testing.T) {
+	cases := map[string]struct {
+		err      OutOfGasError
+		expected string
+	}{
+		"empty": {
+			err:      OutOfGasError{},
+			expected: "Out of gas",
+		},
+		"wasm": {
+			err:      OutOfGasError{GasLimit: 500, GasUsed: 500},
+			expected: "Out of gas: used 500 of 500 gas",
+		},
+		"callback": {
+			err:      OutOfGasError{CallSite: "db_write", Descriptor: "WriteFlat", GasLimit: 500, GasUsed: 123},
+			expected: "Out of gas in db_write (WriteFlat): used 123 of 500 gas",
+		},
+		"overflow": {
+			err:      OutOfGasError{CallSite: "query_external", Descriptor: "query", Overflow: true},
+			expected: "Gas overflow in query_external (query)",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.err.Error())
+		})
+	}
+}